@@ -2,292 +2,35 @@ package constants
 
 const (
 	OWID_BASE_URL           = "https://ourworldindata.org/grapher/"
+	OWID_INDICATORS_API_URL = "https://api.ourworldindata.org/v1/indicators/"
 	RETRY_COUNT             = 3
 	CHART_WAIT_TIME_SECONDS = 60
 	CONCURRENT_REQUESTS     = 3
 	VIEWPORT_WIDTH          = 2560
 	VIEWPORT_HEIGHT         = 1440
-)
-
-var COUNTRY_CODES = map[string]string{
-	"Afghanistan":                       "AFG",
-	"Åland Islands":                     "ALA",
-	"Albania":                           "ALB",
-	"Algeria":                           "DZA",
-	"American Samoa":                    "ASM",
-	"Andorra":                           "AND",
-	"Angola":                            "AGO",
-	"Anguilla":                          "AIA",
-	"Antarctica":                        "ATA",
-	"Antigua and Barbuda":               "ATG",
-	"Argentina":                         "ARG",
-	"Armenia":                           "ARM",
-	"Aruba":                             "ABW",
-	"Australia":                         "AUS",
-	"Austria":                           "AUT",
-	"Azerbaijan":                        "AZE",
-	"Bahamas":                           "BHS",
-	"Bahrain":                           "BHR",
-	"Bangladesh":                        "BGD",
-	"Barbados":                          "BRB",
-	"Belarus":                           "BLR",
-	"Belgium":                           "BEL",
-	"Belize":                            "BLZ",
-	"Benin":                             "BEN",
-	"Bermuda":                           "BMU",
-	"Bhutan":                            "BTN",
-	"Bolivia":                           "BOL",
-	"Bonaire, Sint Eustatius and Saba":  "BES",
-	"Bosnia and Herzegovina":            "BIH",
-	"Botswana":                          "BWA",
-	"Bouvet Island":                     "BVT",
-	"Brazil":                            "BRA",
-	"British Indian Ocean Territory":    "IOT",
-	"Brunei":                            "BRN",
-	"Bulgaria":                          "BGR",
-	"Burkina Faso":                      "BFA",
-	"Burundi":                           "BDI",
-	"Cambodia":                          "KHM",
-	"Cameroon":                          "CMR",
-	"Canada":                            "CAN",
-	"Cape Verde":                        "CPV",
-	"Cayman Islands":                    "CYM",
-	"Central African Republic":          "CAF",
-	"Chad":                              "TCD",
-	"Chile":                             "CHL",
-	"China":                             "CHN",
-	"Christmas Island":                  "CXR",
-	"Cocos (Keeling) Islands":           "CCK",
-	"Colombia":                          "COL",
-	"Comoros":                           "COM",
-	"Congo":                             "COG",
-	"Democratic Republic of Congo":      "COD",
-	"Cook Islands":                      "COK",
-	"Costa Rica":                        "CRI",
-	"Cote d'Ivoire":                     "CIV",
-	"Croatia":                           "HRV",
-	"Cuba":                              "CUB",
-	"Curaçao":                           "CUW",
-	"Cyprus":                            "CYP",
-	"Czechia":                           "CZE",
-	"Denmark":                           "DNK",
-	"Djibouti":                          "DJI",
-	"Dominica":                          "DMA",
-	"Dominican Republic":                "DOM",
-	"Ecuador":                           "ECU",
-	"Egypt":                             "EGY",
-	"El Salvador":                       "SLV",
-	"Equatorial Guinea":                 "GNQ",
-	"Eritrea":                           "ERI",
-	"Estonia":                           "EST",
-	"Ethiopia":                          "ETH",
-	"Falkland Islands (Malvinas)":       "FLK",
-	"Faroe Islands":                     "FRO",
-	"Fiji":                              "FJI",
-	"Finland":                           "FIN",
-	"France":                            "FRA",
-	"French Guiana":                     "GUF",
-	"French Polynesia":                  "PYF",
-	"French Southern Territories":       "ATF",
-	"Gabon":                             "GAB",
-	"Gambia":                            "GMB",
-	"Georgia":                           "GEO",
-	"Germany":                           "DEU",
-	"Ghana":                             "GHA",
-	"Gibraltar":                         "GIB",
-	"Greece":                            "GRC",
-	"Greenland":                         "GRL",
-	"Grenada":                           "GRD",
-	"Guadeloupe":                        "GLP",
-	"Guam":                              "GUM",
-	"Guatemala":                         "GTM",
-	"Guernsey":                          "GGY",
-	"Guinea":                            "GIN",
-	"Guinea-Bissau":                     "GNB",
-	"Guyana":                            "GUY",
-	"Haiti":                             "HTI",
-	"Heard Island and McDonald Islands": "HMD",
-	"Holy See (Vatican City State)":     "VAT",
-	"Honduras":                          "HND",
-	"Hong Kong":                         "HKG",
-	"Hungary":                           "HUN",
-	"Iceland":                           "ISL",
-	"India":                             "IND",
-	"Indonesia":                         "IDN",
-	"Iran":                              "IRN",
-	"Iraq":                              "IRQ",
-	"Ireland":                           "IRL",
-	"Isle of Man":                       "IMN",
-	"Israel":                            "ISR",
-	"Italy":                             "ITA",
-	"Jamaica":                           "JAM",
-	"Japan":                             "JPN",
-	"Jersey":                            "JEY",
-	"Jordan":                            "JOR",
-	"Kazakhstan":                        "KAZ",
-	"Kenya":                             "KEN",
-	"Kiribati":                          "KIR",
-	"North Korea":                       "PRK",
-	"South Korea":                       "KOR",
-	"Kuwait":                            "KWT",
-	"Kyrgyzstan":                        "KGZ",
-	"Laos":                              "LAO",
-	"Latvia":                            "LVA",
-	"Lebanon":                           "LBN",
-	"Lesotho":                           "LSO",
-	"Liberia":                           "LBR",
-	"Libya":                             "LBY",
-	"Liechtenstein":                     "LIE",
-	"Lithuania":                         "LTU",
-	"Luxembourg":                        "LUX",
-	"Macao":                             "MAC",
-	"North Macedonia":                   "MKD",
-	"Madagascar":                        "MDG",
-	"Malawi":                            "MWI",
-	"Malaysia":                          "MYS",
-	"Maldives":                          "MDV",
-	"Mali":                              "MLI",
-	"Malta":                             "MLT",
-	"Marshall Islands":                  "MHL",
-	"Martinique":                        "MTQ",
-	"Mauritania":                        "MRT",
-	"Mauritius":                         "MUS",
-	"Mayotte":                           "MYT",
-	"Mexico":                            "MEX",
-	"Micronesia (country)":              "FSM",
-	"Moldova":                           "MDA",
-	"Monaco":                            "MCO",
-	"Mongolia":                          "MNG",
-	"Montenegro":                        "MNE",
-	"Montserrat":                        "MSR",
-	"Morocco":                           "MAR",
-	"Mozambique":                        "MOZ",
-	"Myanmar":                           "MMR",
-	"Namibia":                           "NAM",
-	"Nauru":                             "NRU",
-	"Nepal":                             "NPL",
-	"Netherlands":                       "NLD",
-	"New Caledonia":                     "NCL",
-	"New Zealand":                       "NZL",
-	"Nicaragua":                         "NIC",
-	"Niger":                             "NER",
-	"Nigeria":                           "NGA",
-	"Niue":                              "NIU",
-	"Norfolk Island":                    "NFK",
-	"Northern Mariana Islands":          "MNP",
-	"Norway":                            "NOR",
-	"Oman":                              "OMN",
-	"Pakistan":                          "PAK",
-	"Palau":                             "PLW",
-	"Palestinian Territory, Occupied":   "PSE",
-	"Panama":                            "PAN",
-	"Papua New Guinea":                  "PNG",
-	"Paraguay":                          "PRY",
-	"Peru":                              "PER",
-	"Philippines":                       "PHL",
-	"Pitcairn":                          "PCN",
-	"Poland":                            "POL",
-	"Portugal":                          "PRT",
-	"Puerto Rico":                       "PRI",
-	"Qatar":                             "QAT",
-	"Réunion":                           "REU",
-	"Romania":                           "ROU",
-	"Russia":                            "RUS",
-	"Rwanda":                            "RWA",
-	"Saint Barthélemy":                  "BLM",
-	"Saint Helena, Ascension and Tristan da Cunha": "SHN",
-	"Saint Kitts and Nevis":                        "KNA",
-	"Saint Lucia":                                  "LCA",
-	"Saint Martin (French part)":                   "MAF",
-	"Saint Pierre and Miquelon":                    "SPM",
-	"Saint Vincent and the Grenadines":             "VCT",
-	"Samoa":                                        "WSM",
-	"San Marino":                                   "SMR",
-	"Sao Tome and Principe":                        "STP",
-	"Saudi Arabia":                                 "SAU",
-	"Senegal":                                      "SEN",
-	"Serbia":                                       "SRB",
-	"Seychelles":                                   "SYC",
-	"Sierra Leone":                                 "SLE",
-	"Singapore":                                    "SGP",
-	"Sint Maarten (Dutch part)":                    "SXM",
-	"Slovakia":                                     "SVK",
-	"Slovenia":                                     "SVN",
-	"Solomon Islands":                              "SLB",
-	"Somalia":                                      "SOM",
-	"South Africa":                                 "ZAF",
-	"South Georgia and the South Sandwich Islands": "SGS",
-	"South Sudan":                          "SSD",
-	"Spain":                                "ESP",
-	"Sri Lanka":                            "LKA",
-	"Sudan":                                "SDN",
-	"Suriname":                             "SUR",
-	"Svalbard and Jan Mayen":               "SJM",
-	"Eswatini":                             "SWZ",
-	"Sweden":                               "SWE",
-	"Switzerland":                          "CHE",
-	"Syria":                                "SYR",
-	"Taiwan, Province of China":            "TWN",
-	"Tajikistan":                           "TJK",
-	"Tanzania":                             "TZA",
-	"Thailand":                             "THA",
-	"East Timor":                           "TLS",
-	"Togo":                                 "TGO",
-	"Tokelau":                              "TKL",
-	"Tonga":                                "TON",
-	"Trinidad and Tobago":                  "TTO",
-	"Tunisia":                              "TUN",
-	"Turkey":                               "TUR",
-	"Turkmenistan":                         "TKM",
-	"Turks and Caicos Islands":             "TCA",
-	"Tuvalu":                               "TUV",
-	"Uganda":                               "UGA",
-	"Ukraine":                              "UKR",
-	"United Arab Emirates":                 "ARE",
-	"United Kingdom":                       "GBR",
-	"United States":                        "USA",
-	"United States Minor Outlying Islands": "UMI",
-	"Uruguay":                              "URY",
-	"Uzbekistan":                           "UZB",
-	"Vanuatu":                              "VUT",
-	"Venezuela":                            "VEN",
-	"Vietnam":                              "VNM",
-	"Virgin Islands, British":              "VGB",
-	"Virgin Islands, U.S.":                 "VIR",
-	"Wallis and Futuna":                    "WLF",
-	"Western Sahara":                       "ESH",
-	"Yemen":                                "YEM",
-	"Zambia":                               "ZMB",
-	"Zimbabwe":                             "ZWE",
-
-	// OWID provided regions
-	"World":         "OWID_WRL",
-	"Africa":        "OWID_AFR",
-	"South America": "OWID_SAM",
-	"North America": "OWID_NAM",
-	"Asia":          "OWID_ASI",
-	"Europe":        "OWID_EUR",
-	"Oceania":       "OWID_OCE",
-}
 
-func GetCountryCodeNameMap() map[string]string {
-	result := make(map[string]string)
-
-	for name, code := range COUNTRY_CODES {
-		result[code] = name
-	}
-
-	return result
-}
+	CHUNKED_UPLOAD_THRESHOLD = 4 * 1024 * 1024 // Files larger than this are uploaded in chunks
+	UPLOAD_CHUNK_SIZE        = 1024 * 1024
+)
 
-var REGIONS_CODES_NAME_MAP = map[string]string{
-	"OWID_WRL": "World",
-	"OWID_AFR": "Africa",
-	"OWID_SAM": "South America",
-	"OWID_NAM": "North America",
-	"OWID_ASI": "Asia",
-	"OWID_EUR": "Europe",
-	"OWID_OCE": "Oceania",
+// COUNTRY_PRESETS are named country groups a task can include or exclude instead of listing the codes
+var COUNTRY_PRESETS = map[string][]string{
+	"EU27": {
+		"AUT", "BEL", "BGR", "HRV", "CYP", "CZE", "DNK", "EST", "FIN", "FRA", "DEU", "GRC", "HUN", "IRL",
+		"ITA", "LVA", "LTU", "LUX", "MLT", "NLD", "POL", "PRT", "ROU", "SVK", "SVN", "ESP", "SWE",
+	},
+	// Member countries only, the European Union is imported as an aggregate and the African Union has no chart
+	"G20": {
+		"ARG", "AUS", "BRA", "CAN", "CHN", "FRA", "DEU", "IND", "IDN", "ITA", "JPN", "KOR", "MEX", "RUS",
+		"SAU", "ZAF", "TUR", "GBR", "USA",
+	},
+	// World Bank grouping
+	"Sub-Saharan Africa": {
+		"AGO", "BEN", "BWA", "BFA", "BDI", "CPV", "CMR", "CAF", "TCD", "COM", "COD", "COG", "CIV", "GNQ",
+		"ERI", "SWZ", "ETH", "GAB", "GMB", "GHA", "GIN", "GNB", "KEN", "LSO", "LBR", "MDG", "MWI", "MLI",
+		"MRT", "MUS", "MOZ", "NAM", "NER", "NGA", "RWA", "STP", "SEN", "SYC", "SLE", "SOM", "ZAF", "SSD",
+		"SDN", "TZA", "TGO", "UGA", "ZMB", "ZWE",
+	},
 }
 
 var REGIONS = []string{
@@ -0,0 +1,119 @@
+package entities
+
+import (
+	"strings"
+)
+
+type Category string
+
+const (
+	CategoryCountry     Category = "country"      // Countries and territories, historical ones included
+	CategoryRegion      Category = "region"       // Continents and the world as OWID draws them on maps
+	CategoryAggregate   Category = "aggregate"    // Other groups of countries, e.g. European Union (27)
+	CategoryIncomeGroup Category = "income_group" // World Bank income groups
+	CategorySubnational Category = "subnational"  // Parts of a country, e.g. US states
+)
+
+var Categories = []Category{CategoryCountry, CategoryRegion, CategoryAggregate, CategoryIncomeGroup, CategorySubnational}
+
+// Entity is a country, territory, region, group or subnational unit OWID shows in its charts.
+// Name is the canonical label, Aliases holds the other labels OWID and the ISO standard
+// used for it over time
+type Entity struct {
+	Name            string
+	Category        Category
+	ISO2            string
+	ISO3            string
+	OWIDCode        string // OWID's own code for entities without an ISO code, e.g. OWID_KOS
+	SubdivisionCode string // ISO 3166-2 code of subnational units, e.g. US-CA
+	Aliases         []string
+	Historical      bool // No longer exists, e.g. USSR
+}
+
+// Code returns the code the entity is stored under in task processes and charts
+func (e *Entity) Code() string {
+	if e.OWIDCode != "" {
+		return e.OWIDCode
+	}
+	if e.ISO3 != "" {
+		return e.ISO3
+	}
+	return e.SubdivisionCode
+}
+
+// Names returns the name followed by the aliases of the entity
+func (e *Entity) Names() []string {
+	return append([]string{e.Name}, e.Aliases...)
+}
+
+// MatchesName reports whether name is the name or one of the aliases of the entity
+func (e *Entity) MatchesName(name string) bool {
+	normalized := normalizeName(name)
+	for _, entityName := range e.Names() {
+		if normalizeName(entityName) == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// ElementIDs returns the ids the map svg may give the entity's shape, OWID derives
+// them from the entity label
+func (e *Entity) ElementIDs() []string {
+	ids := make([]string, 0, len(e.Aliases)+1)
+	for _, name := range e.Names() {
+		ids = append(ids, strings.ReplaceAll(name, " ", "-"))
+	}
+	return ids
+}
+
+var (
+	byName = make(map[string]*Entity)
+	byCode = make(map[string]*Entity)
+)
+
+func init() {
+	for i := range registry {
+		entity := &registry[i]
+		// Names are shared at times, e.g. Georgia the country and the US state. The earlier
+		// entry wins so countries keep their names
+		for _, name := range entity.Names() {
+			if _, exists := byName[normalizeName(name)]; !exists {
+				byName[normalizeName(name)] = entity
+			}
+		}
+		for _, code := range []string{entity.ISO2, entity.ISO3, entity.OWIDCode, entity.SubdivisionCode} {
+			if code != "" {
+				byCode[code] = entity
+			}
+		}
+	}
+}
+
+// FindByName looks an entity up by its name or one of its aliases, ignoring case and spacing
+func FindByName(name string) (*Entity, bool) {
+	entity, ok := byName[normalizeName(name)]
+	return entity, ok
+}
+
+// FindByCode looks an entity up by its ISO alpha-2, ISO alpha-3, OWID or ISO 3166-2 code
+func FindByCode(code string) (*Entity, bool) {
+	entity, ok := byCode[strings.ToUpper(strings.TrimSpace(code))]
+	return entity, ok
+}
+
+// Current returns the entities that still exist, of every category
+func Current() []*Entity {
+	result := make([]*Entity, 0, len(registry))
+	for i := range registry {
+		if !registry[i].Historical {
+			result = append(result, &registry[i])
+		}
+	}
+	return result
+}
+
+func normalizeName(name string) string {
+	name = strings.ReplaceAll(name, "’", "'")
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
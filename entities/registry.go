@@ -0,0 +1,354 @@
+package entities
+
+func country(name, iso2, iso3 string, aliases ...string) Entity {
+	return Entity{Name: name, Category: CategoryCountry, ISO2: iso2, ISO3: iso3, Aliases: aliases}
+}
+
+func historical(name, iso3, owidCode string, aliases ...string) Entity {
+	return Entity{Name: name, Category: CategoryCountry, ISO3: iso3, OWIDCode: owidCode, Aliases: aliases, Historical: true}
+}
+
+func region(name, owidCode string, aliases ...string) Entity {
+	return Entity{Name: name, Category: CategoryRegion, OWIDCode: owidCode, Aliases: aliases}
+}
+
+func aggregate(name, owidCode string, aliases ...string) Entity {
+	return Entity{Name: name, Category: CategoryAggregate, OWIDCode: owidCode, Aliases: aliases}
+}
+
+func incomeGroup(name, owidCode string, aliases ...string) Entity {
+	return Entity{Name: name, Category: CategoryIncomeGroup, OWIDCode: owidCode, Aliases: aliases}
+}
+
+func subnational(name, subdivisionCode string, aliases ...string) Entity {
+	return Entity{Name: name, Category: CategorySubnational, SubdivisionCode: subdivisionCode, Aliases: aliases}
+}
+
+var registry = []Entity{
+	country("Afghanistan", "AF", "AFG"),
+	country("Åland Islands", "AX", "ALA", "Aland Islands"),
+	country("Albania", "AL", "ALB"),
+	country("Algeria", "DZ", "DZA"),
+	country("American Samoa", "AS", "ASM"),
+	country("Andorra", "AD", "AND"),
+	country("Angola", "AO", "AGO"),
+	country("Anguilla", "AI", "AIA"),
+	country("Antarctica", "AQ", "ATA"),
+	country("Antigua and Barbuda", "AG", "ATG"),
+	country("Argentina", "AR", "ARG"),
+	country("Armenia", "AM", "ARM"),
+	country("Aruba", "AW", "ABW"),
+	country("Australia", "AU", "AUS"),
+	country("Austria", "AT", "AUT"),
+	country("Azerbaijan", "AZ", "AZE"),
+	country("Bahamas", "BS", "BHS", "The Bahamas", "Bahamas, The"),
+	country("Bahrain", "BH", "BHR"),
+	country("Bangladesh", "BD", "BGD"),
+	country("Barbados", "BB", "BRB"),
+	country("Belarus", "BY", "BLR"),
+	country("Belgium", "BE", "BEL"),
+	country("Belize", "BZ", "BLZ"),
+	country("Benin", "BJ", "BEN"),
+	country("Bermuda", "BM", "BMU"),
+	country("Bhutan", "BT", "BTN"),
+	country("Bolivia", "BO", "BOL", "Bolivia (Plurinational State of)"),
+	country("Bonaire, Sint Eustatius and Saba", "BQ", "BES", "Bonaire Sint Eustatius and Saba", "Caribbean Netherlands"),
+	country("Bosnia and Herzegovina", "BA", "BIH"),
+	country("Botswana", "BW", "BWA"),
+	country("Bouvet Island", "BV", "BVT"),
+	country("Brazil", "BR", "BRA"),
+	country("British Indian Ocean Territory", "IO", "IOT"),
+	country("Brunei", "BN", "BRN", "Brunei Darussalam"),
+	country("Bulgaria", "BG", "BGR"),
+	country("Burkina Faso", "BF", "BFA"),
+	country("Burundi", "BI", "BDI"),
+	country("Cambodia", "KH", "KHM"),
+	country("Cameroon", "CM", "CMR"),
+	country("Canada", "CA", "CAN"),
+	country("Cape Verde", "CV", "CPV", "Cabo Verde"),
+	country("Cayman Islands", "KY", "CYM"),
+	country("Central African Republic", "CF", "CAF"),
+	country("Chad", "TD", "TCD"),
+	country("Chile", "CL", "CHL"),
+	country("China", "CN", "CHN"),
+	country("Christmas Island", "CX", "CXR"),
+	country("Cocos (Keeling) Islands", "CC", "CCK", "Cocos Islands"),
+	country("Colombia", "CO", "COL"),
+	country("Comoros", "KM", "COM"),
+	country("Congo", "CG", "COG", "Republic of the Congo", "Congo, Rep."),
+	country("Democratic Republic of Congo", "CD", "COD", "Democratic Republic of the Congo", "Congo, Dem. Rep."),
+	country("Cook Islands", "CK", "COK"),
+	country("Costa Rica", "CR", "CRI"),
+	country("Cote d'Ivoire", "CI", "CIV", "Côte d'Ivoire", "Ivory Coast"),
+	country("Croatia", "HR", "HRV"),
+	country("Cuba", "CU", "CUB"),
+	country("Curaçao", "CW", "CUW", "Curacao"),
+	country("Cyprus", "CY", "CYP"),
+	country("Czechia", "CZ", "CZE", "Czech Republic"),
+	country("Denmark", "DK", "DNK"),
+	country("Djibouti", "DJ", "DJI"),
+	country("Dominica", "DM", "DMA"),
+	country("Dominican Republic", "DO", "DOM"),
+	country("Ecuador", "EC", "ECU"),
+	country("Egypt", "EG", "EGY"),
+	country("El Salvador", "SV", "SLV"),
+	country("Equatorial Guinea", "GQ", "GNQ"),
+	country("Eritrea", "ER", "ERI"),
+	country("Estonia", "EE", "EST"),
+	country("Ethiopia", "ET", "ETH"),
+	country("Falkland Islands (Malvinas)", "FK", "FLK", "Falkland Islands"),
+	country("Faroe Islands", "FO", "FRO", "Faeroe Islands"),
+	country("Fiji", "FJ", "FJI"),
+	country("Finland", "FI", "FIN"),
+	country("France", "FR", "FRA"),
+	country("French Guiana", "GF", "GUF"),
+	country("French Polynesia", "PF", "PYF"),
+	country("French Southern Territories", "TF", "ATF"),
+	country("Gabon", "GA", "GAB"),
+	country("Gambia", "GM", "GMB", "The Gambia", "Gambia, The"),
+	country("Georgia", "GE", "GEO"),
+	country("Germany", "DE", "DEU"),
+	country("Ghana", "GH", "GHA"),
+	country("Gibraltar", "GI", "GIB"),
+	country("Greece", "GR", "GRC"),
+	country("Greenland", "GL", "GRL"),
+	country("Grenada", "GD", "GRD"),
+	country("Guadeloupe", "GP", "GLP"),
+	country("Guam", "GU", "GUM"),
+	country("Guatemala", "GT", "GTM"),
+	country("Guernsey", "GG", "GGY"),
+	country("Guinea", "GN", "GIN"),
+	country("Guinea-Bissau", "GW", "GNB"),
+	country("Guyana", "GY", "GUY"),
+	country("Haiti", "HT", "HTI"),
+	country("Heard Island and McDonald Islands", "HM", "HMD"),
+	country("Holy See (Vatican City State)", "VA", "VAT", "Vatican", "Vatican City", "Holy See"),
+	country("Honduras", "HN", "HND"),
+	country("Hong Kong", "HK", "HKG"),
+	country("Hungary", "HU", "HUN"),
+	country("Iceland", "IS", "ISL"),
+	country("India", "IN", "IND"),
+	country("Indonesia", "ID", "IDN"),
+	country("Iran", "IR", "IRN", "Iran (Islamic Republic of)", "Iran, Islamic Rep."),
+	country("Iraq", "IQ", "IRQ"),
+	country("Ireland", "IE", "IRL"),
+	country("Isle of Man", "IM", "IMN"),
+	country("Israel", "IL", "ISR"),
+	country("Italy", "IT", "ITA"),
+	country("Jamaica", "JM", "JAM"),
+	country("Japan", "JP", "JPN"),
+	country("Jersey", "JE", "JEY"),
+	country("Jordan", "JO", "JOR"),
+	country("Kazakhstan", "KZ", "KAZ"),
+	country("Kenya", "KE", "KEN"),
+	country("Kiribati", "KI", "KIR"),
+	country("North Korea", "KP", "PRK", "Democratic People's Republic of Korea", "Korea, Dem. People's Rep."),
+	country("South Korea", "KR", "KOR", "Republic of Korea", "Korea, Rep."),
+	{Name: "Kosovo", Category: CategoryCountry, ISO2: "XK", OWIDCode: "OWID_KOS"},
+	country("Kuwait", "KW", "KWT"),
+	country("Kyrgyzstan", "KG", "KGZ", "Kyrgyz Republic"),
+	country("Laos", "LA", "LAO", "Lao People's Democratic Republic", "Lao PDR"),
+	country("Latvia", "LV", "LVA"),
+	country("Lebanon", "LB", "LBN"),
+	country("Lesotho", "LS", "LSO"),
+	country("Liberia", "LR", "LBR"),
+	country("Libya", "LY", "LBY"),
+	country("Liechtenstein", "LI", "LIE"),
+	country("Lithuania", "LT", "LTU"),
+	country("Luxembourg", "LU", "LUX"),
+	country("Macao", "MO", "MAC", "Macau"),
+	country("North Macedonia", "MK", "MKD", "Macedonia"),
+	country("Madagascar", "MG", "MDG"),
+	country("Malawi", "MW", "MWI"),
+	country("Malaysia", "MY", "MYS"),
+	country("Maldives", "MV", "MDV"),
+	country("Mali", "ML", "MLI"),
+	country("Malta", "MT", "MLT"),
+	country("Marshall Islands", "MH", "MHL"),
+	country("Martinique", "MQ", "MTQ"),
+	country("Mauritania", "MR", "MRT"),
+	country("Mauritius", "MU", "MUS"),
+	country("Mayotte", "YT", "MYT"),
+	country("Mexico", "MX", "MEX"),
+	country("Micronesia (country)", "FM", "FSM", "Micronesia", "Micronesia (Federated States of)", "Micronesia, Fed. Sts."),
+	country("Moldova", "MD", "MDA", "Republic of Moldova"),
+	country("Monaco", "MC", "MCO"),
+	country("Mongolia", "MN", "MNG"),
+	country("Montenegro", "ME", "MNE"),
+	country("Montserrat", "MS", "MSR"),
+	country("Morocco", "MA", "MAR"),
+	country("Mozambique", "MZ", "MOZ"),
+	country("Myanmar", "MM", "MMR", "Burma"),
+	country("Namibia", "NA", "NAM"),
+	country("Nauru", "NR", "NRU"),
+	country("Nepal", "NP", "NPL"),
+	country("Netherlands", "NL", "NLD"),
+	country("New Caledonia", "NC", "NCL"),
+	country("New Zealand", "NZ", "NZL"),
+	country("Nicaragua", "NI", "NIC"),
+	country("Niger", "NE", "NER"),
+	country("Nigeria", "NG", "NGA"),
+	country("Niue", "NU", "NIU"),
+	country("Norfolk Island", "NF", "NFK"),
+	country("Northern Mariana Islands", "MP", "MNP"),
+	country("Norway", "NO", "NOR"),
+	country("Oman", "OM", "OMN"),
+	country("Pakistan", "PK", "PAK"),
+	country("Palau", "PW", "PLW"),
+	country("Palestinian Territory, Occupied", "PS", "PSE", "Palestine", "State of Palestine", "West Bank and Gaza"),
+	country("Panama", "PA", "PAN"),
+	country("Papua New Guinea", "PG", "PNG"),
+	country("Paraguay", "PY", "PRY"),
+	country("Peru", "PE", "PER"),
+	country("Philippines", "PH", "PHL"),
+	country("Pitcairn", "PN", "PCN", "Pitcairn Islands"),
+	country("Poland", "PL", "POL"),
+	country("Portugal", "PT", "PRT"),
+	country("Puerto Rico", "PR", "PRI"),
+	country("Qatar", "QA", "QAT"),
+	country("Réunion", "RE", "REU", "Reunion"),
+	country("Romania", "RO", "ROU"),
+	country("Russia", "RU", "RUS", "Russian Federation"),
+	country("Rwanda", "RW", "RWA"),
+	country("Saint Barthélemy", "BL", "BLM", "Saint Barthelemy"),
+	country("Saint Helena, Ascension and Tristan da Cunha", "SH", "SHN", "Saint Helena"),
+	country("Saint Kitts and Nevis", "KN", "KNA"),
+	country("Saint Lucia", "LC", "LCA"),
+	country("Saint Martin (French part)", "MF", "MAF", "Saint Martin"),
+	country("Saint Pierre and Miquelon", "PM", "SPM"),
+	country("Saint Vincent and the Grenadines", "VC", "VCT"),
+	country("Samoa", "WS", "WSM"),
+	country("San Marino", "SM", "SMR"),
+	country("Sao Tome and Principe", "ST", "STP", "São Tomé and Príncipe"),
+	country("Saudi Arabia", "SA", "SAU"),
+	country("Senegal", "SN", "SEN"),
+	country("Serbia", "RS", "SRB"),
+	country("Seychelles", "SC", "SYC"),
+	country("Sierra Leone", "SL", "SLE"),
+	country("Singapore", "SG", "SGP"),
+	country("Sint Maarten (Dutch part)", "SX", "SXM", "Sint Maarten"),
+	country("Slovakia", "SK", "SVK", "Slovak Republic"),
+	country("Slovenia", "SI", "SVN"),
+	country("Solomon Islands", "SB", "SLB"),
+	country("Somalia", "SO", "SOM"),
+	country("South Africa", "ZA", "ZAF"),
+	country("South Georgia and the South Sandwich Islands", "GS", "SGS"),
+	country("South Sudan", "SS", "SSD"),
+	country("Spain", "ES", "ESP"),
+	country("Sri Lanka", "LK", "LKA"),
+	country("Sudan", "SD", "SDN"),
+	country("Suriname", "SR", "SUR"),
+	country("Svalbard and Jan Mayen", "SJ", "SJM"),
+	country("Eswatini", "SZ", "SWZ", "Swaziland"),
+	country("Sweden", "SE", "SWE"),
+	country("Switzerland", "CH", "CHE"),
+	country("Syria", "SY", "SYR", "Syrian Arab Republic"),
+	country("Taiwan, Province of China", "TW", "TWN", "Taiwan"),
+	country("Tajikistan", "TJ", "TJK"),
+	country("Tanzania", "TZ", "TZA", "United Republic of Tanzania"),
+	country("Thailand", "TH", "THA"),
+	country("East Timor", "TL", "TLS", "Timor-Leste", "Timor"),
+	country("Togo", "TG", "TGO"),
+	country("Tokelau", "TK", "TKL"),
+	country("Tonga", "TO", "TON"),
+	country("Trinidad and Tobago", "TT", "TTO"),
+	country("Tunisia", "TN", "TUN"),
+	country("Turkey", "TR", "TUR", "Türkiye", "Turkiye"),
+	country("Turkmenistan", "TM", "TKM"),
+	country("Turks and Caicos Islands", "TC", "TCA"),
+	country("Tuvalu", "TV", "TUV"),
+	country("Uganda", "UG", "UGA"),
+	country("Ukraine", "UA", "UKR"),
+	country("United Arab Emirates", "AE", "ARE"),
+	country("United Kingdom", "GB", "GBR", "UK"),
+	country("United States", "US", "USA", "United States of America", "USA"),
+	country("United States Minor Outlying Islands", "UM", "UMI"),
+	country("Uruguay", "UY", "URY"),
+	country("Uzbekistan", "UZ", "UZB"),
+	country("Vanuatu", "VU", "VUT"),
+	country("Venezuela", "VE", "VEN", "Venezuela (Bolivarian Republic of)"),
+	country("Vietnam", "VN", "VNM", "Viet Nam"),
+	country("Virgin Islands, British", "VG", "VGB", "British Virgin Islands"),
+	country("Virgin Islands, U.S.", "VI", "VIR", "United States Virgin Islands", "US Virgin Islands"),
+	country("Wallis and Futuna", "WF", "WLF"),
+	country("Western Sahara", "EH", "ESH"),
+	country("Yemen", "YE", "YEM"),
+	country("Zambia", "ZM", "ZMB"),
+	country("Zimbabwe", "ZW", "ZWE"),
+
+	// Historical entities, ISO3 holds the withdrawn ISO 3166 code
+	historical("USSR", "SUN", "OWID_USS", "Soviet Union"),
+	historical("Yugoslavia", "YUG", "OWID_YGS"),
+	historical("Czechoslovakia", "CSK", "OWID_CZS"),
+	historical("Serbia and Montenegro", "SCG", "OWID_SRM"),
+	historical("East Germany", "DDR", "", "German Democratic Republic"),
+
+	// OWID provided regions
+	region("World", "OWID_WRL"),
+	region("Africa", "OWID_AFR"),
+	region("South America", "OWID_SAM"),
+	region("North America", "OWID_NAM"),
+	region("Asia", "OWID_ASI"),
+	region("Europe", "OWID_EUR"),
+	region("Oceania", "OWID_OCE"),
+
+	aggregate("European Union (27)", "OWID_EU27", "European Union", "EU-27", "EU27"),
+
+	incomeGroup("High-income countries", "OWID_HIC", "High income"),
+	incomeGroup("Upper-middle-income countries", "OWID_UMC", "Upper middle income"),
+	incomeGroup("Lower-middle-income countries", "OWID_LMC", "Lower middle income"),
+	incomeGroup("Low-income countries", "OWID_LIC", "Low income"),
+
+	// US states, Georgia the state is shadowed by the country when looked up by name
+	subnational("Alabama", "US-AL"),
+	subnational("Alaska", "US-AK"),
+	subnational("Arizona", "US-AZ"),
+	subnational("Arkansas", "US-AR"),
+	subnational("California", "US-CA"),
+	subnational("Colorado", "US-CO"),
+	subnational("Connecticut", "US-CT"),
+	subnational("Delaware", "US-DE"),
+	subnational("District of Columbia", "US-DC", "Washington DC", "Washington, D.C."),
+	subnational("Florida", "US-FL"),
+	subnational("Georgia (US state)", "US-GA", "Georgia"),
+	subnational("Hawaii", "US-HI"),
+	subnational("Idaho", "US-ID"),
+	subnational("Illinois", "US-IL"),
+	subnational("Indiana", "US-IN"),
+	subnational("Iowa", "US-IA"),
+	subnational("Kansas", "US-KS"),
+	subnational("Kentucky", "US-KY"),
+	subnational("Louisiana", "US-LA"),
+	subnational("Maine", "US-ME"),
+	subnational("Maryland", "US-MD"),
+	subnational("Massachusetts", "US-MA"),
+	subnational("Michigan", "US-MI"),
+	subnational("Minnesota", "US-MN"),
+	subnational("Mississippi", "US-MS"),
+	subnational("Missouri", "US-MO"),
+	subnational("Montana", "US-MT"),
+	subnational("Nebraska", "US-NE"),
+	subnational("Nevada", "US-NV"),
+	subnational("New Hampshire", "US-NH"),
+	subnational("New Jersey", "US-NJ"),
+	subnational("New Mexico", "US-NM"),
+	subnational("New York", "US-NY", "New York State"),
+	subnational("North Carolina", "US-NC"),
+	subnational("North Dakota", "US-ND"),
+	subnational("Ohio", "US-OH"),
+	subnational("Oklahoma", "US-OK"),
+	subnational("Oregon", "US-OR"),
+	subnational("Pennsylvania", "US-PA"),
+	subnational("Rhode Island", "US-RI"),
+	subnational("South Carolina", "US-SC"),
+	subnational("South Dakota", "US-SD"),
+	subnational("Tennessee", "US-TN"),
+	subnational("Texas", "US-TX"),
+	subnational("Utah", "US-UT"),
+	subnational("Vermont", "US-VT"),
+	subnational("Virginia", "US-VA"),
+	subnational("Washington", "US-WA", "Washington State"),
+	subnational("West Virginia", "US-WV"),
+	subnational("Wisconsin", "US-WI"),
+	subnational("Wyoming", "US-WY"),
+}
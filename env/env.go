@@ -18,6 +18,20 @@ type EnvVariables struct {
 	OWID_ENV             string
 	OWID_ENCRYPTION_KEY  string
 	OWID_ROD_BROWSER_DIR string
+	OWID_WORKER_SLOTS    int
+	OWID_USER_TASK_LIMIT int
+	OWID_WATCH_HOURS     int
+	OWID_SHUTDOWN_SECS   int
+
+	OWID_BROWSER_POOL_SIZE          int
+	OWID_BROWSER_LEASES_PER_BROWSER int
+	OWID_BROWSER_RECYCLE_LEASES     int
+	OWID_BROWSER_MAX_MEMORY_MB      int
+
+	OWID_MW_MAXLAG      int
+	OWID_MW_MAX_RETRIES int
+
+	OWID_EXPORT_DIR string
 }
 
 func GetEnv() EnvVariables {
@@ -75,6 +89,61 @@ func GetEnv() EnvVariables {
 		fmt.Println("Warning: OWID_ROD_BROWSER_DIR environment variable is not set. Using environment default")
 	}
 
+	workerSlots, err := strconv.Atoi(os.Getenv("OWID_WORKER_SLOTS"))
+	if err != nil || workerSlots < 1 {
+		workerSlots = 1
+	}
+
+	userTaskLimit, err := strconv.Atoi(os.Getenv("OWID_USER_TASK_LIMIT"))
+	if err != nil || userTaskLimit < 1 {
+		userTaskLimit = 1
+	}
+
+	watchHours, err := strconv.Atoi(os.Getenv("OWID_WATCH_HOURS"))
+	if err != nil || watchHours < 1 {
+		watchHours = 24
+	}
+
+	shutdownSecs, err := strconv.Atoi(os.Getenv("OWID_SHUTDOWN_SECS"))
+	if err != nil || shutdownSecs < 1 {
+		shutdownSecs = 25
+	}
+
+	browserPoolSize, err := strconv.Atoi(os.Getenv("OWID_BROWSER_POOL_SIZE"))
+	if err != nil || browserPoolSize < 1 {
+		browserPoolSize = 2
+	}
+
+	browserLeasesPerBrowser, err := strconv.Atoi(os.Getenv("OWID_BROWSER_LEASES_PER_BROWSER"))
+	if err != nil || browserLeasesPerBrowser < 1 {
+		browserLeasesPerBrowser = 2
+	}
+
+	browserRecycleLeases, err := strconv.Atoi(os.Getenv("OWID_BROWSER_RECYCLE_LEASES"))
+	if err != nil || browserRecycleLeases < 0 {
+		browserRecycleLeases = 50
+	}
+
+	browserMaxMemoryMB, err := strconv.Atoi(os.Getenv("OWID_BROWSER_MAX_MEMORY_MB"))
+	if err != nil || browserMaxMemoryMB < 0 {
+		browserMaxMemoryMB = 2048
+	}
+
+	mwMaxLag, err := strconv.Atoi(os.Getenv("OWID_MW_MAXLAG"))
+	if err != nil || mwMaxLag < 0 {
+		mwMaxLag = 5
+	}
+
+	mwMaxRetries, err := strconv.Atoi(os.Getenv("OWID_MW_MAX_RETRIES"))
+	if err != nil || mwMaxRetries < 0 {
+		mwMaxRetries = 5
+	}
+
+	exportDir := os.Getenv("OWID_EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = "exports"
+	}
+
 	return EnvVariables{
 		OWID_UA:              userAgent,
 		OWID_OAUTH_TOKEN:     oauthToken,
@@ -87,5 +156,19 @@ func GetEnv() EnvVariables {
 		OWID_ENV:             owidEnv,
 		OWID_ENCRYPTION_KEY:  owidEncKey,
 		OWID_ROD_BROWSER_DIR: rodBrowserDir,
+		OWID_WORKER_SLOTS:    workerSlots,
+		OWID_USER_TASK_LIMIT: userTaskLimit,
+		OWID_WATCH_HOURS:     watchHours,
+		OWID_SHUTDOWN_SECS:   shutdownSecs,
+
+		OWID_BROWSER_POOL_SIZE:          browserPoolSize,
+		OWID_BROWSER_LEASES_PER_BROWSER: browserLeasesPerBrowser,
+		OWID_BROWSER_RECYCLE_LEASES:     browserRecycleLeases,
+		OWID_BROWSER_MAX_MEMORY_MB:      browserMaxMemoryMB,
+
+		OWID_MW_MAXLAG:      mwMaxLag,
+		OWID_MW_MAX_RETRIES: mwMaxRetries,
+
+		OWID_EXPORT_DIR: exportDir,
 	}
 }
@@ -0,0 +1,109 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultWikiProfile is the profile built from OWID_MW_API and the OWID_OAUTH_* variables
+const DefaultWikiProfile = "default"
+
+var wikiProfileNameRegex = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// wikiProfiles is set once at startup by LoadWikiProfiles and only read after
+var wikiProfiles []WikiProfile
+
+// WikiProfile is a wiki tasks can import into, along with the OAuth consumer users log in to it with
+type WikiProfile struct {
+	Name               string `json:"name"`
+	MWApi              string `json:"apiUrl"`
+	OAuthToken         string `json:"-"`
+	OAuthSecret        string `json:"-"`
+	OAuthInitiate      string `json:"-"`
+	OAuthAuth          string `json:"-"`
+	OAuthTokenUrl      string `json:"-"`
+	TemplateNameFormat string `json:"templateNameFormat"` // Used by tasks created without a template name format
+	Description        string `json:"description"`        // Used by tasks created without a file description
+}
+
+// LoadWikiProfiles reads and validates the profiles once at startup, the default profile followed by
+// the ones listed in OWID_WIKI_PROFILES. Each listed profile reads OWID_WIKI_<NAME>_MW_API, the
+// OWID_WIKI_<NAME>_OAUTH_* variables and the optional OWID_WIKI_<NAME>_TEMPLATE_NAME_FORMAT and
+// OWID_WIKI_<NAME>_DESCRIPTION
+func LoadWikiProfiles() error {
+	profiles, err := parseWikiProfiles()
+	if err != nil {
+		return err
+	}
+	wikiProfiles = profiles
+	return nil
+}
+
+// GetWikiProfiles returns the profiles read by LoadWikiProfiles
+func GetWikiProfiles() []WikiProfile {
+	return wikiProfiles
+}
+
+func parseWikiProfiles() ([]WikiProfile, error) {
+	envData := GetEnv()
+	profiles := []WikiProfile{{
+		Name:               DefaultWikiProfile,
+		MWApi:              envData.OWID_MW_API,
+		OAuthToken:         envData.OWID_OAUTH_TOKEN,
+		OAuthSecret:        envData.OWID_OAUTH_SECRET,
+		OAuthInitiate:      envData.OWID_OAUTH_INITIATE,
+		OAuthAuth:          envData.OWID_OAUTH_AUTH,
+		OAuthTokenUrl:      envData.OWID_OAUTH_TOKEN_URL,
+		TemplateNameFormat: os.Getenv("OWID_TEMPLATE_NAME_FORMAT"),
+		Description:        os.Getenv("OWID_DESCRIPTION"),
+	}}
+
+	seen := map[string]bool{DefaultWikiProfile: true}
+	for _, name := range strings.Split(os.Getenv("OWID_WIKI_PROFILES"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !wikiProfileNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid wiki profile name in OWID_WIKI_PROFILES: %s", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("wiki profile %s is listed more than once in OWID_WIKI_PROFILES", name)
+		}
+		seen[name] = true
+
+		prefix := "OWID_WIKI_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		profile := WikiProfile{
+			Name:               name,
+			MWApi:              os.Getenv(prefix + "MW_API"),
+			OAuthToken:         os.Getenv(prefix + "OAUTH_TOKEN"),
+			OAuthSecret:        os.Getenv(prefix + "OAUTH_SECRET"),
+			OAuthInitiate:      os.Getenv(prefix + "OAUTH_INITIATE"),
+			OAuthAuth:          os.Getenv(prefix + "OAUTH_AUTH"),
+			OAuthTokenUrl:      os.Getenv(prefix + "OAUTH_TOKEN_URL"),
+			TemplateNameFormat: os.Getenv(prefix + "TEMPLATE_NAME_FORMAT"),
+			Description:        os.Getenv(prefix + "DESCRIPTION"),
+		}
+		if profile.MWApi == "" || profile.OAuthToken == "" || profile.OAuthSecret == "" || profile.OAuthInitiate == "" || profile.OAuthAuth == "" || profile.OAuthTokenUrl == "" {
+			return nil, fmt.Errorf("%sMW_API and the %sOAUTH_* environment variables are required", prefix, prefix)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// GetWikiProfile finds a profile by name, an empty name is the default profile
+func GetWikiProfile(name string) (WikiProfile, bool) {
+	if name == "" {
+		name = DefaultWikiProfile
+	}
+	for _, profile := range GetWikiProfiles() {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return WikiProfile{}, false
+}
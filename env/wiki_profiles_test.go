@@ -0,0 +1,93 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+var testEnv = map[string]string{
+	"OWID_UA":              "OWIDImporter tests",
+	"OWID_OAUTH_TOKEN":     "token",
+	"OWID_OAUTH_SECRET":    "secret",
+	"OWID_OAUTH_INITIATE":  "https://commons.example.org/initiate",
+	"OWID_OAUTH_AUTH":      "https://commons.example.org/authorize",
+	"OWID_OAUTH_TOKEN_URL": "https://commons.example.org/token",
+	"OWID_MW_API":          "https://commons.example.org/w/api.php",
+	"OWID_ENV":             "test",
+	"OWID_ENCRYPTION_KEY":  "af64797249a5dc20cb77d6eeb0a412e0e24a60570a7233f3dbba18ff9ae8f0a9",
+}
+
+func setWikiProfileEnv(t *testing.T, profiles string, extra map[string]string) {
+	for key, value := range testEnv {
+		t.Setenv(key, value)
+	}
+	t.Setenv("OWID_WIKI_PROFILES", profiles)
+	for key, value := range extra {
+		t.Setenv(key, value)
+	}
+	t.Cleanup(func() { wikiProfiles = nil })
+}
+
+func wikiProfileVars(prefix string) map[string]string {
+	return map[string]string{
+		prefix + "MW_API":          "https://test.example.org/w/api.php",
+		prefix + "OAUTH_TOKEN":     "test-token",
+		prefix + "OAUTH_SECRET":    "test-secret",
+		prefix + "OAUTH_INITIATE":  "https://test.example.org/initiate",
+		prefix + "OAUTH_AUTH":      "https://test.example.org/authorize",
+		prefix + "OAUTH_TOKEN_URL": "https://test.example.org/token",
+	}
+}
+
+func TestLoadWikiProfiles(t *testing.T) {
+	extra := wikiProfileVars("OWID_WIKI_TEST_WIKI_")
+	extra["OWID_WIKI_TEST_WIKI_DESCRIPTION"] = "Imported from OWID"
+	setWikiProfileEnv(t, " test-wiki ,", extra)
+
+	if err := LoadWikiProfiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles := GetWikiProfiles()
+	if len(profiles) != 2 || profiles[0].Name != DefaultWikiProfile || profiles[1].Name != "test-wiki" {
+		t.Fatalf("unexpected profiles %+v", profiles)
+	}
+	profile, ok := GetWikiProfile("test-wiki")
+	if !ok || profile.MWApi != "https://test.example.org/w/api.php" || profile.Description != "Imported from OWID" {
+		t.Errorf("unexpected test-wiki profile %+v", profile)
+	}
+	if profile, ok := GetWikiProfile(""); !ok || profile.Name != DefaultWikiProfile {
+		t.Errorf("expected an empty name to be the default profile, got %+v", profile)
+	}
+	if _, ok := GetWikiProfile("missing"); ok {
+		t.Error("expected an unknown profile not to be found")
+	}
+}
+
+func TestLoadWikiProfilesRejectsBadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles string
+		extra    map[string]string
+		want     string
+	}{
+		{name: "invalid name", profiles: "Test Wiki", want: "invalid wiki profile name"},
+		{name: "default name", profiles: DefaultWikiProfile, extra: wikiProfileVars("OWID_WIKI_DEFAULT_"), want: "listed more than once"},
+		{name: "listed twice", profiles: "test,test", extra: wikiProfileVars("OWID_WIKI_TEST_"), want: "listed more than once"},
+		{name: "missing variables", profiles: "test", want: "OWID_WIKI_TEST_MW_API"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setWikiProfileEnv(t, test.profiles, test.extra)
+
+			err := LoadWikiProfiles()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("expected an error containing %q, got %v", test.want, err)
+			}
+			if len(GetWikiProfiles()) != 0 {
+				t.Error("expected no profiles to be loaded from a bad config")
+			}
+		})
+	}
+}
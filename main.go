@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-rod/rod/lib/launcher"
@@ -11,6 +15,7 @@ import (
 	"github.com/wpmed-videowiki/OWIDImporter/env"
 	"github.com/wpmed-videowiki/OWIDImporter/models"
 	"github.com/wpmed-videowiki/OWIDImporter/routes"
+	"github.com/wpmed-videowiki/OWIDImporter/scheduler"
 	"github.com/wpmed-videowiki/OWIDImporter/services"
 	"github.com/wpmed-videowiki/OWIDImporter/utils"
 )
@@ -23,16 +28,39 @@ func main() {
 	}
 	// Verify environment variables
 	e := env.GetEnv()
+	if err := env.LoadWikiProfiles(); err != nil {
+		log.Fatalf("Invalid wiki profiles: %v", err)
+	}
 	if e.OWID_ROD_BROWSER_DIR != "" {
 		launcher.DefaultBrowserDir = e.OWID_ROD_BROWSER_DIR // "/workspace/.cache/rod/browser"
 	}
 
+	// Tasks that were processing when the server stopped resume from their checkpoints
+	tasks, err := models.RequeueInterruptedTasks()
+	if err != nil {
+		fmt.Println("Error requeueing interrupted tasks", err)
+	} else if len(*tasks) > 0 {
+		fmt.Println("Requeued interrupted tasks", len(*tasks))
+	}
+
 	go func() {
 		monitorStalledTasks()
 	}()
 
 	go func() {
-		monitorQueuedTasks()
+		monitorChartChanges(e.OWID_WATCH_HOURS)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	taskScheduler := scheduler.New(e.OWID_WORKER_SLOTS, e.OWID_USER_TASK_LIMIT)
+	go func() {
+		taskScheduler.Run(ctx)
+	}()
+
+	go func() {
+		taskScheduler.RunSchedules(ctx)
 	}()
 
 	// Download browser if not available
@@ -43,9 +71,38 @@ func main() {
 	fmt.Println("launcher ", r, err)
 
 	router := routes.BuildRoutes()
-	err = router.Run(":8000")
-	if err != nil {
-		log.Fatalf("Failed to run router: %v", err)
+	server := &http.Server{
+		Addr:    ":8000",
+		Handler: router,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to run router: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	shutdown(server, taskScheduler, time.Second*time.Duration(e.OWID_SHUTDOWN_SECS))
+}
+
+// shutdown lets running tasks finish their current year and requeue themselves,
+// whatever is still running after timeout is requeued here and its browsers killed
+func shutdown(server *http.Server, taskScheduler *scheduler.Scheduler, timeout time.Duration) {
+	fmt.Println("Shutting down, waiting for running tasks")
+	if !taskScheduler.Wait(timeout) {
+		fmt.Println("Running tasks didn't stop in time, requeueing them")
+		services.CleanupBrowsers()
+		if _, err := models.RequeueInterruptedTasks(); err != nil {
+			fmt.Println("Error requeueing interrupted tasks", err)
+		}
+	}
+	services.CleanupBrowsers()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("Error shutting down server", err)
 	}
 }
 
@@ -54,75 +111,70 @@ func monitorStalledTasks() {
 		tasks, err := models.FindStalledTasks()
 		if tasks != nil && len(*tasks) > 0 {
 			fmt.Println("Found stalled tasks", len(*tasks), err)
-			for _, task := range *tasks {
-				task.Status = models.TaskStatusFailed
-				task.Update()
-				utils.SendWSTask(&task)
+			for i := range *tasks {
+				services.RequeueStalledTask(&(*tasks)[i])
 			}
 		}
 		time.Sleep(time.Second * 60)
 	}
 }
 
-func monitorQueuedTasks() {
+// monitorChartChanges checks watched charts for new data and queues a fresh run when they change
+func monitorChartChanges(intervalHours int) {
 	for {
-		time.Sleep(time.Second * 10)
-		count, err := models.FindProcessingTasksCount()
+		time.Sleep(time.Minute * 10)
+		checkedBefore := time.Now().Add(-time.Hour * time.Duration(intervalHours)).Unix()
+		fingerprints, err := models.FindChartFingerprintsToCheck(checkedBefore)
 		if err != nil {
-			fmt.Println("Error finding processing tasks count", err)
+			fmt.Println("Error finding charts to check", err)
 			continue
 		}
 
-		if count < 1 {
-			task, err := models.FindNextTaskToProcess()
+		for _, stored := range fingerprints {
+			current, err := services.FetchChartFingerprint(stored.ChartUrl)
 			if err != nil {
-				fmt.Println("Error finding next task to process", err)
+				fmt.Println("Error checking chart for changes", stored.ChartUrl, err)
+				stored.CheckedAt = time.Now().Unix()
+				stored.Save()
 				continue
-
 			}
-			if task == nil {
-				// fmt.Println("No next task to process")
+
+			current.TaskId = stored.TaskId
+			current.UserId = stored.UserId
+			current.ChangedAt = stored.ChangedAt
+			current.CreatedAt = stored.CreatedAt
+
+			if !services.ChartFingerprintChanged(&stored, current) {
+				current.Save()
 				continue
 			}
-			fmt.Println("Next task: ", task.URL, task.ID)
 
-			user, err := models.FindUserByID(task.UserId)
-			if err != nil {
-				fmt.Println("Error find next task's user", err)
+			fmt.Println("Chart changed: ", stored.ChartUrl, stored.EndYear, current.EndYear)
+			task, err := models.FindTaskById(stored.TaskId)
+			if err != nil || task == nil {
+				fmt.Println("Cannot find watched task", stored.TaskId, err)
+				continue
 			}
-			if user == nil {
-				fmt.Println("Can't find user for the task", task.ID)
+			if task.Status == models.TaskStatusQueued || task.Status == models.TaskStatusProcessing || task.Status == models.TaskStatusPaused {
+				// Will be picked up again once the current run is done
+				continue
 			}
-			if err != nil || user == nil {
-				// Fail the task to get the next
-				task.Status = models.TaskStatusFailed
-				task.Update()
-				utils.SendWSTask(task)
+
+			newTask, err := models.CloneTask(task)
+			if err != nil {
+				fmt.Println("Error queueing changed chart", stored.ChartUrl, err)
 				continue
 			}
 
-			go func() {
-				switch task.Type {
-				case models.TaskTypeMap:
-					fmt.Println("Action message map", task.URL)
-					err := services.StartMap(task.ID, user, services.StartData{
-						Url:                                  task.URL,
-						FileName:                             task.FileName,
-						Description:                          task.Description,
-						DescriptionOverwriteBehaviour:        task.DescriptionOverwriteBehaviour,
-						ImportCountries:                      task.ImportCountries == 1,
-						CountryFileName:                      task.CountryFileName,
-						CountryDescription:                   task.CountryDescription,
-						CountryDescriptionOverwriteBehaviour: task.CountryDescriptionOverwriteBehaviour,
-						GenerateTemplateCommons:              task.GenerateTemplateCommons == 1,
-						TemplateNameFormat:                   task.CommonsTemplateNameFormat,
-					})
-					if err != nil {
-						log.Println("Error starting map", err)
-					}
-				}
-			}()
-		}
+			// Keep the old hashes so a failed run gets detected again, a successful run refreshes them
+			stored.TaskId = newTask.ID
+			stored.CheckedAt = current.CheckedAt
+			stored.ChangedAt = current.CheckedAt
+			stored.Save()
 
+			utils.SendWSTask(newTask)
+			utils.SendWSQueuePositions()
+			utils.SendWSUserNotification(stored.UserId, fmt.Sprintf("%s changed on OWID, a new import was queued", stored.ChartUrl))
+		}
 	}
 }
@@ -0,0 +1,123 @@
+package mediawiki
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+)
+
+// uploadSessionMaxAge is how long a stashed chunk sequence is resumed, MediaWiki purges old stashed files
+const uploadSessionMaxAge = 6 * time.Hour
+
+// UploadChunked sends req.File to the upload stash in chunks of chunkSize bytes, then publishes it
+// under req.Filename. A sequence that failed part way is resumed on the next call for the same
+// user, file name and content
+func (c *Client) UploadChunked(ctx context.Context, req UploadRequest, chunkSize int) (*UploadResponse, error) {
+	hash := sha1.Sum(req.File)
+	session := c.findUploadSession(req.Filename, hex.EncodeToString(hash[:]))
+
+	resumed := session.FileKey != ""
+	err := c.sendChunks(ctx, req, session, chunkSize)
+	var apiErr *APIError
+	if err != nil && resumed && ctx.Err() == nil && errors.As(err, &apiErr) {
+		// The stash may have dropped the file since, start over
+		fmt.Println("Restarting chunked upload", req.Filename, err)
+		models.DeleteUploadSession(session.UserId, session.FileName, session.SHA1)
+		session.FileKey = ""
+		session.Offset = 0
+		err = c.sendChunks(ctx, req, session, chunkSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{
+		"action":   "upload",
+		"filename": req.Filename,
+		"filekey":  session.FileKey,
+		"text":     req.Text,
+		"comment":  req.Comment,
+	}
+	if req.IgnoreWarnings {
+		params["ignorewarnings"] = "1"
+	}
+
+	var res UploadResponse
+	err = c.withCSRFToken(ctx, func(token string) error {
+		params["token"] = token
+		return c.do(ctx, params, nil, &res)
+	})
+	if err == nil || errors.Is(err, ErrFileExistsNoChange) {
+		models.DeleteUploadSession(session.UserId, session.FileName, session.SHA1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.Upload.Result != UploadResultSuccess {
+		return &res, fmt.Errorf("upload failed: %s", res.Upload.Result)
+	}
+	return &res, nil
+}
+
+func (c *Client) findUploadSession(filename, sha1 string) *models.UploadSession {
+	session, err := models.FindUploadSession(c.userKey, filename, sha1)
+	if err == nil && time.Since(time.Unix(session.UpdatedAt, 0)) < uploadSessionMaxAge {
+		fmt.Println("Resuming chunked upload", filename, "at", session.Offset)
+		return session
+	}
+	return &models.UploadSession{UserId: c.userKey, FileName: filename, SHA1: sha1}
+}
+
+// sendChunks stashes the chunks of req.File from session.Offset on, the session is saved after every chunk
+func (c *Client) sendChunks(ctx context.Context, req UploadRequest, session *models.UploadSession, chunkSize int) error {
+	size := int64(len(req.File))
+	for session.FileKey == "" || session.Offset < size {
+		end := min(session.Offset+int64(chunkSize), size)
+		params := map[string]string{
+			"action":         "upload",
+			"stash":          "1",
+			"filename":       req.Filename,
+			"filesize":       strconv.FormatInt(size, 10),
+			"offset":         strconv.FormatInt(session.Offset, 10),
+			"ignorewarnings": "1",
+		}
+		if session.FileKey != "" {
+			params["filekey"] = session.FileKey
+		}
+
+		var res UploadResponse
+		chunk := &file{field: "chunk", name: req.Filename, mime: req.Mime, data: req.File[session.Offset:end]}
+		if err := c.withCSRFToken(ctx, func(token string) error {
+			params["token"] = token
+			return c.do(ctx, params, chunk, &res)
+		}); err != nil {
+			return err
+		}
+
+		if res.Upload.FileKey == "" {
+			return fmt.Errorf("chunk upload returned no file key")
+		}
+		switch res.Upload.Result {
+		case UploadResultContinue:
+			if res.Upload.Offset <= session.Offset {
+				return fmt.Errorf("chunk upload didn't advance past offset %d", session.Offset)
+			}
+			session.Offset = res.Upload.Offset
+		case UploadResultSuccess:
+			session.Offset = size
+		default:
+			return fmt.Errorf("chunk upload failed: %s", res.Upload.Result)
+		}
+		session.FileKey = res.Upload.FileKey
+		if err := models.SaveUploadSession(session); err != nil {
+			fmt.Println("Error saving upload session", session.FileName, err)
+		}
+	}
+	return nil
+}
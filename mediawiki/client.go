@@ -0,0 +1,208 @@
+package mediawiki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wpmed-videowiki/OWIDImporter/env"
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+	"github.com/wpmed-videowiki/OWIDImporter/utils"
+)
+
+const maxErrorBodyLength = 200
+
+// Client calls the MediaWiki action API on behalf of a user
+type Client struct {
+	apiURL  string
+	userKey string // Keys the user's tokens and upload sessions, per wiki profile
+	http    *http.Client
+	retry   RetryPolicy
+}
+
+// NewClient calls the wiki of user.WikiProfile, the default profile when it's empty
+func NewClient(user *models.User) *Client {
+	profile, ok := env.GetWikiProfile(user.WikiProfile)
+	if !ok {
+		// Left without an API url so requests fail instead of reaching another wiki
+		fmt.Println("Unknown wiki profile", user.WikiProfile)
+	}
+
+	userKey := user.ID
+	if profile.Name != env.DefaultWikiProfile {
+		userKey = user.ID + "@" + profile.Name
+	}
+
+	return &Client{
+		apiURL:  profile.MWApi,
+		userKey: userKey,
+		http:    utils.GetOAuthClient(user, profile),
+		retry:   DefaultRetryPolicy(),
+	}
+}
+
+// Warnings holds the warning text of each module that sent some, keyed by module name
+type Warnings map[string]struct {
+	Warnings string `json:"warnings"`
+}
+
+func (w Warnings) String() string {
+	parts := make([]string, 0, len(w))
+	for module, warning := range w {
+		parts = append(parts, module+": "+warning.Warnings)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Response holds the parts every API response can have, the typed responses embed it
+type Response struct {
+	Warnings Warnings `json:"warnings,omitempty"`
+}
+
+type envelope struct {
+	Error    *APIError `json:"error"`
+	Warnings Warnings  `json:"warnings"`
+}
+
+type file struct {
+	field string // Form field of the file, "file" when empty
+	name  string
+	mime  string
+	data  []byte
+}
+
+// do sends params to the API and decodes the response into result. Requests with a token or
+// a file are posted, the others are sent as GET. API errors are returned as *APIError, retryable
+// failures are sent again following the client's retry policy
+func (c *Client) do(ctx context.Context, params map[string]string, f *file, result interface{}) error {
+	write := isWrite(params, f)
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := c.doOnce(ctx, params, f, result)
+		if err == nil || ctx.Err() != nil || attempt > c.retry.MaxRetries || !isRetryable(err, write, retryAfter) {
+			return err
+		}
+
+		delay := c.retry.delay(attempt, retryAfter)
+		fmt.Println("Retrying MediaWiki API request", params["action"], attempt, "in", delay, err)
+		if hook := retryHookFromContext(ctx); hook != nil {
+			hook(attempt, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// doOnce sends a single request, along with the error it returns the wait the server asked for in Retry-After
+func (c *Client) doOnce(ctx context.Context, params map[string]string, f *file, result interface{}) (time.Duration, error) {
+	values := make(url.Values)
+	values.Set("format", "json")
+	values.Set("formatversion", "2")
+	if c.retry.MaxLag > 0 {
+		values.Set("maxlag", strconv.Itoa(c.retry.MaxLag))
+	}
+
+	var req *http.Request
+	var err error
+	if isWrite(params, f) {
+		var b bytes.Buffer
+		writer := multipart.NewWriter(&b)
+		if f != nil {
+			field := f.field
+			if field == "" {
+				field = "file"
+			}
+			fileWriter, err := writer.CreatePart(textproto.MIMEHeader{
+				"Content-Disposition": []string{fmt.Sprintf("form-data; name=\"%s\"; filename=\"%s\"", field, f.name)},
+				"Content-Type":        []string{f.mime},
+			})
+			if err != nil {
+				return 0, err
+			}
+			if _, err := fileWriter.Write(f.data); err != nil {
+				return 0, err
+			}
+		}
+		for k, v := range params {
+			writer.WriteField(k, v)
+		}
+		if err := writer.Close(); err != nil {
+			return 0, err
+		}
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+"?"+values.Encode(), &b)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+	} else {
+		for k, v := range params {
+			values.Set(k, v)
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+"?"+values.Encode(), nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	retryAfter := parseRetryAfter(res.Header.Get("Retry-After"))
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return retryAfter, err
+	}
+
+	var apiRes envelope
+	if err := json.Unmarshal(body, &apiRes); err != nil {
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return retryAfter, newHTTPError(res, body)
+		}
+		fmt.Println("Error unmarshalling api response", params["action"], err)
+		return 0, err
+	}
+	if len(apiRes.Warnings) > 0 {
+		fmt.Println("MediaWiki API warnings:", params["action"], apiRes.Warnings)
+	}
+	if apiRes.Error != nil {
+		return retryAfter, apiRes.Error
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return retryAfter, newHTTPError(res, body)
+	}
+
+	if result == nil {
+		return 0, nil
+	}
+	return 0, json.Unmarshal(body, result)
+}
+
+// isWrite tells if a request changes the wiki, only those carry a token or a file
+func isWrite(params map[string]string, f *file) bool {
+	return f != nil || params["token"] != ""
+}
+
+func newHTTPError(res *http.Response, body []byte) *HTTPError {
+	text := string(body)
+	if len(text) > maxErrorBodyLength {
+		text = text[:maxErrorBodyLength] + "..."
+	}
+	return &HTTPError{StatusCode: res.StatusCode, Status: res.Status, Body: text}
+}
@@ -0,0 +1,45 @@
+package mediawiki
+
+import (
+	"context"
+	"fmt"
+)
+
+type EditRequest struct {
+	Title   string
+	Text    string
+	Summary string
+}
+
+type EditResponse struct {
+	Response
+	Edit struct {
+		Result   string `json:"result"`
+		PageID   int    `json:"pageid"`
+		Title    string `json:"title"`
+		NoChange bool   `json:"nochange"`
+		NewRevID int    `json:"newrevid"`
+	} `json:"edit"`
+}
+
+const EditResultSuccess = "Success"
+
+// Edit replaces the content of the page req.Title, creating it when missing
+func (c *Client) Edit(ctx context.Context, req EditRequest) (*EditResponse, error) {
+	var res EditResponse
+	if err := c.withCSRFToken(ctx, func(token string) error {
+		return c.do(ctx, map[string]string{
+			"action":  "edit",
+			"title":   req.Title,
+			"text":    req.Text,
+			"summary": req.Summary,
+			"token":   token,
+		}, nil, &res)
+	}); err != nil {
+		return nil, err
+	}
+	if res.Edit.Result != EditResultSuccess {
+		return &res, fmt.Errorf("edit failed: %s", res.Edit.Result)
+	}
+	return &res, nil
+}
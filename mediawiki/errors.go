@@ -0,0 +1,59 @@
+package mediawiki
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors the API errors are mapped to, check them with errors.Is
+var (
+	ErrBadToken           = errors.New("badtoken")
+	ErrRateLimited        = errors.New("ratelimited")
+	ErrMaxLag             = errors.New("maxlag")
+	ErrFileExistsNoChange = errors.New("fileexists-no-change")
+	ErrProtectedPage      = errors.New("protectedpage")
+	ErrAbuseFilter        = errors.New("abusefilter")
+)
+
+var codeErrors = map[string]error{
+	"badtoken":             ErrBadToken,
+	"notoken":              ErrBadToken,
+	"ratelimited":          ErrRateLimited,
+	"maxlag":               ErrMaxLag,
+	"fileexists-no-change": ErrFileExistsNoChange,
+	"protectedpage":        ErrProtectedPage,
+	"protectedtitle":       ErrProtectedPage,
+	"protectednamespace":   ErrProtectedPage,
+	"cascadeprotected":     ErrProtectedPage,
+}
+
+// APIError is the error object of a failed API response
+type APIError struct {
+	Code   string  `json:"code"`
+	Info   string  `json:"info"`
+	DocRef string  `json:"docref,omitempty"`
+	Lag    float64 `json:"lag,omitempty"` // Seconds the replicas are behind, maxlag errors only
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Info)
+}
+
+func (e *APIError) Is(target error) bool {
+	if strings.HasPrefix(e.Code, "abusefilter-") {
+		return target == ErrAbuseFilter
+	}
+	return codeErrors[e.Code] == target
+}
+
+// HTTPError is returned for responses with a non 2xx status that carry no API error
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("mediawiki api returned %s", e.Status)
+}
@@ -0,0 +1,37 @@
+package mediawiki
+
+import (
+	"context"
+)
+
+type MoveRequest struct {
+	From   string
+	To     string
+	Reason string
+}
+
+type MoveResponse struct {
+	Response
+	Move struct {
+		From   string `json:"from"`
+		To     string `json:"to"`
+		Reason string `json:"reason"`
+	} `json:"move"`
+}
+
+// Move renames the page req.From to req.To
+func (c *Client) Move(ctx context.Context, req MoveRequest) (*MoveResponse, error) {
+	var res MoveResponse
+	if err := c.withCSRFToken(ctx, func(token string) error {
+		return c.do(ctx, map[string]string{
+			"action": "move",
+			"from":   req.From,
+			"to":     req.To,
+			"reason": req.Reason,
+			"token":  token,
+		}, nil, &res)
+	}); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
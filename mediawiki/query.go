@@ -0,0 +1,146 @@
+package mediawiki
+
+import (
+	"context"
+)
+
+type QueryResponse struct {
+	Response
+	BatchComplete bool `json:"batchcomplete"`
+	Query         struct {
+		Normalized []struct {
+			FromEncoded bool   `json:"fromencoded"`
+			From        string `json:"from"`
+			To          string `json:"to"`
+		} `json:"normalized"`
+		Pages     []Page  `json:"pages"`
+		AllImages []Image `json:"allimages"`
+		UserInfo  struct {
+			Name string `json:"name"`
+			ID   int    `json:"id"`
+		} `json:"userinfo"`
+	} `json:"query"`
+}
+
+type Page struct {
+	PageID          int         `json:"pageid"`
+	NS              int         `json:"ns"`
+	Title           string      `json:"title"`
+	Missing         bool        `json:"missing"`
+	ImageRepository string      `json:"imagerepository"`
+	ImageInfo       []ImageInfo `json:"imageinfo"`
+	Revisions       []Revision  `json:"revisions,omitempty"`
+}
+
+type ImageInfo struct {
+	SHA1 string `json:"sha1"`
+	URL  string `json:"url"`
+}
+
+type Image struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+type Revision struct {
+	Slots map[string]ContentSlot `json:"slots"`
+}
+
+type ContentSlot struct {
+	ContentModel  string `json:"contentmodel"`
+	ContentFormat string `json:"contentformat"`
+	Content       string `json:"content"`
+}
+
+// Query runs a query action with params, action is set by Query
+func (c *Client) Query(ctx context.Context, params map[string]string) (*QueryResponse, error) {
+	query := map[string]string{"action": "query"}
+	for k, v := range params {
+		query[k] = v
+	}
+
+	var res QueryResponse
+	if err := c.do(ctx, query, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Username returns the name of the user the client acts for
+func (c *Client) Username(ctx context.Context) (string, error) {
+	res, err := c.Query(ctx, map[string]string{"meta": "userinfo"})
+	if err != nil {
+		return "", err
+	}
+	return res.Query.UserInfo.Name, nil
+}
+
+// ImageInfo returns the page of the file title with its sha1 and url, ImageInfo is empty when the file doesn't exist
+func (c *Client) ImageInfo(ctx context.Context, title string) (*Page, error) {
+	res, err := c.Query(ctx, map[string]string{
+		"prop":   "imageinfo",
+		"titles": title,
+		"iiprop": "sha1|url",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Query.Pages) == 0 {
+		return &Page{Title: title}, nil
+	}
+	return &res.Query.Pages[0], nil
+}
+
+// FindImagesBySHA1 returns the files whose content has the sha1 hash
+func (c *Client) FindImagesBySHA1(ctx context.Context, sha1 string) ([]Image, error) {
+	res, err := c.Query(ctx, map[string]string{
+		"list":   "allimages",
+		"aisha1": sha1,
+		"aiprop": "url|sha1|size",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Query.AllImages, nil
+}
+
+// SearchTitles returns the titles of the pages matching the search
+func (c *Client) SearchTitles(ctx context.Context, search string) ([]string, error) {
+	res, err := c.Query(ctx, map[string]string{
+		"redirects": "1",
+		"generator": "search",
+		"gsrsearch": search,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	titles := make([]string, 0, len(res.Query.Pages))
+	for _, page := range res.Query.Pages {
+		titles = append(titles, page.Title)
+	}
+	return titles, nil
+}
+
+// PageContent returns the wikitext of the latest revision of title, empty when the page doesn't exist
+func (c *Client) PageContent(ctx context.Context, title string) (string, error) {
+	res, err := c.Query(ctx, map[string]string{
+		"titles":  title,
+		"prop":    "revisions",
+		"rvprop":  "content",
+		"rvslots": "main",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, page := range res.Query.Pages {
+		if len(page.Revisions) > 0 {
+			if mainSlot, ok := page.Revisions[0].Slots["main"]; ok {
+				return mainSlot.Content, nil
+			}
+		}
+	}
+	return "", nil
+}
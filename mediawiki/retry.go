@@ -0,0 +1,107 @@
+package mediawiki
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wpmed-videowiki/OWIDImporter/env"
+)
+
+// maxRetryAfter caps the wait a Retry-After header can ask for
+const maxRetryAfter = 5 * time.Minute
+
+// RetryPolicy says how often and how long to wait before sending a failed request again
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration // Delay before the first retry, doubled on every retry after it
+	MaxDelay   time.Duration
+	MaxLag     int // Seconds of replication lag the servers may have before refusing the request, 0 to not send maxlag
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	envData := env.GetEnv()
+	return RetryPolicy{
+		MaxRetries: envData.OWID_MW_MAX_RETRIES,
+		BaseDelay:  2 * time.Second,
+		MaxDelay:   time.Minute,
+		MaxLag:     envData.OWID_MW_MAXLAG,
+	}
+}
+
+// delay returns the wait before the retry numbered attempt, retryAfter is the server's hint and wins when set
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, maxRetryAfter)
+	}
+
+	backoff := p.BaseDelay << (attempt - 1)
+	if backoff <= 0 || backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+	// Half fixed, half random so requests failing together don't retry together
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// isRetryable reports whether a request failing with err may succeed when sent again. A write is only
+// sent again when the server refused it, a lost or failed response may follow an upload or edit that went through
+func isRetryable(err error, write bool, retryAfter time.Duration) bool {
+	if errors.Is(err, ErrMaxLag) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == "readonly"
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			// Unless the server asks to come back later the backend may have saved the write
+			return !write || retryAfter > 0
+		}
+		return false
+	}
+	if write {
+		return false
+	}
+
+	// Network errors, the response never arrived or was cut off
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+type retryHookKey struct{}
+
+// WithRetryHook returns a context whose requests call hook before each retry, attempt starts at 1
+func WithRetryHook(ctx context.Context, hook func(attempt int, err error)) context.Context {
+	return context.WithValue(ctx, retryHookKey{}, hook)
+}
+
+func retryHookFromContext(ctx context.Context) func(attempt int, err error) {
+	hook, _ := ctx.Value(retryHookKey{}).(func(attempt int, err error))
+	return hook
+}
@@ -0,0 +1,88 @@
+package mediawiki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWritesAreOnlyRetriedWhenRefused(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   map[string]string
+		respond  func(w http.ResponseWriter)
+		requests int32
+	}{
+		{
+			name:     "read cut off",
+			params:   map[string]string{"action": "query"},
+			respond:  cutOff,
+			requests: 3,
+		},
+		{
+			name:     "write cut off",
+			params:   map[string]string{"action": "edit", "token": "token"},
+			respond:  cutOff,
+			requests: 1,
+		},
+		{
+			name:   "write behind a failing gateway",
+			params: map[string]string{"action": "edit", "token": "token"},
+			respond: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			requests: 1,
+		},
+		{
+			name:   "write rate limited",
+			params: map[string]string{"action": "edit", "token": "token"},
+			respond: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			requests: 3,
+		},
+		{
+			name:   "write refused for lag",
+			params: map[string]string{"action": "edit", "token": "token"},
+			respond: func(w http.ResponseWriter) {
+				w.Write([]byte(`{"error":{"code":"maxlag","info":"Waiting for a database server"}}`))
+			},
+			requests: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				test.respond(w)
+			}))
+			defer server.Close()
+
+			client := &Client{
+				apiURL: server.URL,
+				http:   server.Client(),
+				retry:  RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			}
+			if err := client.do(context.Background(), test.params, nil, nil); err == nil {
+				t.Fatal("expected the request to fail")
+			}
+			if got := requests.Load(); got != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, got)
+			}
+		})
+	}
+}
+
+// cutOff drops the connection without a response
+func cutOff(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	conn.Close()
+}
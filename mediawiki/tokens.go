@@ -0,0 +1,98 @@
+package mediawiki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type TokensResponse struct {
+	Response
+	Query struct {
+		Tokens struct {
+			CsrfToken string `json:"csrftoken"`
+		} `json:"tokens"`
+	} `json:"query"`
+}
+
+// userToken is the cached CSRF token of a user, the lock is held while fetching so concurrent
+// workers of the user wait for one fetch instead of sending their own
+type userToken struct {
+	sync.Mutex
+	token string
+}
+
+// csrfTokens caches the CSRF token of each user, keyed by user id. A token stays valid for
+// the user's session, so it's only fetched again once the API rejects it
+var csrfTokens = struct {
+	sync.Mutex
+	byUser map[string]*userToken
+}{byUser: make(map[string]*userToken)}
+
+func (c *Client) userToken() *userToken {
+	csrfTokens.Lock()
+	defer csrfTokens.Unlock()
+	cached, ok := csrfTokens.byUser[c.userKey]
+	if !ok {
+		cached = &userToken{}
+		csrfTokens.byUser[c.userKey] = cached
+	}
+	return cached
+}
+
+// CSRFToken returns the edit token of the client's user, fetching it when it isn't cached
+func (c *Client) CSRFToken(ctx context.Context) (string, error) {
+	cached := c.userToken()
+	cached.Lock()
+	defer cached.Unlock()
+	if cached.token != "" {
+		return cached.token, nil
+	}
+
+	var res TokensResponse
+	if err := c.do(ctx, map[string]string{
+		"action": "query",
+		"meta":   "tokens",
+	}, nil, &res); err != nil {
+		return "", err
+	}
+	if res.Query.Tokens.CsrfToken == "" {
+		return "", fmt.Errorf("no csrf token returned")
+	}
+
+	cached.token = res.Query.Tokens.CsrfToken
+	return cached.token, nil
+}
+
+// invalidateCSRFToken drops token from the cache, unless another request already replaced it
+func (c *Client) invalidateCSRFToken(token string) {
+	cached := c.userToken()
+	cached.Lock()
+	defer cached.Unlock()
+	if cached.token == token {
+		cached.token = ""
+	}
+}
+
+// withCSRFToken calls send with the user's edit token. When the API rejects the token
+// a fresh one is fetched and send is called once more
+func (c *Client) withCSRFToken(ctx context.Context, send func(token string) error) error {
+	token, err := c.CSRFToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = send(token)
+	if !errors.Is(err, ErrBadToken) {
+		return err
+	}
+
+	fmt.Println("Edit token rejected, fetching a new one")
+	c.invalidateCSRFToken(token)
+	token, err = c.CSRFToken(ctx)
+	if err != nil {
+		return err
+	}
+	return send(token)
+}
@@ -0,0 +1,72 @@
+package mediawiki
+
+import (
+	"context"
+	"fmt"
+)
+
+type UploadRequest struct {
+	Filename       string
+	Text           string // Description page wikitext, used for new files
+	Comment        string
+	File           []byte
+	Mime           string
+	IgnoreWarnings bool
+}
+
+type UploadResponse struct {
+	Response
+	Upload struct {
+		Result   string `json:"result"`
+		Filename string `json:"filename"`
+		FileKey  string `json:"filekey"` // Stash key of stashed and chunked uploads
+		Offset   int64  `json:"offset"`  // Bytes received so far of a chunked upload
+		Warnings struct {
+			Duplicate []string `json:"duplicate"`
+			Exists    string   `json:"exists"`
+		} `json:"warnings"`
+		ImageInfo struct {
+			Timestamp      string `json:"timestamp"`
+			User           string `json:"user"`
+			Size           int    `json:"size"`
+			Width          int    `json:"width"`
+			Height         int    `json:"height"`
+			Comment        string `json:"comment"`
+			CanonicalTitle string `json:"canonicaltitle"`
+			URL            string `json:"url"`
+			DescriptionURL string `json:"descriptionurl"`
+			SHA1           string `json:"sha1"`
+			Mime           string `json:"mime"`
+		} `json:"imageinfo"`
+	} `json:"upload"`
+}
+
+const (
+	UploadResultSuccess  = "Success"
+	UploadResultContinue = "Continue" // More chunks of a chunked upload are expected
+)
+
+// Upload uploads the file of req, a response without a Success result is returned along with an error
+func (c *Client) Upload(ctx context.Context, req UploadRequest) (*UploadResponse, error) {
+	params := map[string]string{
+		"action":   "upload",
+		"filename": req.Filename,
+		"text":     req.Text,
+		"comment":  req.Comment,
+	}
+	if req.IgnoreWarnings {
+		params["ignorewarnings"] = "1"
+	}
+
+	var res UploadResponse
+	if err := c.withCSRFToken(ctx, func(token string) error {
+		params["token"] = token
+		return c.do(ctx, params, &file{name: req.Filename, mime: req.Mime, data: req.File}, &res)
+	}); err != nil {
+		return nil, err
+	}
+	if res.Upload.Result != UploadResultSuccess {
+		return &res, fmt.Errorf("upload failed: %s", res.Upload.Result)
+	}
+	return &res, nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// CategoryFileNames maps an entity category (aggregate, income_group, subnational) to the
+// file name template its charts are uploaded under. Entities of those categories are only
+// imported when their category has a template
+type CategoryFileNames map[string]string
+
+func (c *CategoryFileNames) Scan(value interface{}) error {
+	*c = nil
+	var str string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		return fmt.Errorf("unsupported category file names value %T", value)
+	}
+	if str == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(str), c)
+}
+
+func (c CategoryFileNames) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// ChartFingerprint is the last seen state of an OWID chart watched by a user, ChartUrl includes the chart parameters.
+// Users watch charts separately, a fingerprint is keyed by ChartUrl and UserId
+type ChartFingerprint struct {
+	ChartUrl   string `json:"chartUrl"`
+	TaskId     string `json:"taskId"`
+	UserId     string `json:"userId"`
+	ConfigHash string `json:"configHash"`
+	DataHash   string `json:"dataHash"`
+	EndYear    string `json:"endYear"`
+	CheckedAt  int64  `json:"checkedAt"`
+	ChangedAt  int64  `json:"changedAt"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+func initChartFingerprintTable() {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS chart_fingerprint (
+		chart_url TEXT NOT NULL,
+		task_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		config_hash TEXT,
+		data_hash TEXT,
+		end_year TEXT,
+		checked_at BIGINT,
+		changed_at BIGINT,
+		created_at BIGINT,
+		PRIMARY KEY (chart_url, user_id),
+		FOREIGN KEY (task_id) REFERENCES task(id)
+	);`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrateChartFingerprintPrimaryKey()
+}
+
+// migrateChartFingerprintPrimaryKey rebuilds tables created when chart_url alone was the primary key,
+// SQLite can't change the primary key of an existing table
+func migrateChartFingerprintPrimaryKey() {
+	var userIdPk int
+	err := db.QueryRow("SELECT pk FROM pragma_table_info('chart_fingerprint') WHERE name='user_id'").Scan(&userIdPk)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if userIdPk > 0 {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, statement := range []string{
+		"ALTER TABLE chart_fingerprint RENAME TO chart_fingerprint_old",
+		`CREATE TABLE chart_fingerprint (
+			chart_url TEXT NOT NULL,
+			task_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			config_hash TEXT,
+			data_hash TEXT,
+			end_year TEXT,
+			checked_at BIGINT,
+			changed_at BIGINT,
+			created_at BIGINT,
+			PRIMARY KEY (chart_url, user_id),
+			FOREIGN KEY (task_id) REFERENCES task(id)
+		)`,
+		"INSERT INTO chart_fingerprint SELECT chart_url, task_id, user_id, config_hash, data_hash, end_year, checked_at, changed_at, created_at FROM chart_fingerprint_old",
+		"DROP TABLE chart_fingerprint_old",
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			log.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Save inserts the fingerprint or replaces the stored one for the same chart url and user
+func (fingerprint *ChartFingerprint) Save() error {
+	if fingerprint.CreatedAt == 0 {
+		fingerprint.CreatedAt = time.Now().Unix()
+	}
+
+	stmt, err := db.Prepare("INSERT OR REPLACE INTO chart_fingerprint (chart_url, task_id, user_id, config_hash, data_hash, end_year, checked_at, changed_at, created_at) VALUES (?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(fingerprint.ChartUrl, fingerprint.TaskId, fingerprint.UserId, fingerprint.ConfigHash, fingerprint.DataHash, fingerprint.EndYear, fingerprint.CheckedAt, fingerprint.ChangedAt, fingerprint.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteChartFingerprint stops userId's watch of the chart, other users watching it keep theirs
+func DeleteChartFingerprint(chartUrl, userId string) error {
+	stmt, err := db.Prepare("DELETE FROM chart_fingerprint WHERE chart_url=? AND user_id=?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(chartUrl, userId)
+	return err
+}
+
+func FindChartFingerprint(chartUrl, userId string) (*ChartFingerprint, error) {
+	var fingerprint ChartFingerprint
+	err := db.QueryRow("SELECT chart_url, task_id, user_id, config_hash, data_hash, end_year, checked_at, changed_at, created_at FROM chart_fingerprint WHERE chart_url=? AND user_id=?", chartUrl, userId).
+		Scan(&fingerprint.ChartUrl, &fingerprint.TaskId, &fingerprint.UserId, &fingerprint.ConfigHash, &fingerprint.DataHash, &fingerprint.EndYear, &fingerprint.CheckedAt, &fingerprint.ChangedAt, &fingerprint.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fingerprint, nil
+}
+
+// FindChartFingerprintsToCheck returns the fingerprints that weren't checked since checkedBefore
+func FindChartFingerprintsToCheck(checkedBefore int64) ([]ChartFingerprint, error) {
+	fingerprints := make([]ChartFingerprint, 0)
+
+	rows, err := db.Query("SELECT chart_url, task_id, user_id, config_hash, data_hash, end_year, checked_at, changed_at, created_at FROM chart_fingerprint WHERE checked_at <= ? ORDER BY checked_at ASC", checkedBefore)
+	if err != nil {
+		fmt.Println("Error scaning chart fingerprints ", err)
+		return fingerprints, fmt.Errorf("Cannot find requested records")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fingerprint ChartFingerprint
+		err := rows.Scan(&fingerprint.ChartUrl, &fingerprint.TaskId, &fingerprint.UserId, &fingerprint.ConfigHash, &fingerprint.DataHash, &fingerprint.EndYear, &fingerprint.CheckedAt, &fingerprint.ChangedAt, &fingerprint.CreatedAt)
+		if err != nil {
+			fmt.Println("Error parsing chart fingerprint", err)
+		} else {
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+
+	return fingerprints, nil
+}
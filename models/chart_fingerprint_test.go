@@ -0,0 +1,95 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChartFingerprintsAreKeptPerUser(t *testing.T) {
+	const chartUrl = "https://ourworldindata.org/grapher/per-user"
+	defer db.Exec("DELETE FROM chart_fingerprint WHERE chart_url=?", chartUrl)
+
+	taskIds := map[string]string{}
+	for _, userId := range []string{"user-a", "user-b"} {
+		task, err := NewTask(NewTaskOptions{UserId: userId, URL: chartUrl, Status: TaskStatusDone, Type: TaskTypeChart})
+		if err != nil {
+			t.Fatal(err)
+		}
+		taskIds[userId] = task.ID
+		fingerprint := ChartFingerprint{ChartUrl: chartUrl, TaskId: task.ID, UserId: userId, DataHash: "hash-" + userId}
+		if err := fingerprint.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, userId := range []string{"user-a", "user-b"} {
+		fingerprint, err := FindChartFingerprint(chartUrl, userId)
+		if err != nil {
+			t.Fatalf("watch of %s was overwritten: %v", userId, err)
+		}
+		if fingerprint.TaskId != taskIds[userId] || fingerprint.DataHash != "hash-"+userId {
+			t.Errorf("unexpected fingerprint for %s: %+v", userId, fingerprint)
+		}
+	}
+
+	if err := DeleteChartFingerprint(chartUrl, "user-a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindChartFingerprint(chartUrl, "user-a"); err == nil {
+		t.Error("expected the watch of user-a to be deleted")
+	}
+	if _, err := FindChartFingerprint(chartUrl, "user-b"); err != nil {
+		t.Errorf("deleting user-a's watch removed user-b's: %v", err)
+	}
+}
+
+func TestMigrateChartFingerprintPrimaryKey(t *testing.T) {
+	defer func() {
+		db.Exec("DROP TABLE IF EXISTS chart_fingerprint")
+		initChartFingerprintTable()
+	}()
+
+	task, err := NewTask(NewTaskOptions{UserId: "user-old", URL: "https://ourworldindata.org/grapher/old", Status: TaskStatusDone, Type: TaskTypeChart})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, statement := range []string{
+		"DROP TABLE chart_fingerprint",
+		`CREATE TABLE chart_fingerprint (
+			chart_url TEXT PRIMARY KEY,
+			task_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			config_hash TEXT,
+			data_hash TEXT,
+			end_year TEXT,
+			checked_at BIGINT,
+			changed_at BIGINT,
+			created_at BIGINT
+		)`,
+		"INSERT INTO chart_fingerprint VALUES ('https://ourworldindata.org/grapher/old', ?, 'user-old', 'config-old', 'hash-old', '2020', 1, 1, 1)",
+	} {
+		var args []interface{}
+		if strings.HasPrefix(statement, "INSERT") {
+			args = append(args, task.ID)
+		}
+		if _, err := db.Exec(statement, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	initChartFingerprintTable()
+
+	fingerprint, err := FindChartFingerprint("https://ourworldindata.org/grapher/old", "user-old")
+	if err != nil || fingerprint.DataHash != "hash-old" {
+		t.Fatalf("existing watch not migrated: %+v %v", fingerprint, err)
+	}
+
+	other := ChartFingerprint{ChartUrl: "https://ourworldindata.org/grapher/old", TaskId: task.ID, UserId: "user-new"}
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindChartFingerprint("https://ourworldindata.org/grapher/old", "user-old"); err != nil {
+		t.Errorf("a second user's watch replaced the migrated one: %v", err)
+	}
+}
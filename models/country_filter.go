@@ -0,0 +1,45 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// CountryFilter limits the countries imported for a task. The lists hold country codes
+// or preset names such as EU27, an empty Include keeps every country
+type CountryFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+func (f *CountryFilter) Scan(value interface{}) error {
+	*f = CountryFilter{}
+	var str string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		return fmt.Errorf("unsupported country filter value %T", value)
+	}
+	if str == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(str), f)
+}
+
+func (f CountryFilter) Value() (driver.Value, error) {
+	if f.IsEmpty() {
+		return "", nil
+	}
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+func (f CountryFilter) IsEmpty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
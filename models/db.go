@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 )
 
@@ -22,6 +23,50 @@ func Init() {
 	}
 
 	initUserTable()
+	initUserWikiTokenTable()
 	initTaskTable()
 	initTaskProcessTable()
+	initTaskScheduleTable()
+	initChartFingerprintTable()
+	initTaskCheckpointTable()
+	initTaskUnmatchedEntityTable()
+	initUploadSessionTable()
+}
+
+// addColumnIfNotExists adds a column to an already created table, tables
+// created before the column existed won't pick it up from CREATE TABLE IF NOT EXISTS
+func addColumnIfNotExists(table, column, definition string) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exists := false
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			log.Fatal(err)
+		}
+		if name == column {
+			exists = true
+		}
+	}
+	rows.Close()
+
+	if exists {
+		return
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain runs the tests against a fresh database in a temporary directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "owid-models-test")
+	if err != nil {
+		panic(err)
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	Init()
+
+	code := m.Run()
+
+	db.Close()
+	os.Chdir(wd)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// RegionList is the set of map regions a task imports, e.g. World, Africa.
+// It's stored comma separated, an empty list imports the default regions
+type RegionList []string
+
+func (l *RegionList) Scan(value interface{}) error {
+	*l = nil
+	var str string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		return fmt.Errorf("unsupported region list value %T", value)
+	}
+	if str == "" {
+		return nil
+	}
+	*l = strings.Split(str, ",")
+	return nil
+}
+
+func (l RegionList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
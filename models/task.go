@@ -9,11 +9,14 @@ import (
 
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/wpmed-videowiki/OWIDImporter/env"
 )
 
 type (
 	TaskStatus                    string
 	TaskType                      string
+	TaskImportMode                string
+	TaskDestination               string
 	DescriptionOverwriteBehaviour string
 )
 
@@ -26,6 +29,7 @@ const (
 	TaskStatusOverwritten TaskStatus = "overwritten"
 	TaskStatusFailed      TaskStatus = "failed"
 	TaskStatusCancelled   TaskStatus = "cancelled"
+	TaskStatusPaused      TaskStatus = "paused"
 )
 
 const (
@@ -33,6 +37,25 @@ const (
 	TaskTypeChart TaskType = "chart"
 )
 
+// TaskImportModeBrowser steps through every year of a map in the browser,
+// TaskImportModeData only captures a base map per region and colors the years from the chart data
+const (
+	TaskImportModeBrowser TaskImportMode = "browser"
+	TaskImportModeData    TaskImportMode = "data"
+)
+
+// TaskDestinationCommons uploads the files to Commons,
+// TaskDestinationLocal writes them to a directory on the server that is archived once the task is done
+const (
+	TaskDestinationCommons TaskDestination = "commons"
+	TaskDestinationLocal   TaskDestination = "local"
+)
+
+const (
+	TaskPriorityMin = -10
+	TaskPriorityMax = 10
+)
+
 const (
 	DescriptionOverwriteBehaviourAll              = "all"
 	DescriptionOverwriteBehaviourExceptCategories = "all_except_categories"
@@ -60,6 +83,19 @@ type Task struct {
 	Type                                 TaskType                      `json:"type"`
 	ChartParameters                      string                        `json:"chartParameters"`
 	LastOperationAt                      int64                         `json:"lastOperationAt"`
+	StartedAt                            int64                         `json:"startedAt"`
+	Priority                             int                           `json:"priority"`
+	CancelledAt                          string                        `json:"cancelledAt"` // region/date each region was at when cancelled
+	ImportMode                           TaskImportMode                `json:"importMode"`
+	TimeTolerance                        int                           `json:"timeTolerance"` // Years a value fills a country in data mode, -1 for the chart's
+	YearFilter                           YearFilter                    `json:"yearFilter"`
+	Regions                              RegionList                    `json:"regions"` // Map regions to import, the default ones when empty
+	CountryFilter                        CountryFilter                 `json:"countryFilter"`
+	CategoryFileNames                    CategoryFileNames             `json:"categoryFileNames"`
+	DryRun                               int                           `json:"dryRun"` // 0 for false, 1 for true
+	Destination                          TaskDestination               `json:"destination"`
+	WikiProfile                          string                        `json:"wikiProfile"`   // Wiki the task imports into, see env.GetWikiProfiles
+	QueuePosition                        int                           `json:"queuePosition"` // Not stored, 1 based position for queued tasks
 	CreatedAt                            int64                         `json:"createdAt"`
 }
 
@@ -72,29 +108,76 @@ func (t *Task) Value() (driver.Value, error) {
 	return string(b), err
 }
 
-func NewTask(userId, url, fileName, description string, descriptionOverwriteBehaviour DescriptionOverwriteBehaviour, chartName string, status TaskStatus, taskType TaskType, importCountries int, countryFileName, countryDescription string, countryDescriptionOverwriteBehaviour DescriptionOverwriteBehaviour, generateTemplateCommons int, chartParameters string, commonsTemplateNameFormat string) (*Task, error) {
+// NewTaskOptions are the settings of a new task, an empty ImportMode, Destination or WikiProfile takes its default
+type NewTaskOptions struct {
+	UserId                               string
+	URL                                  string
+	FileName                             string
+	Description                          string
+	DescriptionOverwriteBehaviour        DescriptionOverwriteBehaviour
+	ChartName                            string
+	Status                               TaskStatus
+	Type                                 TaskType
+	ImportCountries                      int // 0 for false, 1 for true
+	CountryFileName                      string
+	CountryDescription                   string
+	CountryDescriptionOverwriteBehaviour DescriptionOverwriteBehaviour
+	GenerateTemplateCommons              int // 0 for false, 1 for true
+	ChartParameters                      string
+	CommonsTemplateNameFormat            string
+	ImportMode                           TaskImportMode
+	TimeTolerance                        int
+	YearFilter                           YearFilter
+	Regions                              RegionList
+	CountryFilter                        CountryFilter
+	CategoryFileNames                    CategoryFileNames
+	DryRun                               int // 0 for false, 1 for true
+	Destination                          TaskDestination
+	WikiProfile                          string
+}
+
+func NewTask(options NewTaskOptions) (*Task, error) {
+	if options.ImportMode == "" {
+		options.ImportMode = TaskImportModeBrowser
+	}
+	if options.Destination == "" {
+		options.Destination = TaskDestinationCommons
+	}
+	if options.WikiProfile == "" {
+		options.WikiProfile = env.DefaultWikiProfile
+	}
+
 	task := Task{
 		ID:                                   uuid.New().String(),
-		UserId:                               userId,
-		URL:                                  url,
-		FileName:                             fileName,
-		Description:                          description,
-		ChartName:                            chartName,
-		DescriptionOverwriteBehaviour:        descriptionOverwriteBehaviour,
-		Status:                               status,
-		Type:                                 taskType,
-		ImportCountries:                      importCountries,
-		GenerateTemplateCommons:              generateTemplateCommons,
-		CountryFileName:                      countryFileName,
-		CountryDescription:                   countryDescription,
-		CountryDescriptionOverwriteBehaviour: countryDescriptionOverwriteBehaviour,
+		UserId:                               options.UserId,
+		URL:                                  options.URL,
+		FileName:                             options.FileName,
+		Description:                          options.Description,
+		ChartName:                            options.ChartName,
+		DescriptionOverwriteBehaviour:        options.DescriptionOverwriteBehaviour,
+		Status:                               options.Status,
+		Type:                                 options.Type,
+		ImportCountries:                      options.ImportCountries,
+		GenerateTemplateCommons:              options.GenerateTemplateCommons,
+		CountryFileName:                      options.CountryFileName,
+		CountryDescription:                   options.CountryDescription,
+		CountryDescriptionOverwriteBehaviour: options.CountryDescriptionOverwriteBehaviour,
 		CommonsTemplateName:                  "",
-		CommonsTemplateNameFormat:            commonsTemplateNameFormat,
-		ChartParameters:                      chartParameters,
+		CommonsTemplateNameFormat:            options.CommonsTemplateNameFormat,
+		ChartParameters:                      options.ChartParameters,
+		ImportMode:                           options.ImportMode,
+		TimeTolerance:                        options.TimeTolerance,
+		YearFilter:                           options.YearFilter,
+		Regions:                              options.Regions,
+		CountryFilter:                        options.CountryFilter,
+		CategoryFileNames:                    options.CategoryFileNames,
+		DryRun:                               options.DryRun,
+		Destination:                          options.Destination,
+		WikiProfile:                          options.WikiProfile,
 		LastOperationAt:                      time.Now().Unix(),
 		CreatedAt:                            time.Now().Unix(),
 	}
-	stmt, err := db.Prepare("INSERT INTO task (id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, import_countries, country_file_name, country_description, country_description_overwrite_behaviour, generate_template_commons, commons_template_name, commons_template_name_format, chart_parameters, last_operation_at, created_at) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
+	stmt, err := db.Prepare("INSERT INTO task (id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, import_countries, country_file_name, country_description, country_description_overwrite_behaviour, generate_template_commons, commons_template_name, commons_template_name_format, chart_parameters, import_mode, time_tolerance, year_filter, regions, country_filter, category_file_names, dry_run, destination, wiki_profile, last_operation_at, created_at) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +201,15 @@ func NewTask(userId, url, fileName, description string, descriptionOverwriteBeha
 		task.CommonsTemplateName,
 		task.CommonsTemplateNameFormat,
 		task.ChartParameters,
+		task.ImportMode,
+		task.TimeTolerance,
+		task.YearFilter,
+		task.Regions,
+		task.CountryFilter,
+		task.CategoryFileNames,
+		task.DryRun,
+		task.Destination,
+		task.WikiProfile,
 		task.LastOperationAt,
 		task.CreatedAt,
 	)
@@ -129,14 +221,85 @@ func NewTask(userId, url, fileName, description string, descriptionOverwriteBeha
 	return &task, nil
 }
 
+// CloneTask queues a fresh run of task with the same import settings, the checkpoints of task
+// are cleared since the fresh run supersedes it
+func CloneTask(task *Task) (*Task, error) {
+	clone, err := NewTask(NewTaskOptions{
+		UserId:                               task.UserId,
+		URL:                                  task.URL,
+		FileName:                             task.FileName,
+		Description:                          task.Description,
+		DescriptionOverwriteBehaviour:        task.DescriptionOverwriteBehaviour,
+		ChartName:                            task.ChartName,
+		Status:                               TaskStatusQueued,
+		Type:                                 task.Type,
+		ImportCountries:                      task.ImportCountries,
+		CountryFileName:                      task.CountryFileName,
+		CountryDescription:                   task.CountryDescription,
+		CountryDescriptionOverwriteBehaviour: task.CountryDescriptionOverwriteBehaviour,
+		GenerateTemplateCommons:              task.GenerateTemplateCommons,
+		ChartParameters:                      task.ChartParameters,
+		CommonsTemplateNameFormat:            task.CommonsTemplateNameFormat,
+		ImportMode:                           task.ImportMode,
+		TimeTolerance:                        task.TimeTolerance,
+		YearFilter:                           task.YearFilter,
+		Regions:                              task.Regions,
+		CountryFilter:                        task.CountryFilter,
+		CategoryFileNames:                    task.CategoryFileNames,
+		DryRun:                               task.DryRun,
+		Destination:                          task.Destination,
+		WikiProfile:                          task.WikiProfile,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := DeleteTaskCheckpoints(task.ID); err != nil {
+		fmt.Println("Error deleting checkpoints of cloned task", task.ID, err)
+	}
+
+	return clone, nil
+}
+
+// Update saves every column of taskColumns but the id, owner and creation time
 func (task *Task) Update() error {
-	stmt, err := db.Prepare("UPDATE task SET url=?, file_name=?, description=?, description_overwrite_behaviour=?, status=?, import_countries=?, chart_name=?, commons_template_name=?, last_operation_at=?, archived=? WHERE id=?")
+	stmt, err := db.Prepare("UPDATE task SET url=?, file_name=?, description=?, description_overwrite_behaviour=?, chart_name=?, status=?, type=?, import_countries=?, archived=?, country_file_name=?, country_description=?, country_description_overwrite_behaviour=?, generate_template_commons=?, commons_template_name=?, commons_template_name_format=?, chart_parameters=?, last_operation_at=?, started_at=?, priority=?, cancelled_at=?, import_mode=?, time_tolerance=?, year_filter=?, regions=?, country_filter=?, category_file_names=?, dry_run=?, destination=?, wiki_profile=? WHERE id=?")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(task.URL, task.FileName, task.Description, task.DescriptionOverwriteBehaviour, task.Status, task.ImportCountries, task.ChartName, task.CommonsTemplateName, task.LastOperationAt, task.Archived, task.ID)
+	_, err = stmt.Exec(
+		task.URL,
+		task.FileName,
+		task.Description,
+		task.DescriptionOverwriteBehaviour,
+		task.ChartName,
+		task.Status,
+		task.Type,
+		task.ImportCountries,
+		task.Archived,
+		task.CountryFileName,
+		task.CountryDescription,
+		task.CountryDescriptionOverwriteBehaviour,
+		task.GenerateTemplateCommons,
+		task.CommonsTemplateName,
+		task.CommonsTemplateNameFormat,
+		task.ChartParameters,
+		task.LastOperationAt,
+		task.StartedAt,
+		task.Priority,
+		task.CancelledAt,
+		task.ImportMode,
+		task.TimeTolerance,
+		task.YearFilter,
+		task.Regions,
+		task.CountryFilter,
+		task.CategoryFileNames,
+		task.DryRun,
+		task.Destination,
+		task.WikiProfile,
+		task.ID,
+	)
 	if err != nil {
 		return err
 	}
@@ -145,14 +308,12 @@ func (task *Task) Update() error {
 }
 
 func (task *Task) Reload() error {
-	err := db.QueryRow(
-		"SELECT id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, import_countries, generate_template_commons, commons_template_name, commons_template_name_format, chart_parameters, last_operation_at, created_at FROM task where id=?",
-		task.ID,
-	).Scan(&task.ID, &task.UserId, &task.URL, &task.FileName, &task.Description, &task.DescriptionOverwriteBehaviour, &task.ChartName, &task.Status, &task.Type, &task.ImportCountries, &task.GenerateTemplateCommons, &task.CommonsTemplateName, &task.CommonsTemplateNameFormat, &task.ChartParameters, &task.LastOperationAt, &task.CreatedAt)
+	reloaded, err := scanTask(db.QueryRow("SELECT "+taskColumns+" FROM task where id=?", task.ID))
 	if err != nil {
 		fmt.Println("Error reloading task for id: ", task.ID, err)
 		return fmt.Errorf("error reloading task: %w", err)
 	}
+	*task = *reloaded
 
 	return nil
 }
@@ -185,41 +346,69 @@ func UpdateTaskLastOperationAt(id string) error {
 	return nil
 }
 
-func FindTaskById(id string) (*Task, error) {
+// taskColumns are the columns scanTask reads, every query returning whole tasks selects them
+const taskColumns = "id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, import_countries, archived, country_file_name, country_description, country_description_overwrite_behaviour, generate_template_commons, commons_template_name, commons_template_name_format, chart_parameters, last_operation_at, started_at, priority, cancelled_at, import_mode, time_tolerance, year_filter, regions, country_filter, category_file_names, dry_run, destination, wiki_profile, created_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTask(row rowScanner) (*Task, error) {
 	var task Task
-	err := db.QueryRow("SELECT id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, import_countries, country_file_name, country_description, country_description_overwrite_behaviour, generate_template_commons, commons_template_name, commons_template_name_format, chart_parameters, last_operation_at, created_at FROM task where id=?", id).
-		Scan(&task.ID,
-			&task.UserId,
-			&task.URL,
-			&task.FileName,
-			&task.Description,
-			&task.DescriptionOverwriteBehaviour,
-			&task.ChartName,
-			&task.Status,
-			&task.Type,
-			&task.ImportCountries,
-			&task.CountryFileName,
-			&task.CountryDescription,
-			&task.CountryDescriptionOverwriteBehaviour,
-			&task.GenerateTemplateCommons,
-			&task.CommonsTemplateName,
-			&task.CommonsTemplateNameFormat,
-			&task.ChartParameters,
-			&task.LastOperationAt,
-			&task.CreatedAt,
-		)
+	err := row.Scan(
+		&task.ID,
+		&task.UserId,
+		&task.URL,
+		&task.FileName,
+		&task.Description,
+		&task.DescriptionOverwriteBehaviour,
+		&task.ChartName,
+		&task.Status,
+		&task.Type,
+		&task.ImportCountries,
+		&task.Archived,
+		&task.CountryFileName,
+		&task.CountryDescription,
+		&task.CountryDescriptionOverwriteBehaviour,
+		&task.GenerateTemplateCommons,
+		&task.CommonsTemplateName,
+		&task.CommonsTemplateNameFormat,
+		&task.ChartParameters,
+		&task.LastOperationAt,
+		&task.StartedAt,
+		&task.Priority,
+		&task.CancelledAt,
+		&task.ImportMode,
+		&task.TimeTolerance,
+		&task.YearFilter,
+		&task.Regions,
+		&task.CountryFilter,
+		&task.CategoryFileNames,
+		&task.DryRun,
+		&task.Destination,
+		&task.WikiProfile,
+		&task.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func FindTaskById(id string) (*Task, error) {
+	task, err := scanTask(db.QueryRow("SELECT "+taskColumns+" FROM task where id=?", id))
 	if err != nil {
 		println("Error scaning for id ", id, err)
 		return nil, fmt.Errorf("Cannot find requested record")
 	}
 
-	return &task, nil
+	return task, nil
 }
 
 func FindFailedTasksByUserId(id string) (*[]Task, error) {
 	tasks := make([]Task, 0)
 	condition := "user_id=? AND status=? AND archived=0"
-	rows, err := db.Query(fmt.Sprintf("SELECT id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, import_countries, archived, country_file_name, country_description, country_description_overwrite_behaviour, generate_template_commons, commons_template_name, commons_template_name_format, chart_parameters, last_operation_at, created_at FROM task WHERE %s ORDER BY created_at DESC", condition), id, TaskStatusFailed)
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM task WHERE %s ORDER BY created_at DESC", taskColumns, condition), id, TaskStatusFailed)
 	if err != nil {
 		fmt.Println("Error scaning for id ", id, err)
 		return nil, fmt.Errorf("Cannot find requested record")
@@ -227,30 +416,12 @@ func FindFailedTasksByUserId(id string) (*[]Task, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var task Task
-		rows.Scan(
-			&task.ID,
-			&task.UserId,
-			&task.URL,
-			&task.FileName,
-			&task.Description,
-			&task.DescriptionOverwriteBehaviour,
-			&task.ChartName,
-			&task.Status,
-			&task.Type,
-			&task.ImportCountries,
-			&task.Archived,
-			&task.CountryFileName,
-			&task.CountryDescription,
-			&task.CountryDescriptionOverwriteBehaviour,
-			&task.GenerateTemplateCommons,
-			&task.CommonsTemplateName,
-			&task.CommonsTemplateNameFormat,
-			&task.ChartParameters,
-			&task.LastOperationAt,
-			&task.CreatedAt,
-		)
-		tasks = append(tasks, task)
+		task, err := scanTask(rows)
+		if err != nil {
+			fmt.Println("Error scaning failed task ", err)
+			return nil, fmt.Errorf("Cannot find requested record")
+		}
+		tasks = append(tasks, *task)
 	}
 
 	return &tasks, nil
@@ -273,7 +444,7 @@ func FindTaskByUserId(id, taskType string, archived, skip, limit int, search, st
 	}
 
 	queryArgs := append(args, limit, skip)
-	rows, err := db.Query(fmt.Sprintf("SELECT id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, import_countries, archived, country_file_name, country_description, country_description_overwrite_behaviour, generate_template_commons, commons_template_name, commons_template_name_format, chart_parameters, last_operation_at, created_at FROM task WHERE %s ORDER BY created_at DESC LIMIT ? OFFSET ?", condition), queryArgs...)
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM task WHERE %s ORDER BY created_at DESC LIMIT ? OFFSET ?", taskColumns, condition), queryArgs...)
 	if err != nil {
 		fmt.Println("Error scaning for id ", id, err)
 		return nil, 0, fmt.Errorf("Cannot find requested record")
@@ -281,30 +452,12 @@ func FindTaskByUserId(id, taskType string, archived, skip, limit int, search, st
 	defer rows.Close()
 
 	for rows.Next() {
-		var task Task
-		rows.Scan(
-			&task.ID,
-			&task.UserId,
-			&task.URL,
-			&task.FileName,
-			&task.Description,
-			&task.DescriptionOverwriteBehaviour,
-			&task.ChartName,
-			&task.Status,
-			&task.Type,
-			&task.ImportCountries,
-			&task.Archived,
-			&task.CountryFileName,
-			&task.CountryDescription,
-			&task.CountryDescriptionOverwriteBehaviour,
-			&task.GenerateTemplateCommons,
-			&task.CommonsTemplateName,
-			&task.CommonsTemplateNameFormat,
-			&task.ChartParameters,
-			&task.LastOperationAt,
-			&task.CreatedAt,
-		)
-		tasks = append(tasks, task)
+		task, err := scanTask(rows)
+		if err != nil {
+			fmt.Println("Error scaning task ", err)
+			return nil, 0, fmt.Errorf("Cannot find requested record")
+		}
+		tasks = append(tasks, *task)
 	}
 
 	row := db.QueryRow(fmt.Sprintf("SELECT COUNT(id) as c FROM task WHERE %s", condition), args...)
@@ -316,20 +469,52 @@ func FindTaskByUserId(id, taskType string, archived, skip, limit int, search, st
 func FindStalledTasks() (*[]Task, error) {
 	tasks := make([]Task, 0)
 	timeThreshold := time.Now().Unix() - 60*5 // 5 Min threshold
-	rows, err := db.Query("SELECT id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, last_operation_at, created_at FROM task where status=? AND last_operation_at <= ?", TaskStatusProcessing, timeThreshold)
+	rows, err := db.Query("SELECT "+taskColumns+" FROM task where status=? AND last_operation_at <= ?", TaskStatusProcessing, timeThreshold)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			fmt.Println("Error scaning for stalled tasks: ", err)
+			return nil, fmt.Errorf("Cannot find requested record")
+		}
+		tasks = append(tasks, *task)
+	}
+
+	return &tasks, rows.Err()
+}
+
+// RequeueInterruptedTasks puts the tasks left processing by a previous run of
+// the server back in the queue, their unfinished task processes are failed so
+// they get retried while finished ones are kept
+func RequeueInterruptedTasks() (*[]Task, error) {
+	tasks := make([]Task, 0)
+	rows, err := db.Query("SELECT id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, last_operation_at, created_at FROM task where status=?", TaskStatusProcessing)
+	if err != nil {
+		return nil, err
+	}
+
 	for rows.Next() {
 		var task Task
-		rows.Scan(&task.ID, &task.UserId, &task.URL, &task.FileName, &task.Description, &task.DescriptionOverwriteBehaviour, &task.ChartName, &task.Status, &task.Type, &task.LastOperationAt, &task.CreatedAt)
+		if err := rows.Scan(&task.ID, &task.UserId, &task.URL, &task.FileName, &task.Description, &task.DescriptionOverwriteBehaviour, &task.ChartName, &task.Status, &task.Type, &task.LastOperationAt, &task.CreatedAt); err != nil {
+			fmt.Println("Error parsing interrupted task", err)
+			continue
+		}
 		tasks = append(tasks, task)
 	}
-	if err != nil {
-		println("Error scaning for stalled tasks: ", err)
-		return nil, fmt.Errorf("Cannot find requested record")
+	rows.Close()
+
+	for i := range tasks {
+		if err := FailProcessingTaskProcesses(tasks[i].ID); err != nil {
+			fmt.Println("Error failing interrupted task processes", tasks[i].ID, err)
+		}
+		if err := UpdateTaskStatus(tasks[i].ID, TaskStatusQueued); err != nil {
+			return nil, err
+		}
+		tasks[i].Status = TaskStatusQueued
 	}
 
 	return &tasks, nil
@@ -353,42 +538,175 @@ func FindProcessingTasksCount() (int, error) {
 	return count, nil
 }
 
-func FindNextTaskToProcess() (*Task, error) {
-	rows, err := db.Query("SELECT id, user_id, url, file_name, description, description_overwrite_behaviour, chart_name, status, type, import_countries, country_file_name, country_description, country_description_overwrite_behaviour, generate_template_commons, commons_template_name, commons_template_name_format, chart_parameters, last_operation_at, created_at FROM task WHERE status=? ORDER BY created_at ASC LIMIT 1", TaskStatusQueued)
+// FindNextFairTaskToProcess picks the next queued task while keeping the queue fair between users.
+// Users already at userLimit processing tasks are skipped, higher priority tasks go first, then the user
+// with the fewest processing tasks wins, ties go to the user who was served least recently, and within
+// a user the oldest task runs first
+func FindNextFairTaskToProcess(userLimit int) (*Task, error) {
+	rows, err := db.Query(`SELECT `+taskColumns+` FROM task t
+		WHERE t.status=? AND (SELECT COUNT(p.id) FROM task p WHERE p.user_id=t.user_id AND p.status=?) < ?
+		ORDER BY
+			t.priority DESC,
+			(SELECT COUNT(p.id) FROM task p WHERE p.user_id=t.user_id AND p.status=?) ASC,
+			(SELECT COALESCE(MAX(s.started_at), 0) FROM task s WHERE s.user_id=t.user_id) ASC,
+			t.created_at ASC
+		LIMIT 1`, TaskStatusQueued, TaskStatusProcessing, userLimit, TaskStatusProcessing)
 	if err != nil {
 		fmt.Println("Error scaning for next task to process ", err)
 		return nil, fmt.Errorf("Cannot find requested record")
 	}
 	defer rows.Close()
 
-	var task Task
-	if rows.Next() {
-		rows.Scan(
-			&task.ID,
-			&task.UserId,
-			&task.URL,
-			&task.FileName,
-			&task.Description,
-			&task.DescriptionOverwriteBehaviour,
-			&task.ChartName,
-			&task.Status,
-			&task.Type,
-			&task.ImportCountries,
-			&task.CountryFileName,
-			&task.CountryDescription,
-			&task.CountryDescriptionOverwriteBehaviour,
-			&task.GenerateTemplateCommons,
-			&task.CommonsTemplateName,
-			&task.CommonsTemplateNameFormat,
-			&task.ChartParameters,
-			&task.LastOperationAt,
-			&task.CreatedAt,
-		)
-	} else {
-		return nil, nil
+	if !rows.Next() {
+		return nil, rows.Err()
 	}
 
-	return &task, nil
+	task, err := scanTask(rows)
+	if err != nil {
+		fmt.Println("Error scaning next task to process ", err)
+		return nil, fmt.Errorf("Cannot find requested record")
+	}
+
+	return task, nil
+}
+
+// ClaimQueuedTask moves a queued task to processing, it returns false if another
+// worker already took the task or it's no longer queued
+func ClaimQueuedTask(id string) (bool, error) {
+	now := time.Now().Unix()
+	result, err := db.Exec("UPDATE task SET status=?, started_at=?, last_operation_at=? WHERE id=? AND status=?", TaskStatusProcessing, now, now, id, TaskStatusQueued)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func UpdateTaskPriority(id string, priority int) error {
+	stmt, err := db.Prepare("UPDATE task SET priority=? WHERE id=?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(priority, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FindQueuedTasks returns all queued tasks in the order FindNextFairTaskToProcess picks them up,
+// assuming every started task keeps running. A user at the scheduler's limit may still wait longer
+func FindQueuedTasks() (*[]Task, error) {
+	queued := make([]*Task, 0)
+	rows, err := db.Query("SELECT "+taskColumns+" FROM task WHERE status=? ORDER BY created_at ASC", TaskStatusQueued)
+	if err != nil {
+		fmt.Println("Error scaning for queued tasks ", err)
+		return nil, fmt.Errorf("Cannot find requested record")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			fmt.Println("Error scaning queued task ", err)
+			return nil, fmt.Errorf("Cannot find requested record")
+		}
+		queued = append(queued, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	processing, lastStarted, err := findUserQueueStats()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pick the tasks one by one, each pick counts as a processing task started now
+	tasks := make([]Task, 0, len(queued))
+	startedAt := time.Now().Unix()
+	for len(queued) > 0 {
+		next := 0
+		for i := 1; i < len(queued); i++ {
+			if isFairlyBefore(queued[i], queued[next], processing, lastStarted) {
+				next = i
+			}
+		}
+		task := queued[next]
+		queued = append(queued[:next], queued[next+1:]...)
+
+		startedAt++
+		processing[task.UserId]++
+		lastStarted[task.UserId] = startedAt
+		task.QueuePosition = len(tasks) + 1
+		tasks = append(tasks, *task)
+	}
+
+	return &tasks, nil
+}
+
+// findUserQueueStats returns the processing task count and the last start time of each user
+func findUserQueueStats() (map[string]int, map[string]int64, error) {
+	rows, err := db.Query("SELECT user_id, SUM(CASE WHEN status=? THEN 1 ELSE 0 END), COALESCE(MAX(started_at), 0) FROM task GROUP BY user_id", TaskStatusProcessing)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	processing := make(map[string]int)
+	lastStarted := make(map[string]int64)
+	for rows.Next() {
+		var userId string
+		var count int
+		var startedAt int64
+		if err := rows.Scan(&userId, &count, &startedAt); err != nil {
+			return nil, nil, err
+		}
+		processing[userId] = count
+		lastStarted[userId] = startedAt
+	}
+
+	return processing, lastStarted, rows.Err()
+}
+
+// isFairlyBefore tells if FindNextFairTaskToProcess picks a before b
+func isFairlyBefore(a, b *Task, processing map[string]int, lastStarted map[string]int64) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if processing[a.UserId] != processing[b.UserId] {
+		return processing[a.UserId] < processing[b.UserId]
+	}
+	if lastStarted[a.UserId] != lastStarted[b.UserId] {
+		return lastStarted[a.UserId] < lastStarted[b.UserId]
+	}
+	return a.CreatedAt < b.CreatedAt
+}
+
+// FindTaskQueuePosition returns the 1 based position of task in FindQueuedTasks, 0 when it isn't queued
+func FindTaskQueuePosition(task *Task) (int, error) {
+	if task.Status != TaskStatusQueued {
+		return 0, nil
+	}
+
+	tasks, err := FindQueuedTasks()
+	if err != nil {
+		return 0, err
+	}
+	for _, queued := range *tasks {
+		if queued.ID == task.ID {
+			return queued.QueuePosition, nil
+		}
+	}
+
+	return 0, nil
 }
 
 func initTaskTable() {
@@ -413,9 +731,34 @@ func initTaskTable() {
 		type VARCHAR(10) NOT NULL,
 		user_id TEXT NOT NULL,
 		last_operation_at BIGINT,
+		started_at BIGINT NOT NULL DEFAULT 0,
+		priority INT NOT NULL DEFAULT 0,
+		cancelled_at TEXT NOT NULL DEFAULT '',
+		import_mode VARCHAR(10) NOT NULL DEFAULT 'browser',
+		time_tolerance INT NOT NULL DEFAULT -1,
+		year_filter TEXT NOT NULL DEFAULT '',
+		regions TEXT NOT NULL DEFAULT '',
+		country_filter TEXT NOT NULL DEFAULT '',
+		category_file_names TEXT NOT NULL DEFAULT '',
+		dry_run INT NOT NULL DEFAULT 0,
+		destination VARCHAR(10) NOT NULL DEFAULT 'commons',
+		wiki_profile VARCHAR(50) NOT NULL DEFAULT 'default',
 		created_at BIGINT
 	);`)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	addColumnIfNotExists("task", "started_at", "BIGINT NOT NULL DEFAULT 0")
+	addColumnIfNotExists("task", "priority", "INT NOT NULL DEFAULT 0")
+	addColumnIfNotExists("task", "cancelled_at", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfNotExists("task", "import_mode", "VARCHAR(10) NOT NULL DEFAULT 'browser'")
+	addColumnIfNotExists("task", "time_tolerance", "INT NOT NULL DEFAULT -1")
+	addColumnIfNotExists("task", "year_filter", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfNotExists("task", "regions", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfNotExists("task", "country_filter", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfNotExists("task", "category_file_names", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfNotExists("task", "dry_run", "INT NOT NULL DEFAULT 0")
+	addColumnIfNotExists("task", "destination", "VARCHAR(10) NOT NULL DEFAULT 'commons'")
+	addColumnIfNotExists("task", "wiki_profile", "VARCHAR(50) NOT NULL DEFAULT 'default'")
 }
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"log"
+	"time"
+)
+
+// TaskCheckpoint is the oldest date of a region reached by a task where every
+// newer date was processed without failure, resuming can start from there.
+// TimeParam is the chart's time query param for that date as OWID writes it
+type TaskCheckpoint struct {
+	TaskId    string `json:"taskId"`
+	Region    string `json:"region"`
+	Date      string `json:"date"`
+	TimeParam string `json:"timeParam"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+func initTaskCheckpointTable() {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS task_checkpoint (
+		task_id TEXT NOT NULL,
+		region TEXT NOT NULL,
+		date TEXT NOT NULL,
+		time_param TEXT NOT NULL DEFAULT '',
+		updated_at BIGINT,
+		PRIMARY KEY (task_id, region),
+		FOREIGN KEY (task_id) REFERENCES task(id)
+	);`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func SaveTaskCheckpoint(taskId, region, date, timeParam string) error {
+	stmt, err := db.Prepare("INSERT OR REPLACE INTO task_checkpoint (task_id, region, date, time_param, updated_at) VALUES (?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(taskId, region, date, timeParam, time.Now().Unix())
+	return err
+}
+
+// DeleteTaskCheckpoints removes the checkpoints of a task, its next run starts every region from the latest date
+func DeleteTaskCheckpoints(taskId string) error {
+	_, err := db.Exec("DELETE FROM task_checkpoint WHERE task_id=?", taskId)
+	return err
+}
+
+func FindTaskCheckpoint(taskId, region string) (*TaskCheckpoint, error) {
+	var checkpoint TaskCheckpoint
+	err := db.QueryRow("SELECT task_id, region, date, time_param, updated_at FROM task_checkpoint WHERE task_id=? AND region=?", taskId, region).
+		Scan(&checkpoint.TaskId, &checkpoint.Region, &checkpoint.Date, &checkpoint.TimeParam, &checkpoint.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
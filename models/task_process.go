@@ -31,15 +31,17 @@ const (
 )
 
 type TaskProcess struct {
-	ID        string            `json:"id"`
-	Region    string            `json:"region"`
-	Type      TaskProcessType   `json:"type"`
-	Date      string            `json:"date"`
-	Status    TaskProcessStatus `json:"status"`
-	TaskId    string            `json:"taskId"`
-	FileName  string            `json:"filename"`
-	CreatedAt int64             `json:"createdAt"`
-	FillData  string            `json:"fillData"`
+	ID          string            `json:"id"`
+	Region      string            `json:"region"`
+	Type        TaskProcessType   `json:"type"`
+	Date        string            `json:"date"`
+	Status      TaskProcessStatus `json:"status"`
+	TaskId      string            `json:"taskId"`
+	FileName    string            `json:"filename"`
+	CreatedAt   int64             `json:"createdAt"`
+	FillData    string            `json:"fillData"`
+	Retries     int               `json:"retries"`     // Commons API requests sent again while processing
+	Description string            `json:"description"` // Description wikitext the file was, or in a dry run would be, uploaded with
 }
 
 func (t *TaskProcess) Value() (driver.Value, error) {
@@ -58,12 +60,17 @@ func initTaskProcessTable() {
 		type VARCHAR(10) NOT NULL,
 		status VARCHAR(50) NOT NULL,
 		task_id TEXT NOT NULL, 
+		retries INT NOT NULL DEFAULT 0,
+		description TEXT NOT NULL DEFAULT '',
 		created_at BIGINT,
 		FOREIGN KEY (task_id) REFERENCES task(id)
 	);`)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	addColumnIfNotExists("task_process", "retries", "INT NOT NULL DEFAULT 0")
+	addColumnIfNotExists("task_process", "description", "TEXT NOT NULL DEFAULT ''")
 }
 
 func NewTaskProcess(region string, date string, filename string, status TaskProcessStatus, taskProcessType TaskProcessType, taskId string) (*TaskProcess, error) {
@@ -94,7 +101,7 @@ func NewTaskProcess(region string, date string, filename string, status TaskProc
 
 func FindTaskProcessByTaskRegionDate(region string, date string, taskId string) (*TaskProcess, error) {
 	var tb TaskProcess
-	err := db.QueryRow("SELECT id, region, date, status, type, filename, fill_data, task_id, created_at FROM task_process where task_id=? AND region=? AND date=?", taskId, region, date).Scan(&tb.ID, &tb.Region, &tb.Date, &tb.Status, &tb.Type, &tb.FileName, &tb.FillData, &tb.TaskId, &tb.CreatedAt)
+	err := db.QueryRow("SELECT id, region, date, status, type, filename, fill_data, task_id, retries, description, created_at FROM task_process where task_id=? AND region=? AND date=?", taskId, region, date).Scan(&tb.ID, &tb.Region, &tb.Date, &tb.Status, &tb.Type, &tb.FileName, &tb.FillData, &tb.TaskId, &tb.Retries, &tb.Description, &tb.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -102,13 +109,13 @@ func FindTaskProcessByTaskRegionDate(region string, date string, taskId string)
 }
 
 func FailProcessingTaskProcesses(taskId string) error {
-	stmt, err := db.Prepare("UPDATE task_process SET status=? WHERE task_id=? AND status=?")
+	stmt, err := db.Prepare("UPDATE task_process SET status=? WHERE task_id=? AND status IN (?, ?)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(TaskProcessStatusFailed, taskId, TaskProcessStatusProcessing)
+	_, err = stmt.Exec(TaskProcessStatusFailed, taskId, TaskProcessStatusProcessing, TaskProcessStatusRetrying)
 	if err != nil {
 		return err
 	}
@@ -117,13 +124,13 @@ func FailProcessingTaskProcesses(taskId string) error {
 }
 
 func (taskProcess *TaskProcess) Update() error {
-	stmt, err := db.Prepare("UPDATE task_process SET region=?, date=?, status=?, filename=?, fill_data=? WHERE id=?")
+	stmt, err := db.Prepare("UPDATE task_process SET region=?, date=?, status=?, filename=?, fill_data=?, retries=?, description=? WHERE id=?")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(taskProcess.Region, taskProcess.Date, taskProcess.Status, taskProcess.FileName, taskProcess.FillData, taskProcess.ID)
+	_, err = stmt.Exec(taskProcess.Region, taskProcess.Date, taskProcess.Status, taskProcess.FileName, taskProcess.FillData, taskProcess.Retries, taskProcess.Description, taskProcess.ID)
 	if err != nil {
 		return err
 	}
@@ -134,7 +141,7 @@ func (taskProcess *TaskProcess) Update() error {
 func FindTaskProcessesByTaskId(id string) ([]TaskProcess, error) {
 	taskProcesses := make([]TaskProcess, 0)
 
-	rows, err := db.Query("SELECT id, region, date, status, type, filename, fill_data, task_id, created_at FROM task_process where task_id=? ORDER BY created_at DESC", id)
+	rows, err := db.Query("SELECT id, region, date, status, type, filename, fill_data, task_id, retries, description, created_at FROM task_process where task_id=? ORDER BY created_at DESC", id)
 	if err != nil {
 		fmt.Println("Error scaning task procresses for task_id ", id, err)
 		return taskProcesses, fmt.Errorf("Cannot find requested records")
@@ -143,7 +150,7 @@ func FindTaskProcessesByTaskId(id string) ([]TaskProcess, error) {
 
 	for rows.Next() {
 		var task TaskProcess
-		err := rows.Scan(&task.ID, &task.Region, &task.Date, &task.Status, &task.Type, &task.FileName, &task.FillData, &task.TaskId, &task.CreatedAt)
+		err := rows.Scan(&task.ID, &task.Region, &task.Date, &task.Status, &task.Type, &task.FileName, &task.FillData, &task.TaskId, &task.Retries, &task.Description, &task.CreatedAt)
 		if err != nil {
 			fmt.Println("Error parsing task process", err)
 		} else {
@@ -158,7 +165,7 @@ func FindTaskProcessesByTaskId(id string) ([]TaskProcess, error) {
 func FindTaskProcessesByTaskIdAndRegion(id, region string) ([]TaskProcess, error) {
 	taskProcesses := make([]TaskProcess, 0)
 
-	rows, err := db.Query("SELECT id, region, date, status, type, filename, fill_data, task_id, created_at FROM task_process where task_id=? AND region=? ORDER BY created_at DESC", id, region)
+	rows, err := db.Query("SELECT id, region, date, status, type, filename, fill_data, task_id, retries, description, created_at FROM task_process where task_id=? AND region=? ORDER BY created_at DESC", id, region)
 	if err != nil {
 		fmt.Println("Error scaning task procresses for task_id ", id, region, err)
 		return taskProcesses, fmt.Errorf("Cannot find requested records")
@@ -167,7 +174,7 @@ func FindTaskProcessesByTaskIdAndRegion(id, region string) ([]TaskProcess, error
 
 	for rows.Next() {
 		var task TaskProcess
-		err := rows.Scan(&task.ID, &task.Region, &task.Date, &task.Status, &task.Type, &task.FileName, &task.FillData, &task.TaskId, &task.CreatedAt)
+		err := rows.Scan(&task.ID, &task.Region, &task.Date, &task.Status, &task.Type, &task.FileName, &task.FillData, &task.TaskId, &task.Retries, &task.Description, &task.CreatedAt)
 		if err != nil {
 			fmt.Println("Error parsing task process", err)
 		} else {
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TaskSchedule re-runs a task every IntervalDays by queueing a copy of it
+type TaskSchedule struct {
+	ID           string `json:"id"`
+	TaskId       string `json:"taskId"`
+	UserId       string `json:"userId"`
+	IntervalDays int    `json:"intervalDays"`
+	NextRunAt    int64  `json:"nextRunAt"`
+	LastRunAt    int64  `json:"lastRunAt"`
+	LastTaskId   string `json:"lastTaskId"`
+	Active       int    `json:"active"` // 0 for false, 1 for true
+	CreatedAt    int64  `json:"createdAt"`
+}
+
+func initTaskScheduleTable() {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS task_schedule (
+		id VARCHAR(255) PRIMARY KEY,
+		task_id TEXT NOT NULL UNIQUE,
+		user_id TEXT NOT NULL,
+		interval_days INT NOT NULL,
+		next_run_at BIGINT NOT NULL,
+		last_run_at BIGINT NOT NULL DEFAULT 0,
+		last_task_id TEXT NOT NULL DEFAULT '',
+		active INT NOT NULL DEFAULT 1,
+		created_at BIGINT,
+		FOREIGN KEY (task_id) REFERENCES task(id)
+	);`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func NewTaskSchedule(taskId, userId string, intervalDays int) (*TaskSchedule, error) {
+	now := time.Now()
+	schedule := TaskSchedule{
+		ID:           uuid.New().String(),
+		TaskId:       taskId,
+		UserId:       userId,
+		IntervalDays: intervalDays,
+		NextRunAt:    now.AddDate(0, 0, intervalDays).Unix(),
+		LastRunAt:    0,
+		LastTaskId:   taskId,
+		Active:       1,
+		CreatedAt:    now.Unix(),
+	}
+	stmt, err := db.Prepare("INSERT INTO task_schedule (id, task_id, user_id, interval_days, next_run_at, last_run_at, last_task_id, active, created_at) VALUES (?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(schedule.ID, schedule.TaskId, schedule.UserId, schedule.IntervalDays, schedule.NextRunAt, schedule.LastRunAt, schedule.LastTaskId, schedule.Active, schedule.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+func (schedule *TaskSchedule) Update() error {
+	stmt, err := db.Prepare("UPDATE task_schedule SET interval_days=?, next_run_at=?, last_run_at=?, last_task_id=?, active=? WHERE id=?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(schedule.IntervalDays, schedule.NextRunAt, schedule.LastRunAt, schedule.LastTaskId, schedule.Active, schedule.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func FindTaskScheduleByTaskId(taskId string) (*TaskSchedule, error) {
+	var schedule TaskSchedule
+	err := db.QueryRow("SELECT id, task_id, user_id, interval_days, next_run_at, last_run_at, last_task_id, active, created_at FROM task_schedule WHERE task_id=?", taskId).
+		Scan(&schedule.ID, &schedule.TaskId, &schedule.UserId, &schedule.IntervalDays, &schedule.NextRunAt, &schedule.LastRunAt, &schedule.LastTaskId, &schedule.Active, &schedule.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+func FindDueTaskSchedules() ([]TaskSchedule, error) {
+	schedules := make([]TaskSchedule, 0)
+
+	rows, err := db.Query("SELECT id, task_id, user_id, interval_days, next_run_at, last_run_at, last_task_id, active, created_at FROM task_schedule WHERE active=1 AND next_run_at <= ? ORDER BY next_run_at ASC", time.Now().Unix())
+	if err != nil {
+		fmt.Println("Error scaning due task schedules ", err)
+		return schedules, fmt.Errorf("Cannot find requested records")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schedule TaskSchedule
+		err := rows.Scan(&schedule.ID, &schedule.TaskId, &schedule.UserId, &schedule.IntervalDays, &schedule.NextRunAt, &schedule.LastRunAt, &schedule.LastTaskId, &schedule.Active, &schedule.CreatedAt)
+		if err != nil {
+			fmt.Println("Error parsing task schedule", err)
+		} else {
+			schedules = append(schedules, schedule)
+		}
+	}
+
+	return schedules, nil
+}
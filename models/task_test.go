@@ -0,0 +1,149 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindNextFairTaskToProcessLoadsWholeTask(t *testing.T) {
+	from, to := 2000, 2010
+	yearFilter := YearFilter{From: &from, To: &to}
+	created, err := NewTask(NewTaskOptions{
+		UserId:                        "user-fair",
+		URL:                           "https://ourworldindata.org/grapher/a",
+		FileName:                      "$REGION, $YEAR.svg",
+		Description:                   "desc",
+		DescriptionOverwriteBehaviour: DescriptionOverwriteBehaviourAll,
+		Status:                        TaskStatusQueued,
+		Type:                          TaskTypeMap,
+		ImportCountries:               1,
+		GenerateTemplateCommons:       1,
+		ImportMode:                    TaskImportModeData,
+		TimeTolerance:                 2,
+		YearFilter:                    yearFilter,
+		Regions:                       RegionList{"World"},
+		CountryFilter:                 CountryFilter{Include: []string{"FRA"}},
+		CategoryFileNames:             CategoryFileNames{"aggregate": "$NAME.svg"},
+		DryRun:                        1,
+		Destination:                   TaskDestinationLocal,
+		WikiProfile:                   "testwiki",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM task WHERE id=?", created.ID)
+
+	next, err := FindNextFairTaskToProcess(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil || next.ID != created.ID {
+		t.Fatalf("expected task %s, got %+v", created.ID, next)
+	}
+
+	byId, err := FindTaskById(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(next, byId) {
+		t.Errorf("scheduler task differs from FindTaskById:\n%+v\n%+v", next, byId)
+	}
+
+	if next.DryRun != 1 || next.Destination != TaskDestinationLocal || next.WikiProfile != "testwiki" {
+		t.Errorf("dry run, destination or wiki profile not loaded: %+v", next)
+	}
+	if !reflect.DeepEqual(next.YearFilter, yearFilter) || next.ImportMode != TaskImportModeData || next.TimeTolerance != 2 {
+		t.Errorf("import settings not loaded: %+v", next)
+	}
+	if len(next.Regions) != 1 || len(next.CountryFilter.Include) != 1 || next.CategoryFileNames["aggregate"] != "$NAME.svg" {
+		t.Errorf("filters not loaded: %+v", next)
+	}
+}
+
+func TestTaskUpdateSavesEveryColumn(t *testing.T) {
+	task, err := NewTask(NewTaskOptions{UserId: "user-update", URL: "https://ourworldindata.org/grapher/a", Status: TaskStatusQueued, Type: TaskTypeMap})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM task WHERE id=?", task.ID)
+
+	from := 1990
+	task.Status = TaskStatusCancelled
+	task.Priority = 3
+	task.StartedAt = 42
+	task.CancelledAt = "World/2000"
+	task.ImportMode = TaskImportModeData
+	task.TimeTolerance = 5
+	task.YearFilter = YearFilter{From: &from, Step: 5}
+	task.Regions = RegionList{"Europe"}
+	task.CountryFilter = CountryFilter{Exclude: []string{"FRA"}}
+	task.CategoryFileNames = CategoryFileNames{"aggregate": "$NAME.svg"}
+	task.DryRun = 1
+	task.Destination = TaskDestinationLocal
+	task.WikiProfile = "testwiki"
+	task.CountryFileName = "$COUNTRY.svg"
+	task.GenerateTemplateCommons = 1
+	if err := task.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := Task{ID: task.ID}
+	if err := reloaded.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&reloaded, task) {
+		t.Errorf("reloaded task differs from the updated one:\n%+v\n%+v", reloaded, *task)
+	}
+}
+
+func TestQueuedTasksFollowTheFairOrder(t *testing.T) {
+	newQueuedTask := func(userId string, createdAt int64) *Task {
+		task, err := NewTask(NewTaskOptions{UserId: userId, URL: "https://ourworldindata.org/grapher/queue", Status: TaskStatusQueued, Type: TaskTypeMap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.CreatedAt = createdAt
+		if _, err := db.Exec("UPDATE task SET created_at=? WHERE id=?", createdAt, task.ID); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec("DELETE FROM task WHERE id=?", task.ID) })
+		return task
+	}
+
+	// The first user queued two tasks before the second user queued one
+	first := newQueuedTask("user-queue-first", 1)
+	second := newQueuedTask("user-queue-first", 2)
+	other := newQueuedTask("user-queue-other", 3)
+
+	tasks, err := FindQueuedTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make([]string, 0)
+	for _, task := range *tasks {
+		if task.ID == first.ID || task.ID == second.ID || task.ID == other.ID {
+			order = append(order, task.ID)
+		}
+	}
+	if want := []string{first.ID, other.ID, second.ID}; !reflect.DeepEqual(order, want) {
+		t.Errorf("expected the users to take turns %v, got %v", want, order)
+	}
+
+	next, err := FindNextFairTaskToProcess(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil || next.ID != (*tasks)[0].ID {
+		t.Errorf("expected the scheduler to pick the first queued task %s, got %+v", (*tasks)[0].ID, next)
+	}
+
+	for _, task := range *tasks {
+		position, err := FindTaskQueuePosition(&task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if position != task.QueuePosition {
+			t.Errorf("queue position of %s = %d, want %d", task.ID, position, task.QueuePosition)
+		}
+	}
+}
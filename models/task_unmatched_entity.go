@@ -0,0 +1,72 @@
+package models
+
+import (
+	"log"
+	"time"
+)
+
+// TaskUnmatchedEntity is an entity name a task came across that the entity
+// registry doesn't know, so it couldn't be imported. Source says where it was
+// found, e.g. the entity selector of the chart page or the chart data
+type TaskUnmatchedEntity struct {
+	TaskId    string `json:"taskId"`
+	Name      string `json:"name"`
+	Source    string `json:"source"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+const (
+	TaskUnmatchedEntitySourcePage = "page"
+	TaskUnmatchedEntitySourceData = "data"
+)
+
+func initTaskUnmatchedEntityTable() {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS task_unmatched_entity (
+		task_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		source TEXT NOT NULL,
+		created_at BIGINT,
+		PRIMARY KEY (task_id, name, source),
+		FOREIGN KEY (task_id) REFERENCES task(id)
+	);`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// AddTaskUnmatchedEntities records names as unmatched for the task, names already recorded are kept as is
+func AddTaskUnmatchedEntities(taskId, source string, names []string) error {
+	stmt, err := db.Prepare("INSERT OR IGNORE INTO task_unmatched_entity (task_id, name, source, created_at) VALUES (?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, name := range names {
+		if _, err := stmt.Exec(taskId, name, source, time.Now().Unix()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func FindTaskUnmatchedEntities(taskId string) ([]TaskUnmatchedEntity, error) {
+	rows, err := db.Query("SELECT task_id, name, source, created_at FROM task_unmatched_entity WHERE task_id=? ORDER BY name", taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := make([]TaskUnmatchedEntity, 0)
+	for rows.Next() {
+		var entity TaskUnmatchedEntity
+		if err := rows.Scan(&entity.TaskId, &entity.Name, &entity.Source, &entity.CreatedAt); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+
+	return entities, nil
+}
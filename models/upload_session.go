@@ -0,0 +1,62 @@
+package models
+
+import (
+	"log"
+	"time"
+)
+
+// UploadSession is a chunked upload sent to the Commons upload stash but not published yet.
+// FileKey is the stash key MediaWiki gave the file and Offset the number of bytes it received,
+// an interrupted upload of the same content by the same user continues from there
+type UploadSession struct {
+	UserId    string `json:"userId"` // Suffixed with @profile for wiki profiles other than the default one
+	FileName  string `json:"fileName"`
+	SHA1      string `json:"sha1"`
+	FileKey   string `json:"fileKey"`
+	Offset    int64  `json:"offset"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+func initUploadSessionTable() {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS upload_session (
+		user_id TEXT NOT NULL,
+		file_name TEXT NOT NULL,
+		sha1 TEXT NOT NULL,
+		file_key TEXT NOT NULL,
+		chunk_offset BIGINT NOT NULL DEFAULT 0,
+		updated_at BIGINT,
+		PRIMARY KEY (user_id, file_name, sha1)
+	);`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func SaveUploadSession(session *UploadSession) error {
+	session.UpdatedAt = time.Now().Unix()
+	stmt, err := db.Prepare("INSERT OR REPLACE INTO upload_session (user_id, file_name, sha1, file_key, chunk_offset, updated_at) VALUES (?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(session.UserId, session.FileName, session.SHA1, session.FileKey, session.Offset, session.UpdatedAt)
+	return err
+}
+
+func FindUploadSession(userId, fileName, sha1 string) (*UploadSession, error) {
+	var session UploadSession
+	err := db.QueryRow("SELECT user_id, file_name, sha1, file_key, chunk_offset, updated_at FROM upload_session WHERE user_id=? AND file_name=? AND sha1=?", userId, fileName, sha1).
+		Scan(&session.UserId, &session.FileName, &session.SHA1, &session.FileKey, &session.Offset, &session.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func DeleteUploadSession(userId, fileName, sha1 string) error {
+	_, err := db.Exec("DELETE FROM upload_session WHERE user_id=? AND file_name=? AND sha1=?", userId, fileName, sha1)
+	return err
+}
@@ -14,6 +14,7 @@ type User struct {
 	Username            string `json:"username"`
 	ResourceOwnerSecret string `json:"resource_owner_secret"` // This will be encrypted in the database
 	ResourceOwnerKey    string `json:"resource_owner_key"`    // This will be encrypted in the database
+	WikiProfile         string `json:"wikiProfile"`           // Not stored, the profile the tokens belong to, see WithWikiProfile
 }
 
 func NewUser(username, resourceOwnerKey, resourceOwnerSecret string) (*User, error) {
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/wpmed-videowiki/OWIDImporter/encryption"
+	"github.com/wpmed-videowiki/OWIDImporter/env"
+)
+
+// UserWikiToken holds the OAuth tokens a user got by logging in to a wiki profile other than the
+// default one, the default profile's tokens stay on the user table
+type UserWikiToken struct {
+	UserId              string `json:"userId"`
+	WikiProfile         string `json:"wikiProfile"`
+	ResourceOwnerKey    string `json:"-"` // This will be encrypted in the database
+	ResourceOwnerSecret string `json:"-"` // This will be encrypted in the database
+}
+
+func initUserWikiTokenTable() {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS user_wiki_token (
+		user_id VARCHAR(255) NOT NULL,
+		wiki_profile VARCHAR(50) NOT NULL,
+		resource_owner_key TEXT,
+		resource_owner_secret TEXT,
+		PRIMARY KEY (user_id, wiki_profile),
+		FOREIGN KEY (user_id) REFERENCES user(id)
+	);`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func SaveUserWikiToken(userId, wikiProfile, resourceOwnerKey, resourceOwnerSecret string) error {
+	encryptedKey, err := encryption.Encrypt(resourceOwnerKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt resource owner key: %w", err)
+	}
+
+	encryptedSecret, err := encryption.Encrypt(resourceOwnerSecret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt resource owner secret: %w", err)
+	}
+
+	stmt, err := db.Prepare("INSERT OR REPLACE INTO user_wiki_token (user_id, wiki_profile, resource_owner_key, resource_owner_secret) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(userId, wikiProfile, encryptedKey, encryptedSecret)
+	return err
+}
+
+func FindUserWikiToken(userId, wikiProfile string) (*UserWikiToken, error) {
+	token := UserWikiToken{UserId: userId, WikiProfile: wikiProfile}
+	var encryptedKey, encryptedSecret string
+
+	err := db.QueryRow("SELECT resource_owner_key, resource_owner_secret FROM user_wiki_token WHERE user_id=? AND wiki_profile=?", userId, wikiProfile).
+		Scan(&encryptedKey, &encryptedSecret)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find requested record")
+	}
+
+	token.ResourceOwnerKey, err = encryption.Decrypt(encryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt resource owner key: %w", err)
+	}
+	token.ResourceOwnerSecret, err = encryption.Decrypt(encryptedSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt resource owner secret: %w", err)
+	}
+
+	return &token, nil
+}
+
+// WithWikiProfile returns a copy of user holding its tokens for wikiProfile, API clients made from
+// it call that wiki. It fails for unknown profiles and ones the user never logged in to
+func (user *User) WithWikiProfile(wikiProfile string) (*User, error) {
+	if wikiProfile == "" {
+		wikiProfile = env.DefaultWikiProfile
+	}
+	if _, ok := env.GetWikiProfile(wikiProfile); !ok {
+		return nil, fmt.Errorf("unknown wiki profile %s", wikiProfile)
+	}
+
+	profileUser := *user
+	profileUser.WikiProfile = wikiProfile
+	if wikiProfile == env.DefaultWikiProfile {
+		if user.ResourceOwnerKey == "" {
+			return nil, fmt.Errorf("user didn't log in to wiki profile %s", wikiProfile)
+		}
+		return &profileUser, nil
+	}
+
+	token, err := FindUserWikiToken(user.ID, wikiProfile)
+	if err != nil {
+		return nil, fmt.Errorf("user didn't log in to wiki profile %s", wikiProfile)
+	}
+	profileUser.ResourceOwnerKey = token.ResourceOwnerKey
+	profileUser.ResourceOwnerSecret = token.ResourceOwnerSecret
+
+	return &profileUser, nil
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// YearFilter limits the years imported for a map, either a From/To range
+// stepped by Step or an explicit list of Years. The zero value keeps every year
+type YearFilter struct {
+	From  *int  `json:"from,omitempty"`
+	To    *int  `json:"to,omitempty"`
+	Step  int   `json:"step,omitempty"` // Steps are counted from From, or from year 0 when there's no From
+	Years []int `json:"years,omitempty"`
+}
+
+func (f *YearFilter) Scan(value interface{}) error {
+	*f = YearFilter{}
+	var str string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		return fmt.Errorf("unsupported year filter value %T", value)
+	}
+	if str == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(str), f)
+}
+
+func (f YearFilter) Value() (driver.Value, error) {
+	if f.IsEmpty() {
+		return "", nil
+	}
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+func (f YearFilter) IsEmpty() bool {
+	return f.From == nil && f.To == nil && f.Step <= 1 && len(f.Years) == 0
+}
+
+func (f YearFilter) Validate() error {
+	if len(f.Years) > 0 {
+		if f.From != nil || f.To != nil || f.Step != 0 {
+			return fmt.Errorf("A years list can't be combined with a range or step")
+		}
+		return nil
+	}
+	if f.Step < 0 {
+		return fmt.Errorf("Step must be positive")
+	}
+	if f.From != nil && f.To != nil && *f.From > *f.To {
+		return fmt.Errorf("From must not be after To")
+	}
+	return nil
+}
+
+// Includes reports whether the year passes the filter
+func (f YearFilter) Includes(year int) bool {
+	if len(f.Years) > 0 {
+		return slices.Contains(f.Years, year)
+	}
+	if f.From != nil && year < *f.From {
+		return false
+	}
+	if f.To != nil && year > *f.To {
+		return false
+	}
+	if f.Step > 1 {
+		return floorMod(year-f.stepAnchor(), f.Step) == 0
+	}
+	return true
+}
+
+// IncludesDate is Includes for task process dates, dates that aren't a year are kept
+func (f YearFilter) IncludesDate(date string) bool {
+	year, err := strconv.Atoi(date)
+	if err != nil {
+		return true
+	}
+	return f.Includes(year)
+}
+
+// PreviousYear returns the latest year before the given one that passes the filter
+func (f YearFilter) PreviousYear(year int) (int, bool) {
+	if len(f.Years) > 0 {
+		previous, found := 0, false
+		for _, y := range f.Years {
+			if y < year && (!found || y > previous) {
+				previous, found = y, true
+			}
+		}
+		return previous, found
+	}
+
+	previous := year - 1
+	if f.To != nil && previous > *f.To {
+		previous = *f.To
+	}
+	if f.Step > 1 {
+		previous -= floorMod(previous-f.stepAnchor(), f.Step)
+	}
+	if f.From != nil && previous < *f.From {
+		return 0, false
+	}
+	return previous, true
+}
+
+// LatestYear returns the latest year passing the filter, if it has an upper bound
+func (f YearFilter) LatestYear() (int, bool) {
+	if len(f.Years) > 0 {
+		return slices.Max(f.Years), true
+	}
+	if f.To == nil {
+		return 0, false
+	}
+	return f.PreviousYear(*f.To + 1)
+}
+
+func (f YearFilter) stepAnchor() int {
+	if f.From != nil {
+		return *f.From
+	}
+	return 0
+}
+
+func floorMod(a, b int) int {
+	return ((a % b) + b) % b
+}
@@ -0,0 +1,438 @@
+package owidparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Binning strategies of the grapher ColorScale
+const (
+	BinningStrategyManual        = "manual"
+	BinningStrategyEqualInterval = "equalInterval"
+	BinningStrategyQuantiles     = "quantiles"
+	BinningStrategyCkmeans       = "ckmeans"
+	BinningStrategyLogAuto       = "log-auto"
+	BinningStrategyLog125        = "log-1-2-5"
+	BinningStrategyLog13         = "log-1-3"
+	BinningStrategyLog10         = "log-10"
+)
+
+const DEFAULT_BIN_COUNT = 5
+
+// Above this many distinct values ckmeans runs on quantiles of the data to stay fast
+const CKMEANS_MAX_POINTS = 500
+
+// DataValue is a value of data.json, numeric for most indicators and text for categorical ones
+type DataValue struct {
+	Number float64
+	Text   string
+	IsText bool
+}
+
+func (v *DataValue) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '"' {
+		v.IsText = true
+		return json.Unmarshal(b, &v.Text)
+	}
+	if string(b) == "null" {
+		v.Number = math.NaN()
+		return nil
+	}
+	return json.Unmarshal(b, &v.Number)
+}
+
+func (v DataValue) String() string {
+	if v.IsText {
+		return v.Text
+	}
+	return strconv.FormatFloat(v.Number, 'f', -1, 64)
+}
+
+// NumericBin colors the values in (Min, Max], the first bin also includes Min
+type NumericBin struct {
+	Min  float64
+	Max  float64
+	Fill string
+}
+
+// Legend is the color legend of a map rendered by OWID, it supplies the colors of the
+// color scheme so they don't need to be duplicated here
+type Legend struct {
+	NumericFills  []string          // Swatches of the numeric bins, in ascending order
+	CategoryFills map[string]string // Label => swatch of the categorical entries
+}
+
+// ColorMapper maps data values to map fills following the grapher ColorScale
+type ColorMapper struct {
+	Bins       []NumericBin
+	Categories map[string]string
+	NoDataFill string
+}
+
+// ReadLegend reads the swatches and labels of the map legend
+func ReadLegend(query *SVGQuery) (*Legend, error) {
+	swatches := query.Select("#swatches")
+	labels := query.Select("#labels")
+	if len(swatches) == 0 {
+		return nil, fmt.Errorf("Could not find legend swatches in SVG")
+	}
+
+	legend := Legend{
+		NumericFills:  make([]string, 0),
+		CategoryFills: make(map[string]string),
+	}
+	labelElements := make([]*GenericElement, 0)
+	if len(labels) > 0 {
+		labelElements = labels[0].GetElements()
+	}
+
+	for index, swatch := range swatches[0].GetElements() {
+		fill := swatch.Attributes["fill"]
+		if fill == "" || fill == NO_DATA_FILL {
+			continue
+		}
+		legend.NumericFills = append(legend.NumericFills, fill)
+		// Categorical legends pair every swatch with its label
+		if index < len(labelElements) {
+			label := strings.TrimSpace(extractAllTextContent(labelElements[index]))
+			if label != "" {
+				legend.CategoryFills[label] = fill
+			}
+		}
+	}
+
+	return &legend, nil
+}
+
+// NewColorMapper builds the bins or categories of the color scale from the config and the values of every year
+func NewColorMapper(colorScale ColorScale, metadata *Metadata, values []DataValue, legend *Legend) (*ColorMapper, error) {
+	mapper := ColorMapper{
+		Categories: make(map[string]string),
+		NoDataFill: NO_DATA_FILL,
+	}
+
+	numbers := make([]float64, 0, len(values))
+	// Category => position in the legend when its label doesn't match
+	categories := make(map[string]int)
+	for _, value := range values {
+		if value.IsText {
+			if _, ok := categories[value.Text]; !ok {
+				categories[value.Text] = len(categories)
+			}
+		} else if !math.IsNaN(value.Number) {
+			numbers = append(numbers, value.Number)
+		}
+	}
+
+	// Ordinal indicators store the index of their category in the legend
+	if len(categories) == 0 && isOrdinal(colorScale, metadata) {
+		for _, number := range numbers {
+			categories[strconv.FormatFloat(number, 'f', -1, 64)] = int(number)
+		}
+		numbers = numbers[:0]
+	}
+
+	for category, index := range categories {
+		fill := ""
+		if customFill, ok := colorScale.CustomCategoryColors[category]; ok && customFill != "" {
+			fill = customFill
+		} else if legendFill, ok := legend.CategoryFills[category]; ok {
+			fill = legendFill
+		} else if label, ok := colorScale.CustomCategoryLabels[category]; ok && legend.CategoryFills[label] != "" {
+			fill = legend.CategoryFills[label]
+		} else if index >= 0 && index < len(legend.NumericFills) {
+			fill = legend.NumericFills[index]
+		}
+		if fill != "" {
+			mapper.Categories[category] = fill
+		}
+	}
+
+	if len(numbers) == 0 {
+		if len(mapper.Categories) == 0 {
+			return nil, fmt.Errorf("No values to build the color scale from")
+		}
+		return &mapper, nil
+	}
+
+	sort.Float64s(numbers)
+	limits := getBinLimits(colorScale, numbers)
+	if len(limits) < 2 {
+		return nil, fmt.Errorf("Could not compute bins for binning strategy %q", colorScale.BinningStrategy)
+	}
+
+	binCount := len(limits) - 1
+	for index := 0; index < binCount; index++ {
+		fill := ""
+		if colorScale.CustomNumericColorsActive && index < len(colorScale.CustomNumericColors) && colorScale.CustomNumericColors[index] != nil {
+			fill = *colorScale.CustomNumericColors[index]
+		}
+		if fill == "" && len(legend.NumericFills) > 0 {
+			// The legend has a swatch per bin, spread them if the counts differ
+			fill = legend.NumericFills[index*len(legend.NumericFills)/binCount]
+		}
+		if fill == "" {
+			return nil, fmt.Errorf("No color for bin %d", index)
+		}
+		mapper.Bins = append(mapper.Bins, NumericBin{
+			Min:  limits[index],
+			Max:  limits[index+1],
+			Fill: fill,
+		})
+	}
+
+	return &mapper, nil
+}
+
+// Fill returns the fill of a value, the no data pattern for values the scale doesn't cover
+func (mapper *ColorMapper) Fill(value DataValue) string {
+	if value.IsText {
+		if fill, ok := mapper.Categories[value.Text]; ok {
+			return fill
+		}
+		return mapper.NoDataFill
+	}
+	if math.IsNaN(value.Number) {
+		return mapper.NoDataFill
+	}
+	if len(mapper.Bins) == 0 {
+		if fill, ok := mapper.Categories[value.String()]; ok {
+			return fill
+		}
+		return mapper.NoDataFill
+	}
+
+	// Values outside the scale go to the closest bin, like on OWID
+	for _, bin := range mapper.Bins {
+		if value.Number <= bin.Max {
+			return bin.Fill
+		}
+	}
+	return mapper.Bins[len(mapper.Bins)-1].Fill
+}
+
+// isOrdinal tells if the numbers of the indicator are category indexes rather than quantities, either
+// by its type or because the config colors or labels numeric categories. Other ints, such as counts, are binned
+func isOrdinal(colorScale ColorScale, metadata *Metadata) bool {
+	if metadata.Type == "ordinal" {
+		return true
+	}
+	for category := range colorScale.CustomCategoryColors {
+		if _, err := strconv.ParseFloat(category, 64); err == nil {
+			return true
+		}
+	}
+	for category := range colorScale.CustomCategoryLabels {
+		if _, err := strconv.ParseFloat(category, 64); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// getBinLimits returns the minimum of the first bin followed by the maximum of every bin
+func getBinLimits(colorScale ColorScale, sortedValues []float64) []float64 {
+	strategy := colorScale.BinningStrategy
+	if strategy == "" {
+		// ckmeans is the grapher default
+		strategy = BinningStrategyCkmeans
+	}
+
+	minValue := sortedValues[0]
+	maxValue := sortedValues[len(sortedValues)-1]
+	if colorScale.CustomNumericMinValue != nil {
+		minValue = *colorScale.CustomNumericMinValue
+	} else if minValue > 0 && (strategy == BinningStrategyManual || strategy == BinningStrategyEqualInterval) {
+		minValue = 0
+	}
+
+	binCount := colorScale.BinningStrategyBinCount
+	if binCount < 1 {
+		binCount = DEFAULT_BIN_COUNT
+	}
+
+	var maximums []float64
+	switch strategy {
+	case BinningStrategyManual:
+		values := colorScale.CustomNumericValues
+		if colorScale.CustomNumericMinValue == nil && len(values) > 1 {
+			// Without an explicit minimum the first value is the minimum of the first bin
+			minValue = values[0]
+			values = values[1:]
+		}
+		maximums = append(maximums, values...)
+	case BinningStrategyEqualInterval:
+		maximums = getEqualIntervalBinMaximums(minValue, maxValue, binCount)
+	case BinningStrategyQuantiles:
+		for index := 1; index <= binCount; index++ {
+			maximums = append(maximums, roundSigFig(quantile(sortedValues, float64(index)/float64(binCount)), 2))
+		}
+	case BinningStrategyLog10:
+		maximums = getLogBinMaximums(sortedValues, []float64{1})
+	case BinningStrategyLog13:
+		maximums = getLogBinMaximums(sortedValues, []float64{1, 3})
+	case BinningStrategyLogAuto, BinningStrategyLog125:
+		maximums = getLogBinMaximums(sortedValues, []float64{1, 2, 5})
+	default:
+		maximums = getCkmeansBinMaximums(sortedValues, binCount)
+	}
+
+	limits := []float64{minValue}
+	for _, maximum := range maximums {
+		if maximum > limits[len(limits)-1] {
+			limits = append(limits, maximum)
+		}
+	}
+	return limits
+}
+
+func getEqualIntervalBinMaximums(minValue, maxValue float64, binCount int) []float64 {
+	step := roundSigFig((maxValue-minValue)/float64(binCount), 1)
+	if step <= 0 {
+		return []float64{maxValue}
+	}
+
+	// The rounded step can leave the maximum out, the last bin stretches to it then
+	maximums := make([]float64, 0, binCount)
+	value := minValue + step
+	for len(maximums) < binCount-1 && value < maxValue {
+		maximums = append(maximums, roundSigFig(value, 6))
+		value += step
+	}
+	return append(maximums, math.Max(roundSigFig(value, 6), maxValue))
+}
+
+// getLogBinMaximums steps through multiples of powers of ten, e.g. 1, 2, 5, 10, 20, 50...
+// from the smallest positive value, anything below it goes in the first bin
+func getLogBinMaximums(sortedValues []float64, multiples []float64) []float64 {
+	maxValue := sortedValues[len(sortedValues)-1]
+	if maxValue <= 0 {
+		return []float64{maxValue}
+	}
+	minValue := maxValue
+	for _, value := range sortedValues {
+		if value > 0 {
+			minValue = value
+			break
+		}
+	}
+
+	maximums := make([]float64, 0)
+	for exponent := math.Floor(math.Log10(minValue)); ; exponent++ {
+		for _, multiple := range multiples {
+			value := roundSigFig(multiple*math.Pow(10, exponent), 6)
+			if value < minValue {
+				continue
+			}
+			maximums = append(maximums, value)
+			if value >= maxValue {
+				return maximums
+			}
+		}
+	}
+}
+
+// getCkmeansBinMaximums clusters the values so the variance within bins is minimal
+func getCkmeansBinMaximums(sortedValues []float64, binCount int) []float64 {
+	points := uniqueSorted(sortedValues)
+	if len(points) > CKMEANS_MAX_POINTS {
+		sampled := make([]float64, 0, CKMEANS_MAX_POINTS)
+		for index := 0; index < CKMEANS_MAX_POINTS; index++ {
+			sampled = append(sampled, quantile(sortedValues, float64(index)/float64(CKMEANS_MAX_POINTS-1)))
+		}
+		points = uniqueSorted(sampled)
+	}
+	if binCount > len(points) {
+		binCount = len(points)
+	}
+	if binCount <= 1 {
+		return []float64{points[len(points)-1]}
+	}
+
+	n := len(points)
+	prefix := make([]float64, n+1)
+	prefixSquares := make([]float64, n+1)
+	for index, point := range points {
+		prefix[index+1] = prefix[index] + point
+		prefixSquares[index+1] = prefixSquares[index] + point*point
+	}
+	// cost of points[from..to] as one cluster
+	cost := func(from, to int) float64 {
+		count := float64(to - from + 1)
+		sum := prefix[to+1] - prefix[from]
+		return prefixSquares[to+1] - prefixSquares[from] - sum*sum/count
+	}
+
+	best := make([][]float64, binCount)
+	split := make([][]int, binCount)
+	for k := range best {
+		best[k] = make([]float64, n)
+		split[k] = make([]int, n)
+	}
+	for to := 0; to < n; to++ {
+		best[0][to] = cost(0, to)
+	}
+	for k := 1; k < binCount; k++ {
+		for to := k; to < n; to++ {
+			best[k][to] = math.Inf(1)
+			for from := k; from <= to; from++ {
+				value := best[k-1][from-1] + cost(from, to)
+				if value < best[k][to] {
+					best[k][to] = value
+					split[k][to] = from
+				}
+			}
+		}
+	}
+
+	// Clusters start at the split points, each bin ends with the last value of its cluster
+	starts := make([]int, binCount)
+	to := n - 1
+	for k := binCount - 1; k > 0; k-- {
+		starts[k] = split[k][to]
+		to = starts[k] - 1
+	}
+
+	maximums := make([]float64, 0, binCount)
+	for k := 1; k < binCount; k++ {
+		maximums = append(maximums, points[starts[k]-1])
+	}
+	return append(maximums, points[n-1])
+}
+
+func uniqueSorted(sortedValues []float64) []float64 {
+	unique := make([]float64, 0, len(sortedValues))
+	for index, value := range sortedValues {
+		if index == 0 || value != sortedValues[index-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// quantile interpolates linearly between the closest ranks, like d3's quantile
+func quantile(sortedValues []float64, p float64) float64 {
+	if len(sortedValues) == 1 {
+		return sortedValues[0]
+	}
+	position := p * float64(len(sortedValues)-1)
+	lower := int(math.Floor(position))
+	if lower >= len(sortedValues)-1 {
+		return sortedValues[len(sortedValues)-1]
+	}
+	return sortedValues[lower] + (sortedValues[lower+1]-sortedValues[lower])*(position-float64(lower))
+}
+
+func roundSigFig(value float64, digits int) float64 {
+	if value == 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return value
+	}
+	magnitude := math.Pow(10, float64(digits)-math.Ceil(math.Log10(math.Abs(value))))
+	return math.Round(value*magnitude) / magnitude
+}
@@ -0,0 +1,359 @@
+package owidparser
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func color(fill string) *string {
+	return &fill
+}
+
+func number(value float64) DataValue {
+	return DataValue{Number: value}
+}
+
+func text(value string) DataValue {
+	return DataValue{Text: value, IsText: true}
+}
+
+func TestGetBinLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		colorScale ColorScale
+		values     []float64
+		want       []float64
+	}{
+		{
+			name:       "manual with min value",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyManual, CustomNumericMinValue: float(0), CustomNumericValues: []float64{10, 20, 50}},
+			values:     []float64{1, 15, 60},
+			want:       []float64{0, 10, 20, 50},
+		},
+		{
+			name:       "manual without min value uses the first value as min",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyManual, CustomNumericValues: []float64{5, 10, 20, 50}},
+			values:     []float64{1, 15, 60},
+			want:       []float64{5, 10, 20, 50},
+		},
+		{
+			name:       "manual with a single value starts at zero",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyManual, CustomNumericValues: []float64{50}},
+			values:     []float64{1, 15, 60},
+			want:       []float64{0, 50},
+		},
+		{
+			name:       "manual drops values not above the min",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyManual, CustomNumericMinValue: float(10), CustomNumericValues: []float64{5, 10, 20}},
+			values:     []float64{1, 15},
+			want:       []float64{10, 20},
+		},
+		{
+			name:       "equal interval",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyEqualInterval},
+			values:     []float64{0, 35, 100},
+			want:       []float64{0, 20, 40, 60, 80, 100},
+		},
+		{
+			name:       "quantiles",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyQuantiles, BinningStrategyBinCount: 2},
+			values:     []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			want:       []float64{1, 5.5, 10},
+		},
+		{
+			name:       "log 1-2-5",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyLog125},
+			values:     []float64{3, 40, 800},
+			want:       []float64{3, 5, 10, 20, 50, 100, 200, 500, 1000},
+		},
+		{
+			name:       "log auto",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyLogAuto},
+			values:     []float64{1, 9},
+			want:       []float64{1, 2, 5, 10},
+		},
+		{
+			name:       "log 1-3",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyLog13},
+			values:     []float64{2, 25},
+			want:       []float64{2, 3, 10, 30},
+		},
+		{
+			name:       "log 10 starts at the smallest positive value",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyLog10},
+			values:     []float64{0, 0.5, 150},
+			want:       []float64{0, 1, 10, 100, 1000},
+		},
+		{
+			name:       "log without positive values",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyLog10},
+			values:     []float64{-5, 0},
+			want:       []float64{-5, 0},
+		},
+		{
+			name:       "ckmeans",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyCkmeans, BinningStrategyBinCount: 3},
+			values:     []float64{1, 2, 3, 10, 11, 12, 100, 101},
+			want:       []float64{1, 3, 12, 101},
+		},
+		{
+			name:       "ckmeans is the default strategy",
+			colorScale: ColorScale{BinningStrategyBinCount: 3},
+			values:     []float64{1, 2, 3, 10, 11, 12, 100, 101},
+			want:       []float64{1, 3, 12, 101},
+		},
+		{
+			name:       "ckmeans with fewer values than bins",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyCkmeans},
+			values:     []float64{1, 1, 9},
+			want:       []float64{1, 9},
+		},
+		{
+			name:       "ckmeans with min value",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyCkmeans, BinningStrategyBinCount: 2, CustomNumericMinValue: float(-5)},
+			values:     []float64{1, 2, 10, 11},
+			want:       []float64{-5, 2, 11},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := getBinLimits(test.colorScale, test.values)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("getBinLimits() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestColorMapperFill(t *testing.T) {
+	legend := &Legend{
+		NumericFills:  []string{"#a", "#b", "#c"},
+		CategoryFills: map[string]string{"Low": "#a", "High": "#c"},
+	}
+	manual := ColorScale{BinningStrategy: BinningStrategyManual, CustomNumericMinValue: float(0), CustomNumericValues: []float64{10, 20, 30}}
+	numbers := []DataValue{number(1), number(25)}
+
+	customColors := manual
+	customColors.CustomNumericColorsActive = true
+	customColors.CustomNumericColors = []*string{nil, color("#custom"), nil}
+
+	inactiveColors := customColors
+	inactiveColors.CustomNumericColorsActive = false
+
+	categorical := ColorScale{
+		CustomCategoryColors: map[string]string{"Medium": "#medium"},
+		CustomCategoryLabels: map[string]string{"Hi": "High"},
+	}
+	categories := []DataValue{text("Low"), text("Unknown"), text("Medium"), text("Hi"), text("Extra")}
+
+	tests := []struct {
+		name       string
+		colorScale ColorScale
+		metadata   Metadata
+		values     []DataValue
+		fills      map[DataValue]string
+	}{
+		{
+			name:       "manual bins",
+			colorScale: manual,
+			values:     numbers,
+			fills: map[DataValue]string{
+				number(0):  "#a",
+				number(10): "#a",
+				number(11): "#b",
+				number(20): "#b",
+				number(30): "#c",
+				number(-1): "#a", // Below the scale goes to the first bin
+				number(99): "#c", // Above the scale goes to the last bin
+			},
+		},
+		{
+			name:       "custom numeric colors override the legend",
+			colorScale: customColors,
+			values:     numbers,
+			fills: map[DataValue]string{
+				number(5):  "#a",
+				number(15): "#custom",
+				number(25): "#c",
+			},
+		},
+		{
+			name:       "inactive custom numeric colors are ignored",
+			colorScale: inactiveColors,
+			values:     numbers,
+			fills: map[DataValue]string{
+				number(15): "#b",
+			},
+		},
+		{
+			name:       "categorical",
+			colorScale: categorical,
+			values:     categories,
+			fills: map[DataValue]string{
+				text("Low"):     "#a",         // Legend label
+				text("Medium"):  "#medium",    // Custom category color
+				text("Hi"):      "#c",         // Custom label of a legend entry
+				text("Unknown"): "#b",         // Position in the legend
+				text("Extra"):   NO_DATA_FILL, // Past the end of the legend
+				text("Missing"): NO_DATA_FILL,
+			},
+		},
+		{
+			name:     "ordinal values are legend positions",
+			metadata: Metadata{Type: "ordinal"},
+			values:   []DataValue{number(0), number(2)},
+			fills: map[DataValue]string{
+				number(0): "#a",
+				number(2): "#c",
+				number(1): NO_DATA_FILL,
+			},
+		},
+		{
+			name:       "unitless int counts are binned",
+			colorScale: ColorScale{BinningStrategy: BinningStrategyEqualInterval, BinningStrategyBinCount: 3},
+			metadata:   Metadata{Type: "int"},
+			values:     []DataValue{number(0), number(30)},
+			fills: map[DataValue]string{
+				number(2):  "#a",
+				number(15): "#b",
+				number(30): "#c",
+			},
+		},
+		{
+			name:       "numeric category colors make ints ordinal",
+			colorScale: ColorScale{CustomCategoryColors: map[string]string{"1": "#one"}},
+			metadata:   Metadata{Type: "int"},
+			values:     []DataValue{number(0), number(1), number(2)},
+			fills: map[DataValue]string{
+				number(0): "#a",
+				number(1): "#one",
+				number(2): "#c",
+			},
+		},
+		{
+			name:       "no data",
+			colorScale: manual,
+			values:     numbers,
+			fills: map[DataValue]string{
+				{Number: math.NaN()}: NO_DATA_FILL,
+				text("Low"):          NO_DATA_FILL,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mapper, err := NewColorMapper(test.colorScale, &test.metadata, test.values, legend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for value, want := range test.fills {
+				if got := mapper.Fill(value); got != want {
+					t.Errorf("Fill(%s) = %s, want %s", value, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestGenerateImagesMatchesOWID regenerates the maps of the charts in testdata/owid from their data
+// and compares the fill of every entity with the map OWID rendered for the same year.
+// Each chart directory holds config.json, data.json, metadata.json and <year>.svg files,
+// written by go run ./owidparser/testdata/capture <chart url> <year>...
+func TestGenerateImagesMatchesOWID(t *testing.T) {
+	charts, err := filepath.Glob(filepath.Join("testdata", "owid", "*", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(charts) == 0 {
+		t.Skip("no OWID charts in testdata/owid")
+	}
+
+	for _, configPath := range charts {
+		chartDir := filepath.Dir(configPath)
+		t.Run(filepath.Base(chartDir), func(t *testing.T) {
+			b, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var config OWIDGrapherConfig
+			if err := json.Unmarshal(b, &config); err != nil {
+				t.Fatal(err)
+			}
+
+			renders, err := filepath.Glob(filepath.Join(chartDir, "*.svg"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(renders) == 0 {
+				t.Fatal("no OWID maps found")
+			}
+
+			for _, renderPath := range renders {
+				year, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(renderPath), ".svg"))
+				if err != nil {
+					t.Fatalf("%s isn't named after its year", renderPath)
+				}
+
+				outPath := t.TempDir()
+				_, err = GenerateImages(&config, "", year, filepath.Join(chartDir, "data.json"), filepath.Join(chartDir, "metadata.json"), renderPath, outPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := readMapFills(t, renderPath)
+				got := readMapFills(t, filepath.Join(outPath, strconv.Itoa(year), fmt.Sprintf("%d.svg", year)))
+				if len(want) == 0 {
+					t.Fatalf("%s has no map paths", renderPath)
+				}
+				for id, fill := range want {
+					if got[id] != fill {
+						t.Errorf("%d: fill of %s = %s, OWID renders %s", year, id, got[id], fill)
+					}
+				}
+			}
+		})
+	}
+}
+
+// readMapFills returns the fill of each entity path in the map of an svg
+func readMapFills(t *testing.T, svgPath string) map[string]string {
+	t.Helper()
+	b, err := os.ReadFile(svgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var svg GenericSVG
+	if err := xml.Unmarshal(b, &svg); err != nil {
+		t.Fatalf("parsing %s: %v", svgPath, err)
+	}
+
+	query := NewSVGQuery(&svg)
+	chartMap := query.Select("#map")
+	if len(chartMap) == 0 {
+		chartMap = query.Select("#globe")
+	}
+	fills := make(map[string]string)
+	if len(chartMap) == 0 {
+		return fills
+	}
+	for _, path := range chartMap[0].FindElements("path") {
+		if id := path.Attributes["id"]; id != "" {
+			fills[id] = path.Attributes["fill"]
+		}
+	}
+	return fills
+}
@@ -12,36 +12,75 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/wpmed-videowiki/OWIDImporter/entities"
 )
 
 const NO_DATA_FILL string = "url(#noDataPattern)"
 
 type ColorScale struct {
-	BaseColorScheme           string    `json:"baseColorScheme"`
-	BinningStrategy           string    `json:"binningStrategy"`
-	CustomNumericColors       []*string `json:"customNumericColors"`
-	CustomNumericLabels       []*string `json:"customNumericLabels"`
-	CustomNumericValues       []float64 `json:"customNumericValues"`
-	CustomNumericColorsActive bool      `json:"customNumericColorsActive"`
-	TimeTolerance             int       `json:"timeTolerance"`
+	BaseColorScheme           string            `json:"baseColorScheme"`
+	BinningStrategy           string            `json:"binningStrategy"`
+	BinningStrategyBinCount   int               `json:"binningStrategyBinCount"`
+	CustomNumericColors       []*string         `json:"customNumericColors"`
+	CustomNumericLabels       []*string         `json:"customNumericLabels"`
+	CustomNumericValues       []float64         `json:"customNumericValues"`
+	CustomNumericMinValue     *float64          `json:"customNumericMinValue"`
+	CustomNumericColorsActive bool              `json:"customNumericColorsActive"`
+	CustomCategoryColors      map[string]string `json:"customCategoryColors"`
+	CustomCategoryLabels      map[string]string `json:"customCategoryLabels"`
+	TimeTolerance             int               `json:"timeTolerance"`
 }
 
 // MapConfig represents the map field from the OWID grapher config
 type MapConfig struct {
 	ColorScale             ColorScale `json:"colorScale"`
 	ColumnSlug             string     `json:"columnSlug"`
+	Region                 string     `json:"region"` // Region the map opens on, World when empty
+	TimeTolerance          *int       `json:"timeTolerance"`
 	TooltipUseCustomLabels bool       `json:"tooltipUseCustomLabels"`
 }
 
-// OWIDGrapherConfig represents the full config object (we only extract the map field)
+// GetTimeTolerance returns how many years away a value can be and still color a country,
+// older configs keep it in the color scale
+func (mapConfig *MapConfig) GetTimeTolerance() int {
+	if mapConfig.TimeTolerance != nil {
+		return *mapConfig.TimeTolerance
+	}
+	return mapConfig.ColorScale.TimeTolerance
+}
+
+type Dimension struct {
+	Property   string `json:"property"`
+	VariableId int    `json:"variableId"`
+}
+
+// OWIDGrapherConfig represents the full config object (we only extract the map and its indicator)
 type OWIDGrapherConfig struct {
-	Map MapConfig `json:"map"`
+	Dimensions []Dimension `json:"dimensions"`
+	Map        MapConfig   `json:"map"`
+}
+
+// MapVariableId returns the indicator shown on the map, 0 if the config has none
+func (config *OWIDGrapherConfig) MapVariableId() int {
+	if config.Map.ColumnSlug != "" {
+		if id, err := strconv.Atoi(config.Map.ColumnSlug); err == nil {
+			return id
+		}
+	}
+	for _, dimension := range config.Dimensions {
+		if dimension.Property == "y" {
+			return dimension.VariableId
+		}
+	}
+
+	return 0
 }
 
 type Data struct {
-	Values   []float64 `json:"values"`
-	Years    []int     `json:"years"`
-	Entities []int     `json:"entities"`
+	Values   []DataValue `json:"values"`
+	Years    []int       `json:"years"`
+	Entities []int       `json:"entities"`
 }
 
 type Entity struct {
@@ -71,6 +110,7 @@ type Display struct {
 	Name      string `json:"name"`
 	Unit      string `json:"unit"`
 	ShortUnit string `json:"shortUnit"`
+	YearIsDay bool   `json:"yearIsDay"`
 }
 
 type Presentation struct {
@@ -78,11 +118,11 @@ type Presentation struct {
 }
 
 type CombinedDataPoint struct {
-	Value       float64 `json:"value"`
-	Year        int     `json:"year"`
-	EntityID    int     `json:"entityId"`
-	EntityName  string  `json:"entityName"`
-	CountryCode string  `json:"countryCode"`
+	Value       DataValue `json:"value"`
+	Year        int       `json:"year"`
+	EntityID    int       `json:"entityId"`
+	EntityName  string    `json:"entityName"`
+	CountryCode string    `json:"countryCode"`
 }
 
 // ================== START XML Handling ===================
@@ -425,27 +465,50 @@ func (q *SVGQuery) Filter(elements []*GenericElement, predicate func(*GenericEle
 	return results
 }
 
-type FillItem struct {
-	Value    float64
-	StrValue string
-	Fill     string
-}
-
-type RangeFillItem struct {
-	StartValue float64
-	EndValue   float64
-	StrValue   string
-	Fill       string
-}
-
 type WriteResult struct {
 	Path string
 	Year int
 }
 
-// Country name mapping function - you'll need to expand this
-func getCountryID(entityName string) string {
-	return strings.ReplaceAll(entityName, " ", "-")
+// getCountryIDs returns the ids the map svg may give the shape of a data point's entity
+func getCountryIDs(item CombinedDataPoint) []string {
+	entity, ok := entities.FindByCode(item.CountryCode)
+	if !ok {
+		entity, ok = entities.FindByName(item.EntityName)
+	}
+	if ok {
+		return entity.ElementIDs()
+	}
+	return []string{strings.ReplaceAll(item.EntityName, " ", "-")}
+}
+
+// FindUnmatchedEntities returns the names of the coded entities in the indicator metadata that
+// the entity registry doesn't know. Entities without a code are aggregates with no map shape
+func FindUnmatchedEntities(metadataPath string) ([]string, error) {
+	metadataBytes, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	var metadata Metadata
+	if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
+		return nil, err
+	}
+
+	unmatched := make([]string, 0)
+	for _, entity := range metadata.Dimensions.Entities.Values {
+		if entity.Code == "" {
+			continue
+		}
+		if _, ok := entities.FindByCode(entity.Code); ok {
+			continue
+		}
+		if _, ok := entities.FindByName(entity.Name); ok {
+			continue
+		}
+		unmatched = append(unmatched, entity.Name)
+	}
+
+	return unmatched, nil
 }
 
 func CleanupSVGForUpload(mapPath string) error {
@@ -532,7 +595,7 @@ func GenerateImages(config *OWIDGrapherConfig, title string, titleYear int, data
 
 	// Combine data into structured format
 	var combinedData []CombinedDataPoint
-	yearlyData := make(map[int][]CombinedDataPoint)
+	years := make(map[int]bool)
 
 	for i, value := range data.Values {
 		entityID := data.Entities[i]
@@ -554,18 +617,16 @@ func GenerateImages(config *OWIDGrapherConfig, title string, titleYear int, data
 			EntityName:  entityName,
 			CountryCode: countryCode,
 		})
-		yearlyData[data.Years[i]] = append(yearlyData[data.Years[i]], CombinedDataPoint{
-			Value:       value,
-			Year:        data.Years[i],
-			EntityID:    entityID,
-			EntityName:  entityName,
-			CountryCode: countryCode,
-		})
+		years[data.Years[i]] = true
 	}
 
+	// Countries without data in a year use their closest value within the tolerance
+	entitySeries := NewEntitySeries(combinedData)
+	timeTolerance := config.Map.GetTimeTolerance()
+
 	// Print the combined data (or process as needed)
 	for i, point := range combinedData {
-		fmt.Printf("Data point %d: %.2f in %d for %s (%s)\n",
+		fmt.Printf("Data point %d: %s in %d for %s (%s)\n",
 			i+1, point.Value, point.Year, point.EntityName, point.CountryCode)
 
 		// Print only first 10 to avoid overwhelming output
@@ -615,163 +676,16 @@ func GenerateImages(config *OWIDGrapherConfig, title string, titleYear int, data
 	pathElements := query.Select("path")
 	fmt.Printf("Query found %d path elements\n", len(pathElements))
 
-	lines2 := query.Select("#lines")
-	swatches := query.Select("#swatches")
-	labels := query.Select("#labels")
-
-	if len(lines2) == 0 || len(swatches) == 0 {
-		return nil, fmt.Errorf("Could not find legend lines or swatches in SVG")
-	}
-
-	fillMap := make([]FillItem, 0)
-	rangeFillMap := make([]RangeFillItem, 0)
-
-	// linesElements := lines2[0].GetElements()
-	swatchesElements := swatches[0].GetElements()
-
-	for index, item := range labels[0].GetElements() {
-		if index >= len(swatchesElements) {
-			break
-		}
-
-		key := item.GetTextContent()
-		if metadata.Unit != "" {
-			key = strings.ReplaceAll(key, metadata.Unit, "")
-		}
-		if metadata.ShortUnit != "" {
-			key = strings.ReplaceAll(key, metadata.ShortUnit, "")
-		}
-		// If it has ShortUnit and it contains "/" character, most probably the first part
-		// only is being used (e.g. g/day, they use only "g" in the label)
-		if strings.Contains(metadata.ShortUnit, "/") {
-			parts := strings.Split(metadata.ShortUnit, "/")
-			if len(parts) == 2 {
-				key = strings.ReplaceAll(key, parts[0], "")
-			}
-		}
-
-		if metadata.Type == "float" || metadata.Type == "int" {
-			// Check for numeric shortcuts (thousand, million)
-			numericFound := false
-			if strings.Contains(key, "millions") {
-				key = strings.ReplaceAll(key, "millions", "000000")
-				numericFound = true
-			}
-			if strings.Contains(key, "million") {
-				key = strings.ReplaceAll(key, "million", "000000")
-				numericFound = true
-			}
-			if strings.Contains(key, "thousands") {
-				key = strings.ReplaceAll(key, "thousands", "000")
-				numericFound = true
-			}
-			if strings.Contains(key, "thousand") {
-				key = strings.ReplaceAll(key, "thousand", "000")
-				numericFound = true
-			}
-
-			if numericFound {
-				key = strings.ReplaceAll(key, " ", "")
-			}
-		}
-
-		if metadata.Display.Unit != "" {
-			key = strings.ReplaceAll(key, metadata.Display.Unit, "")
-		}
-		if metadata.Display.ShortUnit != "" {
-			key = strings.ReplaceAll(key, metadata.Display.ShortUnit, "")
-		}
-
-		// Remove any spaces
-		key = strings.TrimSpace(key)
-		key = strings.ReplaceAll(key, ",", "")
-		// key = strings.ReplaceAll(key, ".", "")
-
-		floatKey, err := strconv.ParseFloat(key, 64)
-		if err != nil {
-			fmt.Println("Adding non-numeric key:", key)
-			fillMap = append(fillMap, FillItem{
-				StrValue: key,
-				Fill:     swatchesElements[index].Attributes["fill"],
-			})
-		} else {
-			fillMap = append(fillMap, FillItem{
-				Value: floatKey,
-				Fill:  swatchesElements[index].Attributes["fill"],
-			})
-		}
-	}
-
-	numericValues := config.Map.ColorScale.CustomNumericValues
-	if len(numericValues) > 0 {
-		fmt.Println("Data: labels: ", len(labels[0].GetElements()), " - Swatches", len(swatchesElements), "- numericValues: ", len(numericValues))
-		fmt.Println("Labels: ", labels[0].GetElements())
-		fmt.Println("Swatches: ", swatchesElements)
-		fmt.Println("numericValues: ", numericValues)
-		hasNoData := false
-
-		for index := range swatchesElements {
-			if index >= len(numericValues) {
-				fmt.Println("Breaking for numeric")
-				break
-			}
-			if swatchesElements[index].Attributes["fill"] == "url(#noDataPattern)" {
-				fmt.Println("Continue no data")
-				hasNoData = true
-				continue
-			}
-
-			if hasNoData {
-				rangeFillMap = append(rangeFillMap, RangeFillItem{
-					Fill:       swatchesElements[index].Attributes["fill"],
-					StartValue: numericValues[index-1],
-					EndValue:   numericValues[index],
-				})
-			} else {
-				rangeFillMap = append(rangeFillMap, RangeFillItem{
-					Fill:       swatchesElements[index].Attributes["fill"],
-					StartValue: numericValues[index],
-					EndValue:   numericValues[index+1],
-				})
-			}
-			fmt.Println("Range fill map:", rangeFillMap, index)
-		}
-	}
-
-	// Reverse the range fill map
-	slices.Reverse(rangeFillMap)
-
-	fmt.Println("=================== RANGE FILL MAP ===============", rangeFillMap)
-
-	// After collecting the fill map, check if we have custom numeric labels
-	// if so, remove the StrValue and add the value instead
-	if len(config.Map.ColorScale.CustomNumericLabels) > 0 {
-		for i := range fillMap {
-			if i == 0 {
-				continue
-			}
-			if fillMap[i].StrValue != "" && strings.ToLower(fillMap[i].StrValue) != "no data" {
-				configLabel := config.Map.ColorScale.CustomNumericLabels[i-1]
-				configLabelValue := config.Map.ColorScale.CustomNumericValues[i]
-				if configLabel != nil && *configLabel != "" {
-					fillMap[i].StrValue = ""
-					fillMap[i].Value = configLabelValue
-				}
-			}
-		}
-	}
-
-	if metadata.Unit != "" {
-		sort.SliceStable(fillMap, func(a int, b int) bool {
-			return fillMap[a].Value < fillMap[b].Value
-		})
+	legend, err := ReadLegend(query)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(fillMap) < 2 {
-		return nil, fmt.Errorf("Error finding fill map")
+	colorMapper, err := NewColorMapper(config.Map.ColorScale, &metadata, data.Values, legend)
+	if err != nil {
+		return nil, err
 	}
-
-	fmt.Println("Fill map: ", fillMap)
+	fmt.Println("Color scale bins: ", colorMapper.Bins, "categories: ", colorMapper.Categories)
 
 	// Create yearly_maps directory if it doesn't exist
 	err = os.WriteFile(fmt.Sprintf("%s/.gitkeep", outPath), []byte(""), 0755)
@@ -785,7 +699,8 @@ func GenerateImages(config *OWIDGrapherConfig, title string, titleYear int, data
 	titleYearString := fmt.Sprintf("%v", titleYear)
 	fmt.Println("================================ Title year string", titleYearString)
 
-	for year, yearData := range yearlyData {
+	for year := range years {
+		yearData := entitySeries.YearData(year, timeTolerance)
 		fmt.Printf("Processing year: %d with %d data points\n", year, len(yearData))
 
 		// Create a copy of the SVG for this year
@@ -840,19 +755,13 @@ func GenerateImages(config *OWIDGrapherConfig, title string, titleYear int, data
 
 		// Generate image for this year by replacing the colors of the data
 		for _, item := range yearData {
-			countryID := getCountryID(item.EntityName)
-
-			fillValue := ""
-			if metadata.Type == "int" && metadata.Unit == "" {
-				// Index based matching
-				fillValue = fillMap[int(item.Value)+1].Fill
-			} else {
-				fillValue = getFillValueFromRange(rangeFillMap, item.Value)
-			}
+			countryIDs := getCountryIDs(item)
+
+			fillValue := colorMapper.Fill(item.Value)
 
 			// Find the path element for this country
 			for i := range yearPathElements {
-				if yearPathElements[i].Attributes["id"] == countryID {
+				if slices.Contains(countryIDs, yearPathElements[i].Attributes["id"]) {
 					yearPathElements[i].Attributes["fill"] = fillValue
 					matchedCount++
 					break
@@ -928,79 +837,6 @@ func WriteSVGFile(yearSVG *GenericSVG, filename string) error {
 	return nil
 }
 
-func getFillValueFromRange(fillMap []RangeFillItem, value float64) string {
-	if value < 0 || value != value { // NaN check
-		return NO_DATA_FILL
-	}
-
-	// Special case, the value is 0, then find the 0 label
-	if value == 0 {
-		for _, item := range fillMap {
-			if item.StartValue == 0 && item.EndValue == 0 {
-				return item.Fill
-			}
-		}
-	}
-
-	for _, item := range fillMap {
-		if value >= item.StartValue {
-			return item.Fill
-		}
-	}
-
-	return fillMap[len(fillMap)-1].Fill
-}
-
-func getFillValue(fillMap []FillItem, value float64, expl bool) string {
-	// Handle special cases first
-	if value < 0 || value != value { // NaN check
-		for _, item := range fillMap {
-			if item.StrValue == "No-data" {
-				return item.Fill
-			}
-			if item.StrValue == "No data" {
-				return item.Fill
-			}
-		}
-		return ""
-	}
-
-	// Sort by value in descending order for proper threshold matching
-	sortedMap := make([]FillItem, 0)
-	for _, item := range fillMap {
-		if item.StrValue == "" { // Only numeric items
-			sortedMap = append(sortedMap, item)
-		}
-	}
-
-	sort.SliceStable(sortedMap, func(a, b int) bool {
-		return sortedMap[a].Value > sortedMap[b].Value
-	})
-
-	if expl {
-		fmt.Println("Sorted Map: ", sortedMap)
-	}
-	for _, item := range sortedMap {
-		if value > item.Value {
-			if expl {
-				fmt.Println("Found match", value, item.Value)
-			}
-			return item.Fill
-		} else {
-			if expl {
-				fmt.Println("No match: ", value, item.Value)
-			}
-		}
-	}
-
-	// Return the lowest threshold color if no match found
-	if len(sortedMap) > 0 {
-		return sortedMap[len(sortedMap)-1].Fill
-	}
-
-	return ""
-}
-
 // CleanupTextElements removes nested elements (like <a> tags) from <text> elements
 // and ensures each text element contains only simple text or a single tspan with text
 func CleanupTextElements(svg *GenericSVG) {
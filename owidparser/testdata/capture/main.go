@@ -0,0 +1,91 @@
+// Command capture saves an OWID chart and the maps OWID renders for it into testdata/owid,
+// for TestGenerateImagesMatchesOWID to compare the generated maps with.
+//
+//	go run ./owidparser/testdata/capture https://ourworldindata.org/grapher/<chart> <year>...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wpmed-videowiki/OWIDImporter/constants"
+	"github.com/wpmed-videowiki/OWIDImporter/owidparser"
+)
+
+func main() {
+	out := flag.String("out", filepath.Join("owidparser", "testdata", "owid"), "directory of the captured charts")
+	ua := flag.String("ua", "OWIDImporter test fixtures", "user agent of the requests to OWID")
+	flag.Parse()
+	if flag.NArg() < 2 {
+		log.Fatal("usage: capture [-out dir] [-ua agent] <chart url> <year>...")
+	}
+
+	baseUrl := strings.Split(flag.Arg(0), "?")[0]
+	chartDir := filepath.Join(*out, filepath.Base(baseUrl))
+	if err := os.MkdirAll(chartDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	configBody := fetch(*ua, baseUrl+".config.json")
+	var config owidparser.OWIDGrapherConfig
+	if err := json.Unmarshal(configBody, &config); err != nil {
+		log.Fatalf("error parsing chart config: %v", err)
+	}
+	variableId := config.MapVariableId()
+	if variableId == 0 {
+		log.Fatal("chart config has no map indicator")
+	}
+
+	save(filepath.Join(chartDir, "config.json"), configBody)
+	save(filepath.Join(chartDir, "data.json"), fetch(*ua, fmt.Sprintf("%s%d.data.json", constants.OWID_INDICATORS_API_URL, variableId)))
+	save(filepath.Join(chartDir, "metadata.json"), fetch(*ua, fmt.Sprintf("%s%d.metadata.json", constants.OWID_INDICATORS_API_URL, variableId)))
+
+	for _, arg := range flag.Args()[1:] {
+		year, err := strconv.Atoi(arg)
+		if err != nil {
+			log.Fatalf("invalid year %q", arg)
+		}
+		// The same static render the download button of the chart gives
+		save(filepath.Join(chartDir, fmt.Sprintf("%d.svg", year)), fetch(*ua, fmt.Sprintf("%s.svg?tab=map&time=%d", baseUrl, year)))
+	}
+}
+
+func fetch(ua, url string) []byte {
+	client := http.Client{Timeout: time.Minute}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	req.Header.Set("User-Agent", ua)
+
+	res, err := client.Do(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.Fatalf("%s: bad status: %s", url, res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return body
+}
+
+func save(path string, body []byte) {
+	if err := os.WriteFile(path, body, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Saved", path)
+}
@@ -0,0 +1,57 @@
+package owidparser
+
+import "sort"
+
+// EntitySeries holds the data points of every entity sorted by year
+type EntitySeries map[int][]CombinedDataPoint
+
+func NewEntitySeries(points []CombinedDataPoint) EntitySeries {
+	series := make(EntitySeries)
+	for _, point := range points {
+		series[point.EntityID] = append(series[point.EntityID], point)
+	}
+	for entityID := range series {
+		sort.SliceStable(series[entityID], func(a, b int) bool {
+			return series[entityID][a].Year < series[entityID][b].Year
+		})
+	}
+
+	return series
+}
+
+// Lookup returns the data point of the entity closest to year within tolerance years,
+// the earlier one on a tie, like the OWID map does
+func (series EntitySeries) Lookup(entityID, year, tolerance int) (CombinedDataPoint, bool) {
+	points := series[entityID]
+	// First point at or after year
+	index := sort.Search(len(points), func(i int) bool {
+		return points[i].Year >= year
+	})
+
+	var found *CombinedDataPoint
+	distance := tolerance + 1
+	if index > 0 && year-points[index-1].Year <= tolerance {
+		found = &points[index-1]
+		distance = year - points[index-1].Year
+	}
+	if index < len(points) && points[index].Year-year < distance {
+		found = &points[index]
+	}
+	if found == nil {
+		return CombinedDataPoint{}, false
+	}
+
+	return *found, true
+}
+
+// YearData returns the point of every entity that has data within tolerance of year
+func (series EntitySeries) YearData(year, tolerance int) []CombinedDataPoint {
+	yearData := make([]CombinedDataPoint, 0, len(series))
+	for entityID := range series {
+		if point, ok := series.Lookup(entityID, year, tolerance); ok {
+			yearData = append(yearData, point)
+		}
+	}
+
+	return yearData
+}
@@ -66,12 +66,13 @@ func GetChartParameters(c *gin.Context) {
 	}
 	fmt.Println("Final url: ", url)
 
-	l, browser := services.GetBrowser()
-	blankPage := browser.MustPage("")
-	defer blankPage.Close()
-	defer l.Cleanup()
-	defer browser.Close()
-	info, err := services.GetChartInfo(browser, url, "$CHART_NAME", "")
+	lease, err := services.LeaseBrowser(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get chart data"})
+		return
+	}
+	defer lease.Release()
+	info, err := services.GetChartInfo(lease.Browser, url, "$CHART_NAME", "")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get chart data"})
 		return
@@ -106,9 +107,13 @@ func GetMultiChartParameters(c *gin.Context) {
 	}
 
 	response := make([]MultiChartParametersResponse, 0)
-	l, browser := services.GetBrowser()
-	defer l.Cleanup()
-	defer browser.Close()
+	lease, err := services.LeaseBrowser(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get chart data"})
+		return
+	}
+	defer lease.Release()
+	browser := lease.Browser
 
 	for _, url := range data.Urls {
 		fmt.Println("================================== Incoming url: ", url)
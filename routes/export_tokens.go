@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EXPORT_TOKEN_TTL is how long a download link of an export can be used
+const EXPORT_TOKEN_TTL = time.Minute
+
+// exportToken lets the owner of a task download its export once without a session header
+type exportToken struct {
+	taskId    string
+	userId    string
+	expiresAt time.Time
+}
+
+var (
+	exportTokens   = make(map[string]exportToken)
+	exportTokensMu sync.Mutex
+)
+
+func newExportToken(taskId, userId string) string {
+	exportTokensMu.Lock()
+	defer exportTokensMu.Unlock()
+
+	now := time.Now()
+	for token, exportToken := range exportTokens {
+		if now.After(exportToken.expiresAt) {
+			delete(exportTokens, token)
+		}
+	}
+
+	token := uuid.New().String()
+	exportTokens[token] = exportToken{taskId: taskId, userId: userId, expiresAt: now.Add(EXPORT_TOKEN_TTL)}
+	return token
+}
+
+// takeExportToken uses up a token, it fails for unknown and expired ones
+func takeExportToken(token string) (exportToken, bool) {
+	exportTokensMu.Lock()
+	defer exportTokensMu.Unlock()
+
+	exportToken, ok := exportTokens[token]
+	delete(exportTokens, token)
+	if !ok || time.Now().After(exportToken.expiresAt) {
+		return exportToken, false
+	}
+	return exportToken, true
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wpmed-videowiki/OWIDImporter/testutil"
+)
+
+// TestMain keeps the exports in the temporary directory of the tests
+func TestMain(m *testing.M) {
+	testutil.Main(m, func(dir string) {
+		os.Setenv("OWID_EXPORT_DIR", dir)
+		gin.SetMode(gin.TestMode)
+	})
+}
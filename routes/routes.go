@@ -30,6 +30,7 @@ func BuildRoutes() *gin.Engine {
 	// Sessions
 	router.POST("/session/replace", ReplaceSession)
 	router.POST("/session/verify", VerifySession)
+	router.GET("/wiki_profiles", GetWikiProfiles)
 
 	// Tasks
 	router.GET("/task", GetTasks)
@@ -37,9 +38,18 @@ func BuildRoutes() *gin.Engine {
 	router.POST("/task/retry_all", RetryAllFailed)
 	router.POST("/task/:id/retry", RetryTask)
 	router.POST("/task/:id/cancel", CancelTask)
+	router.POST("/task/:id/pause", PauseTask)
+	router.POST("/task/:id/resume", ResumeTask)
 	// router.POST("/task/:id/upload_commons_template", GenerateCommonsTemplate)
 	router.GET("/task/:id", GetTask)
+	router.GET("/task/:id/export", DownloadTaskExport)
+	router.POST("/task/:id/export/token", CreateTaskExportToken)
 	router.PUT("/task/:id/archived", ArchiveTask)
+	router.PUT("/task/:id/priority", SetTaskPriority)
+	router.POST("/task/:id/priority/up", BumpTaskPriority)
+	router.POST("/task/:id/priority/down", LowerTaskPriority)
+	router.PUT("/task/:id/schedule", SetTaskSchedule)
+	router.PUT("/task/:id/watch", SetTaskWatch)
 
 	// Chart related info
 	router.POST("/chart/parameters", GetChartParameters)
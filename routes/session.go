@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/wpmed-videowiki/OWIDImporter/env"
+	"github.com/wpmed-videowiki/OWIDImporter/mediawiki"
 	"github.com/wpmed-videowiki/OWIDImporter/models"
 	"github.com/wpmed-videowiki/OWIDImporter/sessions"
 	"github.com/wpmed-videowiki/OWIDImporter/utils"
@@ -17,8 +19,27 @@ type ReplaceSessionData struct {
 	SessionId string `json:"sessionId"`
 }
 
+// Login starts the OAuth flow of the default wiki profile, or of the one in the wiki query param.
+// Other profiles need a logged in session (sessionId query param), their tokens are added to its user
 func Login(c *gin.Context) {
-	config := utils.GetOAuthConfig()
+	profile, ok := env.GetWikiProfile(c.Query("wiki"))
+	if !ok {
+		c.String(http.StatusBadRequest, "Unknown wiki profile")
+		return
+	}
+
+	newSession := sessions.Session{WikiProfile: profile.Name}
+	if profile.Name != env.DefaultWikiProfile {
+		existingSession, ok := sessions.Sessions[c.Query("sessionId")]
+		if !ok || existingSession.Username == "" {
+			c.String(http.StatusUnauthorized, "Log in before adding another wiki")
+			return
+		}
+		newSession.Username = existingSession.Username
+		newSession.ResourceOwnerKey = existingSession.ResourceOwnerKey
+		newSession.ResourceOwnerSecret = existingSession.ResourceOwnerSecret
+	}
+	config := utils.GetOAuthConfig(profile)
 
 	requestToken, requestSecret, err := config.RequestToken()
 	if err != nil {
@@ -26,11 +47,10 @@ func Login(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "Failed to get request token")
 		return
 	}
+	newSession.ResourceOwnerKeyTemp = requestToken
+	newSession.ResourceOwnerSecretTemp = requestSecret
 	sessionId := uuid.New().String()
-	sessions.Sessions[sessionId] = &sessions.Session{
-		ResourceOwnerKeyTemp:    requestToken,
-		ResourceOwnerSecretTemp: requestSecret,
-	}
+	sessions.Sessions[sessionId] = &newSession
 
 	authorizationURL, err := config.AuthorizationURL(requestToken)
 	if err != nil {
@@ -58,7 +78,23 @@ func Callback(c *gin.Context) {
 	oauthVerifier := c.Query("oauth_verifier")
 	oauthToken := c.Query("oauth_token")
 
-	oauth1Config := utils.GetOAuthConfig()
+	profile, ok := env.GetWikiProfile(session.WikiProfile)
+	if !ok {
+		c.String(http.StatusBadRequest, "Unknown wiki profile")
+		return
+	}
+	// Other profiles only add tokens to the user already logged in, never log in as someone else
+	var sessionUser *models.User
+	if profile.Name != env.DefaultWikiProfile {
+		if session.Username != "" {
+			sessionUser, _ = models.FindUserByUsername(session.Username)
+		}
+		if sessionUser == nil {
+			c.String(http.StatusUnauthorized, "Log in before adding another wiki")
+			return
+		}
+	}
+	oauth1Config := utils.GetOAuthConfig(profile)
 
 	accessToken, accessSecret, err := oauth1Config.AccessToken(oauthToken, session.ResourceOwnerSecretTemp, oauthVerifier)
 	if err != nil {
@@ -70,32 +106,43 @@ func Callback(c *gin.Context) {
 	user := &models.User{
 		ResourceOwnerSecret: accessSecret,
 		ResourceOwnerKey:    accessToken,
+		WikiProfile:         profile.Name,
 	}
 
-	username, err := utils.GetUsername(user)
+	username, err := mediawiki.NewClient(user).Username(context.Background())
 	if err != nil {
 		log.Println(err)
 		c.String(http.StatusInternalServerError, "Failed to get username")
 		return
 	}
-	user, err = models.FindUserByUsername(username)
-	if err != nil || user == nil {
-		_, err := models.NewUser(username, accessToken, accessSecret)
-		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to create user record")
-			fmt.Println("Error creating user", err)
-			return
+
+	if profile.Name == env.DefaultWikiProfile {
+		user, err = models.FindUserByUsername(username)
+		if err != nil || user == nil {
+			_, err := models.NewUser(username, accessToken, accessSecret)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "Failed to create user record")
+				fmt.Println("Error creating user", err)
+				return
+			}
+		} else {
+			user.ResourceOwnerKey = accessToken
+			user.ResourceOwnerSecret = accessSecret
+			user.Update()
 		}
+		session.Username = username
+		session.ResourceOwnerKey = accessToken
+		session.ResourceOwnerSecret = accessSecret
 	} else {
-		user.ResourceOwnerKey = accessToken
-		user.ResourceOwnerSecret = accessSecret
-		user.Update()
+		// The session keeps its user and tokens, the ones of this wiki are stored for the user
+		if err := models.SaveUserWikiToken(sessionUser.ID, profile.Name, accessToken, accessSecret); err != nil {
+			c.String(http.StatusInternalServerError, "Failed to save wiki profile tokens")
+			fmt.Println("Error saving user wiki token", err)
+			return
+		}
 	}
 
-	fmt.Println("User info", username)
-	session.Username = username
-	session.ResourceOwnerKey = accessToken
-	session.ResourceOwnerSecret = accessSecret
+	fmt.Println("User info", username, "on", profile.Name)
 	sessions.Sessions[sessionId] = session
 
 	if env.GetEnv().OWID_ENV == "development" {
@@ -144,13 +191,16 @@ func ReplaceSession(c *gin.Context) {
 	delete(sessions.Sessions, data.SessionId)
 
 	user, err := models.FindUserByUsername(session.Username)
+	if err == nil {
+		user, err = user.WithWikiProfile(session.WikiProfile)
+	}
 	if err != nil {
 		fmt.Println("Error getting user", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot get user info"})
 		return
 	}
 
-	username, err := utils.GetUsername(user)
+	username, err := mediawiki.NewClient(user).Username(context.Background())
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot get username"})
@@ -174,13 +224,16 @@ func VerifySession(c *gin.Context) {
 	}
 
 	user, err := models.FindUserByUsername(session.Username)
+	if err == nil {
+		user, err = user.WithWikiProfile(session.WikiProfile)
+	}
 	if err != nil {
 		fmt.Println("Error getting user", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot get user info"})
 		return
 	}
 
-	username, err := utils.GetUsername(user)
+	username, err := mediawiki.NewClient(user).Username(context.Background())
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Session expired, please login again"})
@@ -189,3 +242,28 @@ func VerifySession(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"username": username})
 }
+
+type WikiProfileResponse struct {
+	env.WikiProfile
+	LoggedIn bool `json:"loggedIn"` // the session's user has tokens for the profile
+}
+
+// GetWikiProfiles lists the wikis tasks can import into
+func GetWikiProfiles(c *gin.Context) {
+	var user *models.User
+	if session, ok := sessions.Sessions[c.Request.Header.Get("sessionId")]; ok {
+		user, _ = models.FindUserByUsername(session.Username)
+	}
+
+	profiles := make([]WikiProfileResponse, 0)
+	for _, profile := range env.GetWikiProfiles() {
+		res := WikiProfileResponse{WikiProfile: profile}
+		if user != nil {
+			_, err := user.WithWikiProfile(profile.Name)
+			res.LoggedIn = err == nil
+		}
+		profiles = append(profiles, res)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profiles": profiles})
+}
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+	"github.com/wpmed-videowiki/OWIDImporter/sessions"
+)
+
+func TestLoginToAnotherWikiNeedsLoggedInSession(t *testing.T) {
+	anonymousSession := uuid.New().String()
+	sessions.Sessions[anonymousSession] = &sessions.Session{}
+	t.Cleanup(func() { delete(sessions.Sessions, anonymousSession) })
+
+	router := gin.New()
+	router.GET("/login", Login)
+
+	for _, path := range []string{
+		"/login?wiki=testwiki",
+		"/login?wiki=testwiki&sessionId=unknown",
+		"/login?wiki=testwiki&sessionId=" + anonymousSession,
+	} {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+		if res.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusUnauthorized, res.Code)
+		}
+	}
+}
+
+func TestCallbackOfAnotherWikiNeedsLoggedInSession(t *testing.T) {
+	router := gin.New()
+	router.GET("/callback", Callback)
+
+	tests := []struct {
+		name     string
+		username string
+	}{
+		{name: "without user"},
+		{name: "unknown user", username: "unknown-" + uuid.New().String()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sessionId := uuid.New().String()
+			sessions.Sessions[sessionId] = &sessions.Session{Username: test.username, WikiProfile: "testwiki"}
+			t.Cleanup(func() { delete(sessions.Sessions, sessionId) })
+
+			req := httptest.NewRequest(http.MethodGet, "/callback?oauth_token=token&oauth_verifier=verifier", nil)
+			req.AddCookie(&http.Cookie{Name: sessions.SessionCookieName, Value: sessionId})
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			if res.Code != http.StatusUnauthorized {
+				t.Errorf("expected status %d, got %d", http.StatusUnauthorized, res.Code)
+			}
+			session := sessions.Sessions[sessionId]
+			if session.Username != test.username || session.ResourceOwnerKey != "" || session.ResourceOwnerSecret != "" {
+				t.Errorf("rejected callback changed the session: %+v", session)
+			}
+			if user, _ := models.FindUserByUsername(test.username); test.username != "" && user != nil {
+				t.Errorf("rejected callback created user %s", test.username)
+			}
+		})
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"math"
 	"net/http"
 	"strconv"
+	"time"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wpmed-videowiki/OWIDImporter/env"
 	"github.com/wpmed-videowiki/OWIDImporter/models"
 	"github.com/wpmed-videowiki/OWIDImporter/services"
 	"github.com/wpmed-videowiki/OWIDImporter/sessions"
@@ -26,12 +29,25 @@ type CreateTaskData struct {
 	GenerateTemplateCommons              bool                                 `json:"generateTemplateCommons"`
 	ChartParameters                      string                               `json:"chartParameters"`    // query string for the chart params
 	TemplateNameFormat                   string                               `json:"templateNameFormat"` // formatting for OWID Template name
+	ImportMode                           models.TaskImportMode                `json:"importMode"`         // browser or data, maps only
+	TimeTolerance                        *int                                 `json:"timeTolerance"`      // overrides the chart's time tolerance in data mode
+	YearFilter                           models.YearFilter                    `json:"yearFilter"`         // years to import for maps, all when empty
+	Regions                              []string                             `json:"regions"`            // map regions to import, e.g. World, Africa. The default ones when empty
+	CountryFilter                        models.CountryFilter                 `json:"countryFilter"`      // country codes or presets (EU27, G20, Sub-Saharan Africa) to include/exclude
+	CategoryFileNames                    models.CategoryFileNames             `json:"categoryFileNames"`  // file names of aggregates, income groups and subnational units, keyed by category
+	DryRun                               bool                                 `json:"dryRun"`             // plan the uploads without writing to Commons
+	Destination                          models.TaskDestination               `json:"destination"`        // commons or local, local writes the files to a downloadable archive instead
+	WikiProfile                          string                               `json:"wikiProfile"`        // wiki profile to import into, the default one when empty
 }
 
 type GetTaskResponse struct {
-	Task      models.Task          `json:"task"`
-	Processes []models.TaskProcess `json:"processes"`
-	WikiText  string               `json:"wikiText"`
+	Task              models.Task                  `json:"task"`
+	Processes         []models.TaskProcess         `json:"processes"`
+	WikiText          string                       `json:"wikiText"`
+	Schedule          *models.TaskSchedule         `json:"schedule"`
+	Watch             *models.ChartFingerprint     `json:"watch"`
+	UnmatchedEntities []models.TaskUnmatchedEntity `json:"unmatchedEntities"` // entity names the task couldn't import
+	ExportUrl         string                       `json:"exportUrl"`         // zip archive of a finished local export
 }
 
 func CreateTask(c *gin.Context) {
@@ -79,29 +95,141 @@ func CreateTask(c *gin.Context) {
 		generateTemplateCommons = 1
 	}
 
-	task, err := models.NewTask(
-		user.ID,
-		data.Url,
-		data.FileName,
-		data.Description,
-		data.DescriptionOverwriteBehaviour,
-		"",
-		models.TaskStatusQueued,
-		modelType,
-		importCountries,
-		data.CountryFileName,
-		data.CountryDescription,
-		data.CountryDescriptionOverwriteBehaviour,
-		generateTemplateCommons,
-		data.ChartParameters,
-		data.TemplateNameFormat,
-	)
+	dryRun := 0
+	if data.DryRun {
+		dryRun = 1
+	}
+
+	switch data.ImportMode {
+	case "", models.TaskImportModeBrowser:
+		data.ImportMode = models.TaskImportModeBrowser
+	case models.TaskImportModeData:
+		if modelType != models.TaskTypeMap {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Data import mode is only available for maps"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import mode"})
+		return
+	}
+
+	profile, ok := env.GetWikiProfile(data.WikiProfile)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wiki profile"})
+		return
+	}
+	if _, err := user.WithWikiProfile(profile.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Please log in to " + profile.Name + " first"})
+		return
+	}
+	if data.TemplateNameFormat == "" {
+		data.TemplateNameFormat = profile.TemplateNameFormat
+	}
+	if data.Description == "" {
+		data.Description = profile.Description
+	}
+
+	switch data.Destination {
+	case "", models.TaskDestinationCommons:
+		data.Destination = models.TaskDestinationCommons
+	case models.TaskDestinationLocal:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid destination"})
+		return
+	}
+
+	timeTolerance := -1
+	if data.TimeTolerance != nil {
+		if *data.TimeTolerance < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time tolerance"})
+			return
+		}
+		timeTolerance = *data.TimeTolerance
+	}
+
+	if !data.YearFilter.IsEmpty() {
+		if modelType != models.TaskTypeMap {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Year filter is only available for maps"})
+			return
+		}
+		if err := data.YearFilter.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year filter: " + err.Error()})
+			return
+		}
+	}
+
+	regions := make(models.RegionList, 0, len(data.Regions))
+	if len(data.Regions) > 0 {
+		if modelType != models.TaskTypeMap {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Regions are only available for maps"})
+			return
+		}
+		// The regions are checked against the chart once the task runs
+		seenRegions := make(map[string]bool)
+		for _, region := range data.Regions {
+			if !isValidRegionName(region) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid region " + region})
+				return
+			}
+			if !seenRegions[region] {
+				seenRegions[region] = true
+				regions = append(regions, region)
+			}
+		}
+	}
+
+	if _, err := services.ExpandCountryCodes(data.CountryFilter.Include); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid country filter: " + err.Error()})
+		return
+	}
+	if _, err := services.ExpandCountryCodes(data.CountryFilter.Exclude); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid country filter: " + err.Error()})
+		return
+	}
+
+	for category, fileName := range data.CategoryFileNames {
+		if !services.IsImportableCategory(category) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity category " + category})
+			return
+		}
+		if fileName == "" {
+			delete(data.CategoryFileNames, category)
+		}
+	}
+
+	task, err := models.NewTask(models.NewTaskOptions{
+		UserId:                               user.ID,
+		URL:                                  data.Url,
+		FileName:                             data.FileName,
+		Description:                          data.Description,
+		DescriptionOverwriteBehaviour:        data.DescriptionOverwriteBehaviour,
+		Status:                               models.TaskStatusQueued,
+		Type:                                 modelType,
+		ImportCountries:                      importCountries,
+		CountryFileName:                      data.CountryFileName,
+		CountryDescription:                   data.CountryDescription,
+		CountryDescriptionOverwriteBehaviour: data.CountryDescriptionOverwriteBehaviour,
+		GenerateTemplateCommons:              generateTemplateCommons,
+		ChartParameters:                      data.ChartParameters,
+		CommonsTemplateNameFormat:            data.TemplateNameFormat,
+		ImportMode:                           data.ImportMode,
+		TimeTolerance:                        timeTolerance,
+		YearFilter:                           data.YearFilter,
+		Regions:                              regions,
+		CountryFilter:                        data.CountryFilter,
+		CategoryFileNames:                    data.CategoryFileNames,
+		DryRun:                               dryRun,
+		Destination:                          data.Destination,
+		WikiProfile:                          profile.Name,
+	})
 	if err != nil {
 		fmt.Println("Error creating task ", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Error creating task"})
 		return
 	}
 
+	utils.SendWSQueuePositions()
+
 	// go func() {
 	// 	switch task.Type {
 	// 	case models.TaskTypeMap:
@@ -150,10 +278,28 @@ func GetTask(c *gin.Context) {
 		fmt.Println("Error getting task processes: ", err)
 	}
 
+	if task.Status == models.TaskStatusQueued {
+		position, err := models.FindTaskQueuePosition(task)
+		if err != nil {
+			fmt.Println("Error getting task queue position", taskId, err)
+		}
+		task.QueuePosition = position
+	}
+
+	schedule, _ := models.FindTaskScheduleByTaskId(taskId)
+	watch, _ := models.FindChartFingerprint(services.GetChartWatchUrl(task), task.UserId)
+	unmatchedEntities, err := models.FindTaskUnmatchedEntities(taskId)
+	if err != nil {
+		fmt.Println("Error getting task unmatched entities: ", err)
+	}
+
 	res := GetTaskResponse{
-		Task:      *task,
-		Processes: processes,
-		WikiText:  "",
+		Task:              *task,
+		Processes:         processes,
+		WikiText:          "",
+		Schedule:          schedule,
+		Watch:             watch,
+		UnmatchedEntities: unmatchedEntities,
 	}
 	if task.Status == models.TaskStatusDone {
 		switch task.Type {
@@ -170,11 +316,106 @@ func GetTask(c *gin.Context) {
 			}
 			res.WikiText = text
 		}
+
+		if services.HasTaskExport(task) {
+			res.ExportUrl = fmt.Sprintf("/task/%s/export", task.ID)
+		}
 	}
 
 	c.JSON(http.StatusOK, res)
 }
 
+// CreateTaskExportToken returns a link to the export of a task that works once for a short time,
+// so it can be downloaded with a plain link without putting the session in the url
+func CreateTaskExportToken(c *gin.Context) {
+	sessionId := c.Request.Header.Get("sessionId")
+
+	if sessionId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	session, ok := sessions.Sessions[sessionId]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown session"})
+		return
+	}
+	user, err := models.FindUserByUsername(session.Username)
+	if err != nil || user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user"})
+		return
+	}
+
+	task, ok := findTaskExport(c, user.ID)
+	if !ok {
+		return
+	}
+
+	token := newExportToken(task.ID, user.ID)
+	c.JSON(http.StatusOK, gin.H{"url": fmt.Sprintf("/task/%s/export?token=%s", task.ID, token)})
+}
+
+// DownloadTaskExport sends the zip archive of a task that was exported to a local directory, only to
+// the task's owner. The owner comes from the sessionId header, or from a token of CreateTaskExportToken
+func DownloadTaskExport(c *gin.Context) {
+	userId := ""
+	if token := c.Query("token"); token != "" {
+		exportToken, ok := takeExportToken(token)
+		if !ok || exportToken.taskId != c.Param("id") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired download link"})
+			return
+		}
+		userId = exportToken.userId
+	} else {
+		sessionId := c.Request.Header.Get("sessionId")
+
+		if sessionId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+			return
+		}
+
+		session, ok := sessions.Sessions[sessionId]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown session"})
+			return
+		}
+		user, err := models.FindUserByUsername(session.Username)
+		if err != nil || user == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user"})
+			return
+		}
+		userId = user.ID
+	}
+
+	task, ok := findTaskExport(c, userId)
+	if !ok {
+		return
+	}
+
+	c.FileAttachment(services.TaskExportArchive(task.ID), fmt.Sprintf("owid-export-%s.zip", task.ID))
+}
+
+// findTaskExport finds the task of the request if userId owns it and it has an export, responding otherwise
+func findTaskExport(c *gin.Context, userId string) (*models.Task, bool) {
+	task, err := models.FindTaskById(c.Param("id"))
+	if err != nil || task == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cannot find task"})
+		return nil, false
+	}
+
+	if task.UserId != userId {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot download another user's export"})
+		return nil, false
+	}
+
+	if task.Status != models.TaskStatusDone || !services.HasTaskExport(task) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Task has no export"})
+		return nil, false
+	}
+
+	return task, true
+}
+
 func GetTasks(c *gin.Context) {
 	sessionId := c.Request.Header.Get("sessionId")
 
@@ -287,6 +528,232 @@ func ArchiveTask(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"task": task})
 }
 
+type TaskPriorityData struct {
+	Priority int `json:"priority"`
+}
+
+func SetTaskPriority(c *gin.Context) {
+	var data TaskPriorityData
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading data"})
+		return
+	}
+
+	changeTaskPriority(c, func(priority int) int {
+		return data.Priority
+	})
+}
+
+func BumpTaskPriority(c *gin.Context) {
+	changeTaskPriority(c, func(priority int) int {
+		return priority + 1
+	})
+}
+
+func LowerTaskPriority(c *gin.Context) {
+	changeTaskPriority(c, func(priority int) int {
+		return priority - 1
+	})
+}
+
+func changeTaskPriority(c *gin.Context, getPriority func(priority int) int) {
+	sessionId := c.Request.Header.Get("sessionId")
+
+	if sessionId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	session, ok := sessions.Sessions[sessionId]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown session"})
+		return
+	}
+	user, err := models.FindUserByUsername(session.Username)
+	if err != nil || user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user"})
+		return
+	}
+
+	taskId := c.Param("id")
+	task, err := models.FindTaskById(taskId)
+	if err != nil || task == nil {
+		fmt.Println("Error changing task priority: ", err, task)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error changing task priority"})
+		return
+	}
+
+	if task.UserId != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change priority of another user's task"})
+		return
+	}
+
+	if task.Status != models.TaskStatusQueued {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only queued tasks can be reordered"})
+		return
+	}
+
+	priority := getPriority(task.Priority)
+	if priority < models.TaskPriorityMin {
+		priority = models.TaskPriorityMin
+	}
+	if priority > models.TaskPriorityMax {
+		priority = models.TaskPriorityMax
+	}
+
+	if err := models.UpdateTaskPriority(task.ID, priority); err != nil {
+		fmt.Println("Error updating task priority", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error changing task priority"})
+		return
+	}
+	task.Priority = priority
+	task.QueuePosition, _ = models.FindTaskQueuePosition(task)
+	utils.SendWSQueuePositions()
+
+	c.JSON(http.StatusOK, gin.H{"task": task})
+}
+
+type TaskScheduleData struct {
+	IntervalDays int `json:"intervalDays"` // 0 disables the schedule
+}
+
+func SetTaskSchedule(c *gin.Context) {
+	sessionId := c.Request.Header.Get("sessionId")
+
+	if sessionId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	session, ok := sessions.Sessions[sessionId]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown session"})
+		return
+	}
+	user, err := models.FindUserByUsername(session.Username)
+	if err != nil || user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user"})
+		return
+	}
+
+	taskId := c.Param("id")
+	task, err := models.FindTaskById(taskId)
+	if err != nil || task == nil {
+		fmt.Println("Error scheduling task: ", err, task)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error scheduling task"})
+		return
+	}
+
+	if task.UserId != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot schedule another user's task"})
+		return
+	}
+
+	var data TaskScheduleData
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading data"})
+		return
+	}
+
+	schedule, err := models.FindTaskScheduleByTaskId(task.ID)
+	if err != nil || schedule == nil {
+		if data.IntervalDays <= 0 {
+			c.JSON(http.StatusOK, gin.H{"schedule": nil})
+			return
+		}
+
+		schedule, err = models.NewTaskSchedule(task.ID, user.ID, data.IntervalDays)
+		if err != nil {
+			fmt.Println("Error creating task schedule", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error scheduling task"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"schedule": schedule})
+		return
+	}
+
+	if data.IntervalDays <= 0 {
+		schedule.Active = 0
+	} else {
+		schedule.Active = 1
+		schedule.IntervalDays = data.IntervalDays
+		schedule.NextRunAt = time.Unix(schedule.LastRunAt, 0).AddDate(0, 0, data.IntervalDays).Unix()
+		if schedule.LastRunAt == 0 {
+			schedule.NextRunAt = time.Unix(schedule.CreatedAt, 0).AddDate(0, 0, data.IntervalDays).Unix()
+		}
+	}
+
+	if err := schedule.Update(); err != nil {
+		fmt.Println("Error updating task schedule", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error scheduling task"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule})
+}
+
+type TaskWatchData struct {
+	Watch bool `json:"watch"`
+}
+
+func SetTaskWatch(c *gin.Context) {
+	sessionId := c.Request.Header.Get("sessionId")
+
+	if sessionId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	session, ok := sessions.Sessions[sessionId]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown session"})
+		return
+	}
+	user, err := models.FindUserByUsername(session.Username)
+	if err != nil || user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user"})
+		return
+	}
+
+	taskId := c.Param("id")
+	task, err := models.FindTaskById(taskId)
+	if err != nil || task == nil {
+		fmt.Println("Error watching task: ", err, task)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error watching task"})
+		return
+	}
+
+	if task.UserId != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot watch another user's task"})
+		return
+	}
+
+	var data TaskWatchData
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading data"})
+		return
+	}
+
+	if !data.Watch {
+		if err := models.DeleteChartFingerprint(services.GetChartWatchUrl(task), user.ID); err != nil {
+			fmt.Println("Error removing chart watch", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error watching task"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"watch": nil})
+		return
+	}
+
+	fingerprint, err := services.WatchTaskChart(task)
+	if err != nil {
+		fmt.Println("Error watching chart", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading chart data from OWID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"watch": fingerprint})
+}
+
 func RetryTask(c *gin.Context) {
 	sessionId := c.Request.Header.Get("sessionId")
 
@@ -319,8 +786,13 @@ func RetryTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Error retrying task"})
 		return
 	}
+	if services.IsTaskRunning(task.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Task is still stopping"})
+		return
+	}
 	models.FailProcessingTaskProcesses(task.ID)
 	models.UpdateTaskLastOperationAt(task.ID)
+	task.CancelledAt = ""
 	task.Status = models.TaskStatusQueued
 	task.Update()
 	utils.SendWSTask(task)
@@ -393,12 +865,120 @@ func CancelTask(c *gin.Context) {
 		return
 	}
 
-	task.Status = models.TaskStatusCancelled
+	// A running task stops its browsers and uploads right away, then saves and sends its final state itself
+	if !services.CancelTaskRuntime(task.ID) {
+		task.Status = models.TaskStatusCancelled
+		if err := task.Update(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error stopping task"})
+			return
+		}
+		utils.SendWSTask(task)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"taskId": task.ID})
+}
+
+func PauseTask(c *gin.Context) {
+	sessionId := c.Request.Header.Get("sessionId")
+
+	if sessionId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	session, ok := sessions.Sessions[sessionId]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown session"})
+		return
+	}
+	user, err := models.FindUserByUsername(session.Username)
+	if err != nil || user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user"})
+		return
+	}
+
+	taskId := c.Param("id")
+	task, err := models.FindTaskById(taskId)
+	if err != nil || task == nil {
+		fmt.Println("Error pausing task: ", err, task)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error pausing task"})
+		return
+	}
+
+	if task.UserId != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot pause another user's task"})
+		return
+	}
+
+	if task.Status != models.TaskStatusQueued && task.Status != models.TaskStatusProcessing {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only queued or processing tasks can be paused"})
+		return
+	}
+
+	// A running task stops its browsers and uploads right away, then saves and sends its final state itself
+	if !services.PauseTaskRuntime(task.ID) {
+		task.Status = models.TaskStatusPaused
+		if err := task.Update(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error pausing task"})
+			return
+		}
+		utils.SendWSTask(task)
+	}
+	utils.SendWSQueuePositions()
+
+	c.JSON(http.StatusOK, gin.H{"taskId": task.ID})
+}
+
+func ResumeTask(c *gin.Context) {
+	sessionId := c.Request.Header.Get("sessionId")
+
+	if sessionId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	session, ok := sessions.Sessions[sessionId]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown session"})
+		return
+	}
+	user, err := models.FindUserByUsername(session.Username)
+	if err != nil || user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user"})
+		return
+	}
+
+	taskId := c.Param("id")
+	task, err := models.FindTaskById(taskId)
+	if err != nil || task == nil {
+		fmt.Println("Error resuming task: ", err, task)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error resuming task"})
+		return
+	}
+
+	if task.UserId != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot resume another user's task"})
+		return
+	}
+
+	if task.Status != models.TaskStatusPaused {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only paused tasks can be resumed"})
+		return
+	}
+	if services.IsTaskRunning(task.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Task is still pausing"})
+		return
+	}
+
+	// Back in the queue, already processed task processes and region checkpoints are kept
+	task.LastOperationAt = time.Now().Unix()
+	task.Status = models.TaskStatusQueued
 	if err := task.Update(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Error stopping task"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error resuming task"})
 		return
 	}
 	utils.SendWSTask(task)
+	utils.SendWSQueuePositions()
 
 	c.JSON(http.StatusOK, gin.H{"taskId": task.ID})
 }
@@ -433,3 +1013,16 @@ func CancelTask(c *gin.Context) {
 // 	services.CreateCommonsTemplatePage(taskId, user)
 // 	c.JSON(http.StatusOK, gin.H{"taskId": task.ID})
 // }
+
+// isValidRegionName checks the region looks like an OWID map region, e.g. NorthAmerica
+func isValidRegionName(region string) bool {
+	if region == "" {
+		return false
+	}
+	for _, r := range region {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+	"github.com/wpmed-videowiki/OWIDImporter/services"
+	"github.com/wpmed-videowiki/OWIDImporter/sessions"
+	"github.com/wpmed-videowiki/OWIDImporter/testutil"
+)
+
+func newRoutesTestSession(t *testing.T) (*models.User, string) {
+	user := testutil.NewUser(t)
+	sessionId := uuid.New().String()
+	sessions.Sessions[sessionId] = &sessions.Session{Username: user.Username}
+	t.Cleanup(func() { delete(sessions.Sessions, sessionId) })
+
+	return user, sessionId
+}
+
+func newExportTestRouter() *gin.Engine {
+	router := gin.New()
+	router.GET("/task/:id/export", DownloadTaskExport)
+	router.POST("/task/:id/export/token", CreateTaskExportToken)
+	return router
+}
+
+func newExportTestTask(t *testing.T, owner *models.User) *models.Task {
+	task := testutil.NewTask(t, models.NewTaskOptions{UserId: owner.ID, Status: models.TaskStatusDone, ImportMode: models.TaskImportModeData, Destination: models.TaskDestinationLocal})
+	if err := os.WriteFile(services.TaskExportArchive(task.ID), []byte("zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func TestDownloadTaskExportIsOwnerOnly(t *testing.T) {
+	owner, ownerSession := newRoutesTestSession(t)
+	_, otherSession := newRoutesTestSession(t)
+	task := newExportTestTask(t, owner)
+
+	router := newExportTestRouter()
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{name: "without session", path: "/task/" + task.ID + "/export", want: http.StatusBadRequest},
+		{name: "unknown session", path: "/task/" + task.ID + "/export", header: "unknown", want: http.StatusBadRequest},
+		{name: "another user", path: "/task/" + task.ID + "/export", header: otherSession, want: http.StatusForbidden},
+		{name: "session in the query", path: "/task/" + task.ID + "/export?sessionId=" + ownerSession, want: http.StatusBadRequest},
+		{name: "unknown task", path: "/task/unknown/export", header: ownerSession, want: http.StatusNotFound},
+		{name: "owner", path: "/task/" + task.ID + "/export", header: ownerSession, want: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.header != "" {
+				req.Header.Set("sessionId", test.header)
+			}
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			if res.Code != test.want {
+				t.Errorf("expected status %d, got %d: %s", test.want, res.Code, res.Body.String())
+			}
+			if test.want == http.StatusOK && res.Body.String() != "zip" {
+				t.Errorf("expected the export archive, got %q", res.Body.String())
+			}
+		})
+	}
+}
+
+func requestWithSession(router *gin.Engine, method, path, sessionId string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if sessionId != "" {
+		req.Header.Set("sessionId", sessionId)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestDownloadTaskExportWithToken(t *testing.T) {
+	owner, ownerSession := newRoutesTestSession(t)
+	_, otherSession := newRoutesTestSession(t)
+	task := newExportTestTask(t, owner)
+	other := newExportTestTask(t, owner)
+	router := newExportTestRouter()
+
+	if res := requestWithSession(router, http.MethodPost, "/task/"+task.ID+"/export/token", otherSession); res.Code != http.StatusForbidden {
+		t.Errorf("expected another user not to get a download link, got %d", res.Code)
+	}
+
+	newLink := func() string {
+		res := requestWithSession(router, http.MethodPost, "/task/"+task.ID+"/export/token", ownerSession)
+		var body struct {
+			Url string `json:"url"`
+		}
+		if res.Code != http.StatusOK || json.Unmarshal(res.Body.Bytes(), &body) != nil || body.Url == "" {
+			t.Fatalf("expected a download link, got %d: %s", res.Code, res.Body.String())
+		}
+		return body.Url
+	}
+
+	link := newLink()
+	if res := requestWithSession(router, http.MethodGet, link, ""); res.Code != http.StatusOK || res.Body.String() != "zip" {
+		t.Errorf("expected the export archive, got %d: %s", res.Code, res.Body.String())
+	}
+	if res := requestWithSession(router, http.MethodGet, link, ""); res.Code != http.StatusForbidden {
+		t.Errorf("expected a used link to be rejected, got %d", res.Code)
+	}
+
+	// A token only opens the task it was made for
+	link = newLink()
+	otherLink := strings.Replace(link, task.ID, other.ID, 1)
+	if res := requestWithSession(router, http.MethodGet, otherLink, ""); res.Code != http.StatusForbidden {
+		t.Errorf("expected the link of another task to be rejected, got %d", res.Code)
+	}
+
+	link = newLink()
+	token := link[strings.Index(link, "token=")+len("token="):]
+	exportTokensMu.Lock()
+	expired := exportTokens[token]
+	expired.expiresAt = time.Now().Add(-time.Second)
+	exportTokens[token] = expired
+	exportTokensMu.Unlock()
+	if res := requestWithSession(router, http.MethodGet, link, ""); res.Code != http.StatusForbidden {
+		t.Errorf("expected an expired link to be rejected, got %d", res.Code)
+	}
+}
+
+func TestRetryTaskKeepsCheckpoints(t *testing.T) {
+	owner, ownerSession := newRoutesTestSession(t)
+	task := testutil.NewTask(t, models.NewTaskOptions{UserId: owner.ID, Status: models.TaskStatusFailed, ImportMode: models.TaskImportModeData})
+	if err := models.SaveTaskCheckpoint(task.ID, "World", "2005", "2005"); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/task/:id/retry", RetryTask)
+	if res := requestWithSession(router, http.MethodPost, "/task/"+task.ID+"/retry", ownerSession); res.Code != http.StatusOK {
+		t.Fatalf("expected the retry to succeed, got %d: %s", res.Code, res.Body.String())
+	}
+
+	// The retried run resumes where the failed one stopped
+	if _, err := models.FindTaskCheckpoint(task.ID, "World"); err != nil {
+		t.Errorf("expected the checkpoint to be kept on retry: %v", err)
+	}
+}
+
+func TestCancelTaskLeavesRunningTaskToItsRuntime(t *testing.T) {
+	owner, ownerSession := newRoutesTestSession(t)
+	router := gin.New()
+	router.POST("/task/:id/cancel", CancelTask)
+
+	queued := testutil.NewTask(t, models.NewTaskOptions{UserId: owner.ID, Status: models.TaskStatusQueued})
+	if res := requestWithSession(router, http.MethodPost, "/task/"+queued.ID+"/cancel", ownerSession); res.Code != http.StatusOK {
+		t.Fatalf("expected the cancel to succeed, got %d: %s", res.Code, res.Body.String())
+	}
+	if saved, _ := models.FindTaskById(queued.ID); saved.Status != models.TaskStatusCancelled {
+		t.Errorf("expected a task that isn't running to be cancelled right away, got %s", saved.Status)
+	}
+
+	running := testutil.NewTask(t, models.NewTaskOptions{UserId: owner.ID, Status: models.TaskStatusProcessing})
+	ctx, runtime := services.StartTaskRuntime(context.Background(), running.ID)
+	defer runtime.Stop()
+	if res := requestWithSession(router, http.MethodPost, "/task/"+running.ID+"/cancel", ownerSession); res.Code != http.StatusOK {
+		t.Fatalf("expected the cancel to succeed, got %d: %s", res.Code, res.Body.String())
+	}
+	if !services.IsTaskCancelled(ctx) {
+		t.Error("expected the runtime to be cancelled")
+	}
+	// The runtime saves the final status once it stopped
+	if saved, _ := models.FindTaskById(running.ID); saved.Status != models.TaskStatusProcessing {
+		t.Errorf("expected the status to be left to the runtime, got %s", saved.Status)
+	}
+}
+
+func TestPauseTaskLeavesRunningTaskToItsRuntime(t *testing.T) {
+	owner, ownerSession := newRoutesTestSession(t)
+	router := gin.New()
+	router.POST("/task/:id/pause", PauseTask)
+
+	queued := testutil.NewTask(t, models.NewTaskOptions{UserId: owner.ID, Status: models.TaskStatusQueued})
+	if res := requestWithSession(router, http.MethodPost, "/task/"+queued.ID+"/pause", ownerSession); res.Code != http.StatusOK {
+		t.Fatalf("expected the pause to succeed, got %d: %s", res.Code, res.Body.String())
+	}
+	if saved, _ := models.FindTaskById(queued.ID); saved.Status != models.TaskStatusPaused {
+		t.Errorf("expected a task that isn't running to be paused right away, got %s", saved.Status)
+	}
+
+	running := testutil.NewTask(t, models.NewTaskOptions{UserId: owner.ID, Status: models.TaskStatusProcessing})
+	ctx, runtime := services.StartTaskRuntime(context.Background(), running.ID)
+	defer runtime.Stop()
+	if res := requestWithSession(router, http.MethodPost, "/task/"+running.ID+"/pause", ownerSession); res.Code != http.StatusOK {
+		t.Fatalf("expected the pause to succeed, got %d: %s", res.Code, res.Body.String())
+	}
+	if !services.IsTaskPaused(ctx) {
+		t.Error("expected the runtime to be paused")
+	}
+	// The runtime saves the final status once it stopped
+	if saved, _ := models.FindTaskById(running.ID); saved.Status != models.TaskStatusProcessing {
+		t.Errorf("expected the status to be left to the runtime, got %s", saved.Status)
+	}
+}
@@ -0,0 +1,11 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/wpmed-videowiki/OWIDImporter/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, nil)
+}
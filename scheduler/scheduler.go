@@ -0,0 +1,231 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+	"github.com/wpmed-videowiki/OWIDImporter/services"
+	"github.com/wpmed-videowiki/OWIDImporter/utils"
+)
+
+const (
+	POLL_INTERVAL          = time.Second * 10
+	SCHEDULE_POLL_INTERVAL = time.Minute
+)
+
+// Scheduler starts queued tasks while keeping at most Slots tasks processing
+// globally and at most UserLimit tasks processing for a single user
+type Scheduler struct {
+	Slots     int
+	UserLimit int
+
+	running sync.WaitGroup
+}
+
+func New(slots, userLimit int) *Scheduler {
+	if slots < 1 {
+		slots = 1
+	}
+	if userLimit < 1 {
+		userLimit = 1
+	}
+
+	return &Scheduler{
+		Slots:     slots,
+		UserLimit: userLimit,
+	}
+}
+
+// Run starts queued tasks until ctx is done, running tasks get ctx to stop on shutdown
+func (s *Scheduler) Run(ctx context.Context) {
+	fmt.Println("Starting scheduler with slots: ", s.Slots, " per user limit: ", s.UserLimit)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(POLL_INTERVAL):
+		}
+		s.fillSlots(ctx)
+	}
+}
+
+// Wait blocks until the running tasks stopped or timeout passed, it returns false on timeout
+func (s *Scheduler) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// RunSchedules queues a new run for every recurring schedule that is due
+func (s *Scheduler) RunSchedules(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(SCHEDULE_POLL_INTERVAL):
+		}
+		schedules, err := models.FindDueTaskSchedules()
+		if err != nil {
+			fmt.Println("Error finding due task schedules", err)
+			continue
+		}
+
+		for i := range schedules {
+			enqueueScheduledRun(&schedules[i])
+		}
+	}
+}
+
+func enqueueScheduledRun(schedule *models.TaskSchedule) {
+	now := time.Now()
+
+	// Don't stack runs if the previous one is still going
+	if lastTask, err := models.FindTaskById(schedule.LastTaskId); err == nil && lastTask != nil {
+		if lastTask.Status == models.TaskStatusQueued || lastTask.Status == models.TaskStatusProcessing || lastTask.Status == models.TaskStatusPaused {
+			fmt.Println("Previous scheduled run still active, postponing", schedule.TaskId, lastTask.ID)
+			schedule.NextRunAt = now.Add(time.Hour).Unix()
+			schedule.Update()
+			return
+		}
+	}
+
+	task, err := models.FindTaskById(schedule.TaskId)
+	if err != nil || task == nil {
+		fmt.Println("Cannot find scheduled task, deactivating schedule", schedule.TaskId, err)
+		schedule.Active = 0
+		schedule.Update()
+		return
+	}
+
+	newTask, err := models.CloneTask(task)
+	if err != nil {
+		fmt.Println("Error queueing scheduled run", schedule.TaskId, err)
+		return
+	}
+	fmt.Println("Queued scheduled run", schedule.TaskId, newTask.ID)
+
+	schedule.LastTaskId = newTask.ID
+	schedule.LastRunAt = now.Unix()
+	schedule.NextRunAt = now.AddDate(0, 0, schedule.IntervalDays).Unix()
+	if err := schedule.Update(); err != nil {
+		fmt.Println("Error updating task schedule", schedule.ID, err)
+	}
+
+	utils.SendWSTask(newTask)
+	utils.SendWSQueuePositions()
+}
+
+func (s *Scheduler) fillSlots(ctx context.Context) {
+	for ctx.Err() == nil {
+		count, err := models.FindProcessingTasksCount()
+		if err != nil {
+			fmt.Println("Error finding processing tasks count", err)
+			return
+		}
+		if count >= s.Slots {
+			return
+		}
+
+		task, err := models.FindNextFairTaskToProcess(s.UserLimit)
+		if err != nil {
+			fmt.Println("Error finding next task to process", err)
+			return
+		}
+		if task == nil {
+			return
+		}
+
+		claimed, err := models.ClaimQueuedTask(task.ID)
+		if err != nil {
+			fmt.Println("Error claiming task", task.ID, err)
+			return
+		}
+		if !claimed {
+			continue
+		}
+		fmt.Println("Next task: ", task.URL, task.ID)
+		utils.SendWSQueuePositions()
+
+		claimedTask, user, data, err := loadRun(task.ID)
+		if err != nil {
+			fmt.Println("Error loading the claimed task", task.ID, err)
+			// Fail the task to get the next
+			models.UpdateTaskStatus(task.ID, models.TaskStatusFailed)
+			task.Status = models.TaskStatusFailed
+			utils.SendWSTask(task)
+			continue
+		}
+
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			runTask(ctx, claimedTask, user, data)
+		}()
+	}
+}
+
+func runTask(ctx context.Context, task *models.Task, user *models.User, data services.StartData) {
+	switch task.Type {
+	case models.TaskTypeMap:
+		fmt.Println("Action message map", task.URL)
+		if err := services.StartMap(ctx, task.ID, user, data); err != nil {
+			log.Println("Error starting map", err)
+		}
+	case models.TaskTypeChart:
+		fmt.Println("Action message chart", task.URL)
+		if err := services.StartChart(ctx, task.ID, user, data); err != nil {
+			log.Println("Error starting chart", err)
+		}
+	}
+}
+
+// loadRun reads the whole claimed task again, its user bound to the task's wiki profile and
+// the settings of its run
+func loadRun(taskId string) (*models.Task, *models.User, services.StartData, error) {
+	task, err := models.FindTaskById(taskId)
+	if err != nil {
+		return nil, nil, services.StartData{}, err
+	}
+
+	user, err := models.FindUserByID(task.UserId)
+	if err != nil || user == nil {
+		return nil, nil, services.StartData{}, fmt.Errorf("can't find user %s of the task: %v", task.UserId, err)
+	}
+	// API clients made from the user call the task's wiki
+	user, err = user.WithWikiProfile(task.WikiProfile)
+	if err != nil {
+		return nil, nil, services.StartData{}, err
+	}
+
+	data := services.StartData{
+		Url:                           task.URL,
+		FileName:                      task.FileName,
+		Description:                   task.Description,
+		DescriptionOverwriteBehaviour: task.DescriptionOverwriteBehaviour,
+		DryRun:                        task.DryRun == 1,
+		Destination:                   services.NewTaskDestination(task, user),
+	}
+	if task.Type == models.TaskTypeMap {
+		data.ImportCountries = task.ImportCountries == 1
+		data.CountryFileName = task.CountryFileName
+		data.CountryDescription = task.CountryDescription
+		data.CountryDescriptionOverwriteBehaviour = task.CountryDescriptionOverwriteBehaviour
+		data.GenerateTemplateCommons = task.GenerateTemplateCommons == 1
+		data.TemplateNameFormat = task.CommonsTemplateNameFormat
+	}
+
+	return task, user, data, nil
+}
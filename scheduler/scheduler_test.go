@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+	"github.com/wpmed-videowiki/OWIDImporter/services"
+	"github.com/wpmed-videowiki/OWIDImporter/testutil"
+)
+
+// pickTask takes the next task the way the scheduler does, runTask only gets its id
+func pickTask(t *testing.T, want *models.Task) *models.Task {
+	picked, err := models.FindNextFairTaskToProcess(100)
+	if err != nil || picked == nil {
+		t.Fatalf("expected a queued task, got %v %v", picked, err)
+	}
+	if picked.ID != want.ID {
+		t.Fatalf("expected task %s to be picked, got %s", want.ID, picked.ID)
+	}
+	claimed, err := models.ClaimQueuedTask(picked.ID)
+	if err != nil || !claimed {
+		t.Fatalf("expected to claim task %s: %v", picked.ID, err)
+	}
+	t.Cleanup(func() { models.UpdateTaskStatus(picked.ID, models.TaskStatusDone) })
+
+	return &models.Task{ID: picked.ID}
+}
+
+func TestScheduledDryRunNeverWritesToCommons(t *testing.T) {
+	user := testutil.NewUser(t)
+	commons := reflect.TypeOf(services.NewTaskDestination(&models.Task{Destination: models.TaskDestinationCommons}, user))
+
+	for _, taskType := range []models.TaskType{models.TaskTypeMap, models.TaskTypeChart} {
+		t.Run(string(taskType), func(t *testing.T) {
+			created := testutil.NewTask(t, models.NewTaskOptions{UserId: user.ID, Type: taskType, ImportMode: models.TaskImportModeData, DryRun: 1})
+			picked := pickTask(t, created)
+
+			task, _, data, err := loadRun(picked.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if task.DryRun != 1 {
+				t.Errorf("expected the loaded task to be a dry run")
+			}
+			if reflect.TypeOf(data.Destination) == commons && !data.DryRun {
+				t.Errorf("dry run task reaches the Commons destination with DryRun=false")
+			}
+			if !data.DryRun {
+				t.Errorf("expected the start data to be a dry run")
+			}
+		})
+	}
+}
+
+func TestScheduledRunUsesTheTaskDestination(t *testing.T) {
+	user := testutil.NewUser(t)
+	local := reflect.TypeOf(services.NewTaskDestination(&models.Task{Destination: models.TaskDestinationLocal}, user))
+
+	created := testutil.NewTask(t, models.NewTaskOptions{UserId: user.ID, ImportMode: models.TaskImportModeData, Destination: models.TaskDestinationLocal})
+	picked := pickTask(t, created)
+
+	_, _, data, err := loadRun(picked.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.TypeOf(data.Destination) != local {
+		t.Errorf("expected the local destination, got %T", data.Destination)
+	}
+}
+
+func TestScheduledRunUsesTheTaskWikiProfile(t *testing.T) {
+	user := testutil.NewUser(t)
+	if err := models.SaveUserWikiToken(user.ID, "testwiki", "testwiki-key", "testwiki-secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	created := testutil.NewTask(t, models.NewTaskOptions{UserId: user.ID, ImportMode: models.TaskImportModeData, WikiProfile: "testwiki"})
+	picked := pickTask(t, created)
+
+	_, runUser, _, err := loadRun(picked.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runUser.WikiProfile != "testwiki" || runUser.ResourceOwnerKey != "testwiki-key" || runUser.ResourceOwnerSecret != "testwiki-secret" {
+		t.Errorf("expected the user bound to testwiki, got profile %s with key %s", runUser.WikiProfile, runUser.ResourceOwnerKey)
+	}
+}
+
+func TestScheduledRunFailsWithoutProfileLogin(t *testing.T) {
+	user := testutil.NewUser(t)
+
+	created := testutil.NewTask(t, models.NewTaskOptions{UserId: user.ID, ImportMode: models.TaskImportModeData, WikiProfile: "testwiki"})
+	picked := pickTask(t, created)
+
+	if _, _, _, err := loadRun(picked.ID); err == nil {
+		t.Error("expected the run to fail for a user who didn't log in to the task's wiki")
+	}
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/wpmed-videowiki/OWIDImporter/env"
+)
+
+const BROWSER_HEALTH_CHECK_INTERVAL = time.Second * 30
+
+// BrowserPool shares a bounded number of Chromium processes between tasks.
+// Every lease gets its own incognito browser context, so pages, cookies and
+// downloads of two leases on the same process don't mix
+type BrowserPool struct {
+	Size             int // Chromium processes, draining ones aren't counted
+	LeasesPerBrowser int // Leases served at the same time by one process
+	RecycleLeases    int // Leases served by a process before it's restarted, 0 to disable
+	MaxMemoryMB      int // Memory of a process and its children before it's restarted, 0 to disable
+
+	mu       sync.Mutex
+	browsers []*pooledBrowser
+	slots    chan struct{}
+	closed   bool
+}
+
+type pooledBrowser struct {
+	launcher *launcher.Launcher
+	browser  *rod.Browser
+	active   int
+	leased   int
+	draining bool
+	ready    chan struct{} // Closed once the launch finished, launcher and browser are set if err is nil
+	err      error
+
+	closeOnce sync.Once
+}
+
+// BrowserLease is a browser context from the pool, pages are created from Browser
+// and all of them are closed on Release
+type BrowserLease struct {
+	Browser *rod.Browser
+
+	pool   *BrowserPool
+	pooled *pooledBrowser
+	once   sync.Once
+}
+
+var (
+	browserPool   *BrowserPool
+	browserPoolMu sync.Mutex
+)
+
+func NewBrowserPool(size, leasesPerBrowser, recycleLeases, maxMemoryMB int) *BrowserPool {
+	if size < 1 {
+		size = 1
+	}
+	if leasesPerBrowser < 1 {
+		leasesPerBrowser = 1
+	}
+
+	return &BrowserPool{
+		Size:             size,
+		LeasesPerBrowser: leasesPerBrowser,
+		RecycleLeases:    recycleLeases,
+		MaxMemoryMB:      maxMemoryMB,
+		browsers:         make([]*pooledBrowser, 0),
+		slots:            make(chan struct{}, size*leasesPerBrowser),
+	}
+}
+
+// getBrowserPool returns the shared pool, created from the environment on first use
+func getBrowserPool() *BrowserPool {
+	browserPoolMu.Lock()
+	defer browserPoolMu.Unlock()
+
+	if browserPool == nil {
+		e := env.GetEnv()
+		browserPool = NewBrowserPool(e.OWID_BROWSER_POOL_SIZE, e.OWID_BROWSER_LEASES_PER_BROWSER, e.OWID_BROWSER_RECYCLE_LEASES, e.OWID_BROWSER_MAX_MEMORY_MB)
+		go browserPool.monitor()
+	}
+
+	return browserPool
+}
+
+// LeaseBrowser waits for a free browser context in the shared pool
+func LeaseBrowser(ctx context.Context) (*BrowserLease, error) {
+	return getBrowserPool().Lease(ctx)
+}
+
+// CleanupBrowsers closes every browser of the shared pool, used on shutdown
+func CleanupBrowsers() {
+	browserPoolMu.Lock()
+	pool := browserPool
+	browserPoolMu.Unlock()
+
+	if pool != nil {
+		pool.Close()
+	}
+}
+
+// Lease waits until the pool has room and returns a fresh browser context
+func (pool *BrowserPool) Lease(ctx context.Context) (*BrowserLease, error) {
+	select {
+	case pool.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	lease, err := pool.lease()
+	if err != nil {
+		<-pool.slots
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+func (pool *BrowserPool) lease() (*BrowserLease, error) {
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		return nil, fmt.Errorf("browser pool is closed")
+	}
+
+	// Fill the busiest browser first so idle ones can be recycled
+	var pooled *pooledBrowser
+	running := 0
+	for _, b := range pool.browsers {
+		if b.draining {
+			continue
+		}
+		running++
+		if b.active < pool.LeasesPerBrowser && (pooled == nil || b.active > pooled.active) {
+			pooled = b
+		}
+	}
+
+	launch := false
+	if pooled == nil {
+		if running >= pool.Size {
+			pool.mu.Unlock()
+			// The slots bound the leases, this shouldn't happen
+			return nil, fmt.Errorf("no browser available in the pool")
+		}
+		// Registered before launching so leases taken meanwhile wait for it instead of launching more
+		pooled = &pooledBrowser{ready: make(chan struct{})}
+		pool.browsers = append(pool.browsers, pooled)
+		launch = true
+	}
+	pooled.active++
+	pooled.leased++
+	pool.mu.Unlock()
+
+	// Chromium takes a while to start, it's launched without holding pool.mu
+	if launch {
+		l, browser, err := launchBrowser()
+		pool.mu.Lock()
+		if err == nil && pool.closed {
+			l.Kill()
+			l.Cleanup()
+			err = fmt.Errorf("browser pool is closed")
+		}
+		if err != nil {
+			fmt.Println("Error launching browser", err)
+			pooled.err = err
+			pool.removeBrowser(pooled)
+		} else {
+			pooled.launcher = l
+			pooled.browser = browser
+		}
+		close(pooled.ready)
+		pool.mu.Unlock()
+	} else {
+		<-pooled.ready
+	}
+
+	if pooled.err != nil {
+		pool.mu.Lock()
+		pooled.active--
+		pool.mu.Unlock()
+		return nil, pooled.err
+	}
+
+	incognito, err := pooled.browser.Incognito()
+	if err != nil {
+		// The process is unusable, drop it so the next lease launches a new one
+		fmt.Println("Error creating browser context, recycling browser", err)
+		pool.mu.Lock()
+		pooled.active--
+		pooled.draining = true
+		pool.closeIfIdle(pooled)
+		pool.mu.Unlock()
+		return nil, err
+	}
+
+	return &BrowserLease{
+		Browser: incognito,
+		pool:    pool,
+		pooled:  pooled,
+	}, nil
+}
+
+// Release closes the lease's pages and gives its slot back, it's safe to call more than once
+func (lease *BrowserLease) Release() {
+	lease.once.Do(func() {
+		// Disposes the incognito context with all of its pages
+		if err := lease.Browser.Close(); err != nil {
+			fmt.Println("Error closing browser context", err)
+		}
+
+		pool := lease.pool
+		pool.mu.Lock()
+		lease.pooled.active--
+		if pool.RecycleLeases > 0 && lease.pooled.leased >= pool.RecycleLeases {
+			lease.pooled.draining = true
+		}
+		pool.closeIfIdle(lease.pooled)
+		pool.mu.Unlock()
+
+		<-pool.slots
+	})
+}
+
+// closeIfIdle closes a draining browser once its last lease is released, pool.mu must be held
+func (pool *BrowserPool) closeIfIdle(pooled *pooledBrowser) {
+	if pool.closed || !pooled.draining || pooled.active > 0 {
+		return
+	}
+
+	// The monitor may drain a browser a release already took out
+	if pool.removeBrowser(pooled) {
+		go pooled.close(false)
+	}
+}
+
+// removeBrowser takes a browser out of the pool, it returns false if it wasn't in it. pool.mu must be held
+func (pool *BrowserPool) removeBrowser(pooled *pooledBrowser) bool {
+	for i, b := range pool.browsers {
+		if b == pooled {
+			pool.browsers = append(pool.browsers[:i], pool.browsers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// close shuts the process down once, however many of the pool, its leases and the monitor close it
+func (pooled *pooledBrowser) close(kill bool) {
+	pooled.closeOnce.Do(func() {
+		if kill || pooled.browser.Close() != nil {
+			pooled.launcher.Kill()
+		}
+		pooled.launcher.Cleanup()
+	})
+}
+
+// Close kills every browser, leases still out fail on their next operation
+func (pool *BrowserPool) Close() {
+	pool.mu.Lock()
+	pool.closed = true
+	browsers := make([]*pooledBrowser, 0, len(pool.browsers))
+	for _, pooled := range pool.browsers {
+		// Browsers still launching are killed by their lease once the launch returns
+		if pooled.launcher != nil {
+			browsers = append(browsers, pooled)
+		}
+	}
+	pool.browsers = make([]*pooledBrowser, 0)
+	pool.mu.Unlock()
+
+	for _, pooled := range browsers {
+		pooled.close(true)
+	}
+}
+
+// monitor pings the browsers and recycles the ones that stopped responding or use too much memory
+func (pool *BrowserPool) monitor() {
+	for {
+		time.Sleep(BROWSER_HEALTH_CHECK_INTERVAL)
+
+		pool.mu.Lock()
+		if pool.closed {
+			pool.mu.Unlock()
+			return
+		}
+		browsers := make([]*pooledBrowser, 0, len(pool.browsers))
+		for _, pooled := range pool.browsers {
+			if pooled.browser != nil {
+				browsers = append(browsers, pooled)
+			}
+		}
+		pool.mu.Unlock()
+
+		for _, pooled := range browsers {
+			healthy := true
+			if _, err := (proto.BrowserGetVersion{}).Call(pooled.browser.Timeout(time.Second * 5)); err != nil {
+				fmt.Println("Browser failed health check, recycling", err)
+				healthy = false
+			}
+			if pool.MaxMemoryMB > 0 {
+				if memory := processTreeMemoryMB(pooled.launcher.PID()); memory > pool.MaxMemoryMB {
+					fmt.Println("Browser is using too much memory, recycling", memory)
+					healthy = false
+				}
+			}
+
+			if !healthy {
+				pool.mu.Lock()
+				pooled.draining = true
+				pool.closeIfIdle(pooled)
+				pool.mu.Unlock()
+			}
+		}
+	}
+}
+
+// processTreeMemoryMB sums the resident memory of a process and its children, Chromium
+// runs pages in child processes. It returns 0 where /proc isn't available
+func processTreeMemoryMB(pid int) int {
+	if pid == 0 {
+		return 0
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		childPid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// The command name can contain spaces, fields after it are space separated
+		fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		parentPid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		children[parentPid] = append(children[parentPid], childPid)
+	}
+
+	pageSize := os.Getpagesize()
+	total := 0
+	pending := []int{pid}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		pending = append(pending, children[current]...)
+
+		statm, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(current), "statm"))
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(statm))
+		if len(fields) < 2 {
+			continue
+		}
+		resident, err := strconv.Atoi(fields[1])
+		if err == nil {
+			total += resident * pageSize
+		}
+	}
+
+	return total / (1024 * 1024)
+}
+
+// waitPageDownload is like rod's Browser.WaitDownload but only waits for a
+// download started by page, other leases on the same browser download in parallel
+func waitPageDownload(page *rod.Page, dir string) func() {
+	browser := page.Browser()
+	_ = proto.BrowserSetDownloadBehavior{
+		Behavior:         proto.BrowserSetDownloadBehaviorBehaviorAllowAndName,
+		BrowserContextID: browser.BrowserContextID,
+		DownloadPath:     dir,
+	}.Call(browser)
+
+	var start *proto.PageDownloadWillBegin
+	wait := browser.EachEvent(func(e *proto.PageDownloadWillBegin) {
+		if start == nil && e.FrameID == page.FrameID {
+			start = e
+		}
+	}, func(e *proto.PageDownloadProgress) bool {
+		return start != nil && start.GUID == e.GUID && e.State == proto.PageDownloadProgressStateCompleted
+	})
+
+	return wait
+}
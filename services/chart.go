@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
@@ -11,12 +12,156 @@ import (
 	"github.com/go-rod/rod/lib/input"
 	"github.com/go-rod/rod/lib/proto"
 	"github.com/wpmed-videowiki/OWIDImporter/constants"
+	"github.com/wpmed-videowiki/OWIDImporter/entities"
 	"github.com/wpmed-videowiki/OWIDImporter/env"
 	"github.com/wpmed-videowiki/OWIDImporter/models"
 	"github.com/wpmed-videowiki/OWIDImporter/utils"
 )
 
-func uploadCountryChart(user *models.User, token *string, replaceData ReplaceVarsData, countryDownloadPath string, data StartData) (string, string, error) {
+func StartChart(ctx context.Context, taskId string, user *models.User, data StartData) error {
+	task, err := models.FindTaskById(taskId)
+	if err != nil {
+		return err
+	}
+	// Cancelled or paused while waiting for a slot
+	if task.Status == models.TaskStatusCancelled || task.Status == models.TaskStatusPaused {
+		return nil
+	}
+	// The stored task decides, a dry run never writes whatever the caller passed
+	data.DryRun = task.DryRun == 1
+
+	ctx, runtime := StartTaskRuntime(ctx, task.ID)
+	defer runtime.Stop()
+
+	task.Status = models.TaskStatusProcessing
+	if err := task.Update(); err != nil {
+		fmt.Println("Error setting task to Processing: ", err)
+	}
+	models.UpdateTaskLastOperationAt(task.ID)
+	utils.SendWSTask(task)
+
+	err = ValidateParameters(data)
+	if err != nil {
+		task.Status = models.TaskStatusFailed
+		task.Update()
+		utils.SendWSTask(task)
+		return err
+	}
+
+	url := utils.AttachQueryParamToUrl(data.Url, "tab=map")
+	if task.ChartParameters != "" {
+		url = utils.AttachQueryParamToUrl(url, task.ChartParameters)
+	}
+
+	fmt.Println("==================== CONSTRUCTED CHART URL: ", url)
+
+	lease, err := LeaseBrowser(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			stopInterruptedTask(ctx, task, runtime)
+			return ctx.Err()
+		}
+		fmt.Println("Error leasing browser: ", err)
+		task.Status = models.TaskStatusFailed
+		task.Update()
+		utils.SendWSTask(task)
+		return err
+	}
+	browser := lease.Browser
+	_ = browser.MustPage("")
+	chartInfo, err := GetChartInfo(browser, url, "$CHART_NAME", task.ChartParameters)
+	lease.Release()
+	if err != nil {
+		fmt.Println("Error getting chart info: ", err)
+		task.Status = models.TaskStatusFailed
+		task.Update()
+		utils.SendWSTask(task)
+		return fmt.Errorf("Error getting chart info")
+	}
+	recordUnmatchedEntities(task, models.TaskUnmatchedEntitySourcePage, chartInfo.UnmatchedEntities)
+
+	task.ChartName = chartInfo.ChartName
+	if task.ChartName == "" {
+		task.Status = models.TaskStatusFailed
+		task.Update()
+		utils.SendWSTask(task)
+		return fmt.Errorf("invalid url")
+	}
+
+	if chartInfo.StableUrl != "" {
+		data.Url = chartInfo.StableUrl
+		task.URL = data.Url
+	}
+
+	if !chartInfo.HasCountries || len(chartInfo.CountriesList) == 0 {
+		fmt.Println("Chart doesn't have a countries list: ", task.URL)
+		task.Status = models.TaskStatusFailed
+		task.Update()
+		utils.SendWSTask(task)
+		return fmt.Errorf("chart doesn't have countries")
+	}
+
+	models.UpdateTaskLastOperationAt(task.ID)
+	task.Update()
+	utils.SendWSTask(task)
+
+	startYear := chartInfo.StartYear
+	endYear := chartInfo.EndYear
+	title := chartInfo.Title
+	fmt.Println("Chart Name:", task.ChartName, startYear, endYear, title)
+
+	tmpDir, err := os.MkdirTemp("", "owid-exporter")
+	if err != nil {
+		fmt.Println("Error creating temp directory", err)
+		task.Status = models.TaskStatusFailed
+		task.Update()
+		utils.SendWSTask(task)
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	countriesStartData := StartData{
+		Url:                           data.Url,
+		FileName:                      data.FileName,
+		Description:                   data.Description,
+		DescriptionOverwriteBehaviour: data.DescriptionOverwriteBehaviour,
+		DryRun:                        data.DryRun,
+		Destination:                   data.Destination,
+	}
+	if err := processCountriesList(ctx, chartInfo, user, task, tmpDir, title, startYear, endYear, chartInfo.ParamsMap, countriesStartData); err != nil && ctx.Err() == nil {
+		task.Status = models.TaskStatusFailed
+		task.Update()
+		utils.SendWSTask(task)
+		return err
+	}
+
+	if ctx.Err() != nil {
+		stopInterruptedTask(ctx, task, runtime)
+		return ctx.Err()
+	}
+
+	if task.Status == models.TaskStatusProcessing {
+		task.Status = models.TaskStatusDone
+		if err := task.Update(); err != nil {
+			fmt.Println("Error saving task staus to done: ", err)
+		}
+	}
+
+	utils.SendWSTask(task)
+
+	if task.Status == models.TaskStatusDone {
+		completeTask(task, data)
+	}
+
+	return nil
+}
+
+func uploadCountryChart(ctx context.Context, user *models.User, replaceData ReplaceVarsData, countryDownloadPath string, data StartData) (string, string, string, error) {
+	// Only files on Commons can have the old names
+	if _, ok := data.Destination.(*localDestination); ok {
+		return uploadMapFile(ctx, user, replaceData, countryDownloadPath, data)
+	}
+
 	oldFileNameFormatMatcher := "$NAME, $START_YEAR $REGION.svg"
 	/**
 		Check if the country graph was uploaded before with a past year (year != endYear)
@@ -71,9 +216,15 @@ func uploadCountryChart(user *models.User, token *string, replaceData ReplaceVar
 				}
 				fmt.Println("Move: have chart url", chartUrlParts[0])
 
+				// A dry run plans the upload under the new name, the move is only logged
+				if data.DryRun {
+					fmt.Println("Dry run: would move", existingTitle, "to", newFileName)
+					break
+				}
+
 				// Move the page to the newFileName
 				fmt.Println("============== MOVING TO THE NEW NAME", newFileName)
-				if err := MovePage(user, *token, existingTitle, newFileName); err != nil {
+				if err := MovePage(user, existingTitle, newFileName); err != nil {
 					fmt.Println("Error moving country page from old title to new title", existingTitle, newFileName, err)
 				} else {
 					fmt.Println("============ Moved From: ", existingTitle, " to: ", newFileName)
@@ -84,40 +235,10 @@ func uploadCountryChart(user *models.User, token *string, replaceData ReplaceVar
 		}
 	}
 
-	filename, status, err := uploadMapFile(user, *token, replaceData, countryDownloadPath, data)
-	return filename, status, err
+	return uploadMapFile(ctx, user, replaceData, countryDownloadPath, data)
 }
 
-func ProcessCountriesFromPopover(user *models.User, task *models.Task, chartName, title, startYear, endYear, downloadPath string, data StartData, chartParams map[string]string) error {
-	token := ""
-	done := false
-
-	defer func() {
-		done = true
-	}()
-
-	go func() {
-		for !done {
-			tokenResponse, err := utils.DoApiReq[TokenResponse](user, map[string]string{
-				"action": "query",
-				"meta":   "tokens",
-				"format": "json",
-			}, nil)
-			if err != nil {
-				fmt.Println("Error fetching edit token", err)
-			} else if tokenResponse.Query.Tokens.CsrfToken != "" {
-				token = tokenResponse.Query.Tokens.CsrfToken
-			}
-
-			time.Sleep(time.Second * 20)
-		}
-	}()
-
-	for token == "" {
-		time.Sleep(time.Second)
-		// fmt.Println("Waiting for token")
-	}
-
+func ProcessCountriesFromPopover(ctx context.Context, user *models.User, task *models.Task, chartName, title, startYear, endYear, downloadPath string, data StartData, chartParams map[string]string) error {
 	url := utils.AttachQueryParamToUrl(task.URL, fmt.Sprintf("tab=map"))
 	if task.ChartParameters != "" {
 		url = utils.AttachQueryParamToUrl(url, task.ChartParameters)
@@ -127,11 +248,15 @@ func ProcessCountriesFromPopover(user *models.User, task *models.Task, chartName
 	}
 
 	models.UpdateTaskLastOperationAt(task.ID)
-	result := DownloadCountryGraphsFromPopover(url, downloadPath)
+	countryCodes := make([]string, 0)
+	for _, entity := range entities.Current() {
+		countryCodes = append(countryCodes, entity.Code())
+	}
+	result := DownloadCountryGraphsFromPopover(ctx, url, downloadPath, filterTaskCountries(task, countryCodes))
 	models.UpdateTaskLastOperationAt(task.ID)
 
 	for country, path := range result {
-		if task.Status != models.TaskStatusProcessing {
+		if task.Status != models.TaskStatusProcessing || ctx.Err() != nil {
 			break
 		}
 
@@ -174,22 +299,12 @@ func ProcessCountriesFromPopover(user *models.User, task *models.Task, chartName
 			Params:    chartParams,
 		}
 
-		filename, status, err := uploadCountryChart(user, &token, replaceData, path, data)
+		countryData := getEntityStartData(task, data, country)
+		filename, status, description, err := uploadCountryChart(withTaskProcessRetries(ctx, taskProcess), user, replaceData, path, countryData)
 		if err != nil {
-			fmt.Println("Error country first upload", country, err)
-			// utils.SendWSMessage(session, "progress", fmt.Sprintf("%s:failed", country))
-			taskProcess.Status = models.TaskProcessStatusRetrying
-			taskProcess.Update()
-			utils.SendWSTaskProcess(task.ID, taskProcess)
-			time.Sleep(time.Second * 2)
-			filename, status, err = uploadCountryChart(user, &token, replaceData, downloadPath, data)
-			if err != nil {
-				fmt.Println("Error retrying for second time: ", country, err)
-				taskProcess.Status = models.TaskProcessStatusFailed
-				taskProcess.Update()
-				utils.SendWSTaskProcess(task.ID, taskProcess)
-				continue
-			}
+			fmt.Println("Error uploading country", country, err)
+			FailTaskProcess(taskProcess)
+			continue
 		}
 
 		switch status {
@@ -213,6 +328,7 @@ func ProcessCountriesFromPopover(user *models.User, task *models.Task, chartName
 		// utils.SendWSMessage(session, "progress", fmt.Sprintf("%s:done:%s", country, status))
 
 		taskProcess.FileName = filename
+		taskProcess.Description = description
 		taskProcess.Update()
 		utils.SendWSTaskProcess(task.ID, taskProcess)
 
@@ -221,7 +337,7 @@ func ProcessCountriesFromPopover(user *models.User, task *models.Task, chartName
 	return nil
 }
 
-func TraverseDownloadCountriesList(user *models.User, task *models.Task, token *string, chartName, title, startYear, endYear, downloadPath string, data StartData, chartParams map[string]string, countriesCodes []string) error {
+func TraverseDownloadCountriesList(ctx context.Context, user *models.User, task *models.Task, chartName, title, startYear, endYear, downloadPath string, data StartData, chartParams map[string]string, countriesCodes []string) error {
 	if len(countriesCodes) == 0 {
 		return nil
 	}
@@ -247,14 +363,24 @@ func TraverseDownloadCountriesList(user *models.User, task *models.Task, token *
 	// 		Download chart
 	// 		Upload to destination
 
-	l, browser := GetBrowser()
-	blankPage := browser.MustPage("")
-
-	defer blankPage.Close()
-	defer l.Cleanup()
-	defer browser.Close()
+	lease, err := LeaseBrowser(ctx)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+	// Browser operations fail as soon as the task is cancelled, stop quietly then
+	defer func() {
+		if r := recover(); r != nil {
+			if ctx.Err() == nil {
+				panic(r)
+			}
+			fmt.Println("Stopped traversing countries: ", r)
+		}
+	}()
 
-	page := browser.MustPage("")
+	// Each country list is a lane of the task runtime
+	lane := "countries:" + countriesCodes[0]
+	page := lease.Browser.Context(ctx).MustPage("")
 	page.MustSetUserAgent(&proto.NetworkSetUserAgentOverride{UserAgent: env.GetEnv().OWID_UA})
 	page.MustSetViewport(constants.VIEWPORT_WIDTH, constants.VIEWPORT_HEIGHT, 1, false)
 	page.MustNavigate(url)
@@ -278,21 +404,20 @@ func TraverseDownloadCountriesList(user *models.User, task *models.Task, token *
 		return fmt.Errorf("Cannot find line/chart tabs")
 	}
 
-	countriesCodeNameMap := constants.GetCountryCodeNameMap()
-
 	counter := 0
 	owidEnv := env.GetEnv().OWID_ENV
 	// var selectedItems rod.Elements
 	for _, code := range countriesCodes {
-		if task.Status != models.TaskStatusProcessing {
+		if task.Status != models.TaskStatusProcessing || ctx.Err() != nil {
 			break
 		}
 
-		name, found := countriesCodeNameMap[code]
+		entity, found := entities.FindByCode(code)
 		if !found {
 			fmt.Println("Not found")
 			continue
 		}
+		name := entity.Name
 		fmt.Println("Processing code: ", code, name)
 		counter = counter + 1
 		if owidEnv == "development" && counter >= 5 {
@@ -321,8 +446,7 @@ func TraverseDownloadCountriesList(user *models.User, task *models.Task, token *
 
 		utils.SendWSTaskProcess(task.ID, taskProcess)
 		models.UpdateTaskLastOperationAt(task.ID)
-
-		nameLowerCase := strings.ToLower(strings.TrimSpace(name))
+		setTaskPosition(task.ID, lane, code)
 
 		selectedItemCounter := 0
 		for selectedItemCounter < 100 {
@@ -354,22 +478,27 @@ func TraverseDownloadCountriesList(user *models.User, task *models.Task, token *
 			break
 		}
 
-		// Trigger search to reduce result count
-		searchInput := page.MustElement(COUNTRY_SEARCH_INPUT)
-		if searchInput != nil {
-			searchInput.SelectAllText()
-			searchInput.MustInput(name)
-
-			time.Sleep(time.Second)
-		}
-
-		// countryId := strings.ReplaceAll(name, " ", "-")
-		items := page.MustElements(COUNTRY_SEARCH_RESULT_LIST)
+		// OWID may list the country under one of its aliases, search each until one is found
 		foundEl := false
-		for _, el := range items {
-			if nameLowerCase == strings.ToLower(strings.TrimSpace(el.MustText())) {
-				el.MustClick()
-				foundEl = true
+		for _, searchName := range entity.Names() {
+			// Trigger search to reduce result count
+			searchInput := page.MustElement(COUNTRY_SEARCH_INPUT)
+			if searchInput != nil {
+				searchInput.SelectAllText()
+				searchInput.MustInput(searchName)
+
+				time.Sleep(time.Second)
+			}
+
+			items := page.MustElements(COUNTRY_SEARCH_RESULT_LIST)
+			for _, el := range items {
+				if entity.MatchesName(el.MustText()) {
+					el.MustClick()
+					foundEl = true
+					break
+				}
+			}
+			if foundEl {
 				break
 			}
 		}
@@ -391,7 +520,7 @@ func TraverseDownloadCountriesList(user *models.User, task *models.Task, token *
 			FailTaskProcess(taskProcess)
 			continue
 		}
-		wait := page.Browser().WaitDownload(countryDownloadPath)
+		wait := waitPageDownload(page, countryDownloadPath)
 
 		if err := utils.WaitElementWithTimeout(page, DOWNLOAD_BUTTON_SELECTOR, time.Second*5); err != nil {
 			fmt.Println(code, "Cannot find download button", err)
@@ -449,13 +578,14 @@ func TraverseDownloadCountriesList(user *models.User, task *models.Task, token *
 			Comment:   "Importing from " + data.Url,
 			Params:    chartParams,
 		}
-		filename, status, err := uploadCountryChart(user, token, replaceData, countryDownloadPath, data)
+		filename, status, description, err := uploadCountryChart(withTaskProcessRetries(ctx, taskProcess), user, replaceData, countryDownloadPath, getEntityStartData(task, data, code))
 		if err != nil {
 			FailTaskProcess(taskProcess)
 			continue
 		}
 
 		taskProcess.FileName = filename
+		taskProcess.Description = description
 		switch status {
 		case "skipped":
 			taskProcess.Status = models.TaskProcessStatusSkipped
@@ -475,18 +605,25 @@ func TraverseDownloadCountriesList(user *models.User, task *models.Task, token *
 		time.Sleep(time.Millisecond * 200)
 	}
 	fmt.Println("===================== COUNTRIES ALL DONE ==========================")
+	if ctx.Err() == nil {
+		clearTaskPosition(task.ID, lane)
+	}
 
 	return nil
 }
 
-func DownloadCountryGraphsFromPopover(url, outputDir string) map[string]string {
+// DownloadCountryGraphsFromPopover saves the map tooltip chart of each country in countryCodes
+func DownloadCountryGraphsFromPopover(ctx context.Context, url, outputDir string, countryCodes []string) map[string]string {
 	fmt.Println("Downloading country graphs from popover", url)
 
-	l, browser := GetBrowser()
-	page := browser.MustPage("")
-	defer page.Close()
-	defer l.Cleanup()
-	defer browser.Close()
+	result := make(map[string]string, 0)
+	lease, err := LeaseBrowser(ctx)
+	if err != nil {
+		fmt.Println("Error leasing browser", err)
+		return result
+	}
+	defer lease.Release()
+	page := lease.Browser.MustPage("")
 
 	// Max 3 minutes for the process to complete
 	page = page.Timeout(time.Minute * 3)
@@ -497,7 +634,6 @@ func DownloadCountryGraphsFromPopover(url, outputDir string) map[string]string {
 	time.Sleep(time.Second * 2)
 	fmt.Println("Url", page.MustInfo().URL)
 
-	result := make(map[string]string, 0)
 	if err := utils.WaitElementWithTimeout(page, DOWNLOAD_BUTTON_SELECTOR, time.Second*5); err != nil {
 		fmt.Println("Timeout waiting for download btn")
 		return result
@@ -507,28 +643,40 @@ func DownloadCountryGraphsFromPopover(url, outputDir string) map[string]string {
 	notFoundCountries := make([]string, 0)
 	gotSvg := make([]string, 0)
 
-	for name, code := range constants.COUNTRY_CODES {
+	for _, code := range countryCodes {
+		if ctx.Err() != nil {
+			break
+		}
+		entity, ok := entities.FindByCode(code)
+		if !ok {
+			continue
+		}
+		name := entity.Name
 		time.Sleep(time.Millisecond * 200)
 
-		id := strings.ReplaceAll(name, " ", "-")
-		has, _, err := page.Has(fmt.Sprintf("#%s", id))
-		if err != nil {
-			fmt.Println("Error finding: ", name, id)
-			continue
+		// The shape id comes from the label OWID currently uses, which may be an alias
+		var el *rod.Element
+		for _, id := range entity.ElementIDs() {
+			selector := fmt.Sprintf("[id=%q]", id)
+			has, _, err := page.Has(selector)
+			if err != nil {
+				fmt.Println("Error finding: ", name, id)
+				continue
+			}
+			if has {
+				el, err = page.Element(selector)
+				if err != nil {
+					fmt.Println("Error finding element: ", err)
+				}
+				break
+			}
 		}
 
-		if !has {
+		if el == nil {
 			notFoundCountries = append(notFoundCountries, name)
 			continue
-
 		}
 		foundCountries = append(foundCountries, name)
-
-		el, err := page.Element(fmt.Sprintf("#%s", id))
-		if err != nil {
-			fmt.Println("Error finding element: ", err)
-			continue
-		}
 		shape := el.MustShape()
 
 		if shape == nil {
@@ -598,8 +746,25 @@ func DownloadCountryGraphsFromPopover(url, outputDir string) map[string]string {
 	return result
 }
 
-func GetCountryListFromPage(page *rod.Page) []string {
+// GetCountryListFromPage returns the codes of the entities listed with data in the entity picker
+// of the page, along with the listed names the entity registry doesn't know
+func GetCountryListFromPage(page *rod.Page) ([]string, []string) {
 	countries := []string{}
+	unmatchedNames := []string{}
+
+	addCountry := func(name string) {
+		entity, ok := entities.FindByName(name)
+		if !ok {
+			if !utils.Contains(unmatchedNames, name) {
+				unmatchedNames = append(unmatchedNames, name)
+			}
+			return
+		}
+		// check if country is not already in list
+		if !utils.Contains(countries, entity.Code()) {
+			countries = append(countries, entity.Code())
+		}
+	}
 
 	elements := page.MustElements(".entity-selector__content li")
 	// Is regular graph
@@ -610,18 +775,10 @@ func GetCountryListFromPage(page *rod.Page) []string {
 			if value != nil && value.MustText() != "" && strings.ToLower(value.MustText()) == "no data" {
 				continue
 			}
-			country := strings.TrimSpace(label.MustText())
-			countryCode, ok := constants.COUNTRY_CODES[country]
-			if !ok {
-				continue
-			}
-			// check if country is not already in list
-			if !utils.Contains(countries, countryCode) {
-				countries = append(countries, countryCode)
-			}
+			addCountry(strings.TrimSpace(label.MustText()))
 		}
 
-		return countries
+		return countries, unmatchedNames
 	}
 
 	// Is explorer graph
@@ -635,17 +792,9 @@ func GetCountryListFromPage(page *rod.Page) []string {
 				continue
 			}
 
-			country := strings.TrimSpace(label.MustText())
-			countryCode, ok := constants.COUNTRY_CODES[country]
-			if !ok {
-				continue
-			}
-			// check if country is not already in list
-			if !utils.Contains(countries, countryCode) {
-				countries = append(countries, countryCode)
-			}
+			addCountry(strings.TrimSpace(label.MustText()))
 		}
 	}
 
-	return countries
+	return countries, unmatchedNames
 }
@@ -1,10 +1,13 @@
 package services
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/proto"
+	"github.com/wpmed-videowiki/OWIDImporter/mediawiki"
 	"github.com/wpmed-videowiki/OWIDImporter/models"
 	"github.com/wpmed-videowiki/OWIDImporter/utils"
 )
@@ -15,6 +18,76 @@ func FailTaskProcess(taskProcess *models.TaskProcess) {
 	utils.SendWSTaskProcess(taskProcess.TaskId, taskProcess)
 }
 
+// withTaskProcessRetries returns a context whose Commons API retries are counted on taskProcess
+func withTaskProcessRetries(ctx context.Context, taskProcess *models.TaskProcess) context.Context {
+	return mediawiki.WithRetryHook(ctx, func(attempt int, err error) {
+		taskProcess.Retries++
+		taskProcess.Status = models.TaskProcessStatusRetrying
+		taskProcess.Update()
+		utils.SendWSTaskProcess(taskProcess.TaskId, taskProcess)
+	})
+}
+
+// completeTask runs once a task is done, the checkpoints are cleared so the next run of the task
+// starts from the latest date again
+func completeTask(task *models.Task, data StartData) {
+	if err := models.DeleteTaskCheckpoints(task.ID); err != nil {
+		fmt.Println("Error deleting task checkpoints", task.ID, err)
+	}
+	RefreshChartFingerprint(task)
+	finishDestination(task, data)
+}
+
+// requeueInterruptedTask puts a task stopped by a shutdown back in the queue,
+// unfinished task processes are failed so the next run retries them
+func requeueInterruptedTask(task *models.Task) {
+	if err := models.FailProcessingTaskProcesses(task.ID); err != nil {
+		fmt.Println("Error failing interrupted task processes", task.ID, err)
+	}
+	task.Status = models.TaskStatusQueued
+	if err := task.Update(); err != nil {
+		fmt.Println("Error requeueing interrupted task", task.ID, err)
+	}
+	utils.SendWSTask(task)
+}
+
+// pauseInterruptedTask keeps the finished task processes of a paused task, the
+// unfinished ones are failed so resuming retries them
+func pauseInterruptedTask(task *models.Task) {
+	if err := models.FailProcessingTaskProcesses(task.ID); err != nil {
+		fmt.Println("Error failing paused task processes", task.ID, err)
+	}
+	task.Status = models.TaskStatusPaused
+	if err := task.Update(); err != nil {
+		fmt.Println("Error pausing task", task.ID, err)
+	}
+	utils.SendWSTask(task)
+}
+
+// stopInterruptedTask ends a task whose context is done, a cancelled task records
+// where each lane stopped while a task stopped by a shutdown goes back to the queue
+func stopInterruptedTask(ctx context.Context, task *models.Task, runtime *TaskRuntime) {
+	if IsTaskPaused(ctx) {
+		pauseInterruptedTask(task)
+		return
+	}
+	if !IsTaskCancelled(ctx) {
+		requeueInterruptedTask(task)
+		return
+	}
+
+	if err := models.FailProcessingTaskProcesses(task.ID); err != nil {
+		fmt.Println("Error failing cancelled task processes", task.ID, err)
+	}
+	task.Status = models.TaskStatusCancelled
+	task.CancelledAt = runtime.Positions()
+	if err := task.Update(); err != nil {
+		fmt.Println("Error saving cancelled task", task.ID, err)
+	}
+	fmt.Println("Task cancelled at: ", task.ID, task.CancelledAt)
+	utils.SendWSTask(task)
+}
+
 func CloseDownloadPopup(page *rod.Page) {
 	if err := utils.WaitElementWithTimeout(page, DOWNLOAD_POPUP_CLOSE_BUTTON, time.Millisecond*50); err != nil {
 		return
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wpmed-videowiki/OWIDImporter/constants"
+	"github.com/wpmed-videowiki/OWIDImporter/entities"
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+)
+
+// ExpandCountryCodes replaces the preset names in entries with their country codes, it fails
+// on entries that are neither a preset nor a known ISO or OWID code
+func ExpandCountryCodes(entries []string) ([]string, error) {
+	codes := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if preset, ok := getCountryPreset(entry); ok {
+			codes = append(codes, preset...)
+			continue
+		}
+
+		entity, ok := entities.FindByCode(entry)
+		if !ok {
+			return nil, fmt.Errorf("unknown country or preset %s", entry)
+		}
+		codes = append(codes, entity.Code())
+	}
+
+	return codes, nil
+}
+
+func getCountryPreset(name string) ([]string, bool) {
+	for presetName, codes := range constants.COUNTRY_PRESETS {
+		if strings.EqualFold(presetName, name) {
+			return codes, true
+		}
+	}
+	return nil, false
+}
+
+// filterTaskCountries keeps the entity codes of countriesList that pass the task's country filter.
+// Aggregates, income groups and subnational units are dropped unless the task has a file name for their category
+func filterTaskCountries(task *models.Task, countriesList []string) []string {
+	countriesList = filterTaskCategories(task, countriesList)
+	if task.CountryFilter.IsEmpty() {
+		return countriesList
+	}
+
+	// The lists were validated when the task was created
+	include, _ := ExpandCountryCodes(task.CountryFilter.Include)
+	exclude, _ := ExpandCountryCodes(task.CountryFilter.Exclude)
+
+	included := make(map[string]bool)
+	for _, code := range include {
+		included[code] = true
+	}
+	excluded := make(map[string]bool)
+	for _, code := range exclude {
+		excluded[code] = true
+	}
+
+	filtered := make([]string, 0)
+	for _, code := range countriesList {
+		if (len(include) == 0 || included[code]) && !excluded[code] {
+			filtered = append(filtered, code)
+		}
+	}
+	fmt.Println("Countries after task filter: ", len(filtered), "of", len(countriesList))
+
+	return filtered
+}
+
+func filterTaskCategories(task *models.Task, countriesList []string) []string {
+	filtered := make([]string, 0, len(countriesList))
+	for _, code := range countriesList {
+		entity, ok := entities.FindByCode(code)
+		if !ok {
+			continue
+		}
+		switch entity.Category {
+		case entities.CategoryCountry, entities.CategoryRegion:
+			filtered = append(filtered, code)
+		default:
+			if task.CategoryFileNames[string(entity.Category)] != "" {
+				filtered = append(filtered, code)
+			}
+		}
+	}
+	return filtered
+}
+
+// getEntityStartData returns data with the file name of the entity's category when the task has one
+func getEntityStartData(task *models.Task, data StartData, code string) StartData {
+	entity, ok := entities.FindByCode(code)
+	if !ok {
+		return data
+	}
+	if fileName := task.CategoryFileNames[string(entity.Category)]; fileName != "" {
+		data.FileName = fileName
+	}
+	return data
+}
+
+// IsImportableCategory reports whether category can be given its own file name on a task
+func IsImportableCategory(category string) bool {
+	switch entities.Category(category) {
+	case entities.CategoryAggregate, entities.CategoryIncomeGroup, entities.CategorySubnational:
+		return true
+	}
+	return false
+}
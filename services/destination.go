@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+)
+
+// DestinationFile is a cleaned up file ready to be stored, along with its description wikitext
+type DestinationFile struct {
+	FileName    string
+	Description string
+	Comment     string
+	*FileInfo
+}
+
+// Destination stores the files of a task
+type Destination interface {
+	// Put stores file and returns its name, the outcome (uploaded, overwritten, skipped or
+	// description_updated) and the description it was stored with
+	Put(ctx context.Context, file DestinationFile, data StartData) (string, string, string, error)
+	// PutPage stores a wikitext page, such as the generated template, and returns its title
+	PutPage(ctx context.Context, title, wikiText string) (string, error)
+	// Finish runs once the task is done
+	Finish(task *models.Task) error
+}
+
+// NewTaskDestination returns the destination task was created with
+func NewTaskDestination(task *models.Task, user *models.User) Destination {
+	if task.Destination == models.TaskDestinationLocal {
+		return newLocalDestination(task.ID)
+	}
+	return newCommonsDestination(user)
+}
+
+type commonsDestination struct {
+	user *models.User
+}
+
+func newCommonsDestination(user *models.User) *commonsDestination {
+	return &commonsDestination{user: user}
+}
+
+func (d *commonsDestination) Finish(task *models.Task) error {
+	return nil
+}
+
+// finishDestination runs the Finish of data's destination, dry runs have nothing to finish
+func finishDestination(task *models.Task, data StartData) {
+	if data.Destination == nil || task.DryRun == 1 {
+		return
+	}
+	if err := data.Destination.Finish(task); err != nil {
+		fmt.Println("Error finishing task destination", task.ID, err)
+	}
+}
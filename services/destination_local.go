@@ -0,0 +1,263 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wpmed-videowiki/OWIDImporter/env"
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+)
+
+const (
+	exportManifestName    = "manifest.json"
+	exportDescriptionExt  = ".wikitext"
+	exportArchiveTempName = ".tmp"
+)
+
+var exportFileNameReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+
+// localDestination writes the files of a task to a directory, each with its description in a
+// .wikitext sidecar. Finish adds a manifest and archives the directory
+type localDestination struct {
+	taskId string
+	dir    string
+}
+
+type exportManifest struct {
+	TaskId    string               `json:"taskId"`
+	Url       string               `json:"url"`
+	CreatedAt int64                `json:"createdAt"`
+	Files     []exportManifestFile `json:"files"`
+}
+
+type exportManifestFile struct {
+	FileName        string                   `json:"fileName"`        // Name the file would have on Commons
+	Path            string                   `json:"path"`            // Relative to the archive root
+	DescriptionPath string                   `json:"descriptionPath"` // Relative to the archive root
+	Sha1            string                   `json:"sha1"`
+	Region          string                   `json:"region"`
+	Date            string                   `json:"date"`
+	Type            models.TaskProcessType   `json:"type"`
+	Status          models.TaskProcessStatus `json:"status"`
+}
+
+func newLocalDestination(taskId string) *localDestination {
+	return &localDestination{taskId: taskId, dir: TaskExportDir(taskId)}
+}
+
+// TaskExportDir is the directory the files of a task with the local destination are written to
+func TaskExportDir(taskId string) string {
+	return filepath.Join(env.GetEnv().OWID_EXPORT_DIR, taskId)
+}
+
+// TaskExportArchive is the zip archive of TaskExportDir, written once the task is done
+func TaskExportArchive(taskId string) string {
+	return TaskExportDir(taskId) + ".zip"
+}
+
+// HasTaskExport reports whether the archive of a local export was written
+func HasTaskExport(task *models.Task) bool {
+	if task.Destination != models.TaskDestinationLocal {
+		return false
+	}
+	_, err := os.Stat(TaskExportArchive(task.ID))
+	return err == nil
+}
+
+func exportFileName(name string) string {
+	return exportFileNameReplacer.Replace(strings.TrimSpace(name))
+}
+
+// Put writes the file and its description, the outcome is the one Commons would report for
+// the same content. A dry run only compares with the files already written
+func (d *localDestination) Put(ctx context.Context, file DestinationFile, data StartData) (string, string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return file.FileName, "", "", err
+	}
+
+	filePath := filepath.Join(d.dir, exportFileName(file.FileName))
+	descriptionPath := filePath + exportDescriptionExt
+	description := strings.TrimSpace(file.Description)
+
+	existing, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if data.DryRun {
+			return file.FileName, "uploaded", description, nil
+		}
+		if err := d.write(filePath, file.File, descriptionPath, description); err != nil {
+			return file.FileName, "", "", err
+		}
+		return file.FileName, "uploaded", description, nil
+	}
+	if err != nil {
+		return file.FileName, "", "", err
+	}
+
+	existingDescription, err := os.ReadFile(descriptionPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return file.FileName, "", "", err
+	}
+	if err == nil {
+		switch data.DescriptionOverwriteBehaviour {
+		case models.DescriptionOverwriteBehaviourExceptCategories:
+			description = keepExistingCategories(description, string(existingDescription))
+		case models.DescriptionOverwriteBehaviourOnlyFile:
+			description = string(existingDescription)
+		}
+	}
+
+	status := "overwritten"
+	if bytes.Equal(existing, file.File) {
+		if strings.TrimSpace(string(existingDescription)) == strings.TrimSpace(description) {
+			return file.FileName, "skipped", description, nil
+		}
+		status = "description_updated"
+	}
+
+	if data.DryRun {
+		return file.FileName, status, description, nil
+	}
+	if err := d.write(filePath, file.File, descriptionPath, description); err != nil {
+		return file.FileName, "", "", err
+	}
+	return file.FileName, status, description, nil
+}
+
+func (d *localDestination) write(filePath string, content []byte, descriptionPath, description string) error {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("error writing export file: %w", err)
+	}
+	if err := os.WriteFile(descriptionPath, []byte(description), 0644); err != nil {
+		return fmt.Errorf("error writing export description: %w", err)
+	}
+	return nil
+}
+
+// PutPage writes the page to a .wikitext file named after title
+func (d *localDestination) PutPage(ctx context.Context, title, wikiText string) (string, error) {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, exportFileName(title)+exportDescriptionExt), []byte(wikiText), 0644); err != nil {
+		return "", fmt.Errorf("error writing export page: %w", err)
+	}
+	return title, nil
+}
+
+// Finish writes the manifest of the files the task stored and archives the export directory
+func (d *localDestination) Finish(task *models.Task) error {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	if err := d.writeManifest(task); err != nil {
+		return err
+	}
+	return d.writeArchive()
+}
+
+func (d *localDestination) writeManifest(task *models.Task) error {
+	taskProcesses, err := models.FindTaskProcessesByTaskId(task.ID)
+	if err != nil {
+		return err
+	}
+
+	manifest := exportManifest{
+		TaskId:    task.ID,
+		Url:       task.URL,
+		CreatedAt: time.Now().Unix(),
+		Files:     make([]exportManifestFile, 0, len(taskProcesses)),
+	}
+	for _, taskProcess := range taskProcesses {
+		if taskProcess.FileName == "" || taskProcess.Status == models.TaskProcessStatusFailed {
+			continue
+		}
+		// Rows backfilled from Commons metadata don't have a local file
+		name := exportFileName(taskProcess.FileName)
+		content, err := os.ReadFile(filepath.Join(d.dir, name))
+		if err != nil {
+			continue
+		}
+
+		h := sha1.New()
+		h.Write(content)
+		manifest.Files = append(manifest.Files, exportManifestFile{
+			FileName:        taskProcess.FileName,
+			Path:            name,
+			DescriptionPath: name + exportDescriptionExt,
+			Sha1:            hex.EncodeToString(h.Sum(nil)),
+			Region:          taskProcess.Region,
+			Date:            taskProcess.Date,
+			Type:            taskProcess.Type,
+			Status:          taskProcess.Status,
+		})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(d.dir, exportManifestName), b, 0644)
+}
+
+// writeArchive zips the export directory next to it, replacing the archive of a previous run
+func (d *localDestination) writeArchive() error {
+	archivePath := TaskExportArchive(d.taskId)
+	tmpPath := archivePath + exportArchiveTempName
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	writer := zip.NewWriter(out)
+	err = filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			return err
+		}
+		fileWriter, err := writer.Create(filepath.ToSlash(name))
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(fileWriter, file)
+		return err
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing export archive: %w", err)
+	}
+
+	return os.Rename(tmpPath, archivePath)
+}
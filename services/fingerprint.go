@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wpmed-videowiki/OWIDImporter/env"
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+	"github.com/wpmed-videowiki/OWIDImporter/utils"
+)
+
+// GetChartWatchUrl returns the url used to identify a chart, including the selected chart parameters
+func GetChartWatchUrl(task *models.Task) string {
+	if task.ChartParameters != "" {
+		return utils.AttachQueryParamToUrl(task.URL, task.ChartParameters)
+	}
+	return task.URL
+}
+
+// FetchChartFingerprint reads the grapher config and the data csv of the chart
+// without a browser and hashes them
+func FetchChartFingerprint(chartUrl string) (*models.ChartFingerprint, error) {
+	baseUrl := strings.Split(chartUrl, "?")[0]
+	query := ""
+	if parts := strings.SplitN(chartUrl, "?", 2); len(parts) == 2 {
+		query = parts[1]
+	}
+
+	configBody, err := fetchOWIDResource(baseUrl + ".config.json")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching chart config: %w", err)
+	}
+	configHash := sha1.Sum(configBody)
+
+	csvUrl := baseUrl + ".csv"
+	if query != "" {
+		csvUrl = csvUrl + "?" + query
+	}
+	csvBody, err := fetchOWIDResource(csvUrl)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching chart data: %w", err)
+	}
+	dataHash := sha1.Sum(csvBody)
+
+	return &models.ChartFingerprint{
+		ChartUrl:   chartUrl,
+		ConfigHash: hex.EncodeToString(configHash[:]),
+		DataHash:   hex.EncodeToString(dataHash[:]),
+		EndYear:    getCSVEndYear(string(csvBody)),
+		CheckedAt:  time.Now().Unix(),
+	}, nil
+}
+
+// ChartFingerprintChanged compares a fresh fingerprint against the stored one
+func ChartFingerprintChanged(stored, current *models.ChartFingerprint) bool {
+	return stored.ConfigHash != current.ConfigHash || stored.DataHash != current.DataHash || stored.EndYear != current.EndYear
+}
+
+// WatchTaskChart starts watching the task's chart using its current state as the baseline
+func WatchTaskChart(task *models.Task) (*models.ChartFingerprint, error) {
+	fingerprint, err := FetchChartFingerprint(GetChartWatchUrl(task))
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint.TaskId = task.ID
+	fingerprint.UserId = task.UserId
+	if err := fingerprint.Save(); err != nil {
+		return nil, err
+	}
+
+	return fingerprint, nil
+}
+
+// RefreshChartFingerprint stores the chart's state after a successful run, only for watched charts.
+// Dry runs keep the stored state, nothing reached Commons
+func RefreshChartFingerprint(task *models.Task) {
+	if task.DryRun == 1 {
+		return
+	}
+
+	chartUrl := GetChartWatchUrl(task)
+	stored, err := models.FindChartFingerprint(chartUrl, task.UserId)
+	if err != nil || stored == nil {
+		return
+	}
+
+	fingerprint, err := FetchChartFingerprint(chartUrl)
+	if err != nil {
+		fmt.Println("Error refreshing chart fingerprint", chartUrl, err)
+		return
+	}
+
+	fingerprint.TaskId = task.ID
+	fingerprint.UserId = stored.UserId
+	fingerprint.ChangedAt = stored.ChangedAt
+	fingerprint.CreatedAt = stored.CreatedAt
+	if err := fingerprint.Save(); err != nil {
+		fmt.Println("Error saving chart fingerprint", chartUrl, err)
+	}
+}
+
+func fetchOWIDResource(url string) ([]byte, error) {
+	return fetchOWIDResourceWithContext(context.Background(), url)
+}
+
+func fetchOWIDResourceWithContext(ctx context.Context, url string) ([]byte, error) {
+	client := http.Client{Timeout: time.Minute}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", env.GetEnv().OWID_UA)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+func getCSVEndYear(content string) string {
+	reader := csv.NewReader(strings.NewReader(content))
+	header, err := reader.Read()
+	if err != nil {
+		return ""
+	}
+
+	column := -1
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "year" || name == "day" {
+			column = i
+			break
+		}
+	}
+	if column == -1 {
+		return ""
+	}
+
+	endYear := ""
+	endYearNumber := 0
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			break
+		}
+		if column >= len(record) {
+			continue
+		}
+		value := strings.TrimSpace(record[column])
+		if number, err := strconv.Atoi(value); err == nil {
+			if endYear == "" || number > endYearNumber {
+				endYear = value
+				endYearNumber = number
+			}
+		} else if value > endYear {
+			// Dates are in ISO format, they compare as strings
+			endYear = value
+		}
+	}
+
+	return endYear
+}
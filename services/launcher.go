@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
@@ -20,27 +21,50 @@ func GetLauncher() *launcher.Launcher {
 	return l
 }
 
-func GetBrowser() (*launcher.Launcher, *rod.Browser) {
-	e := env.GetEnv()
-	if e.OWID_ROD_BROWSER_DIR != "" {
-		launcher.DefaultBrowserDir = e.OWID_ROD_BROWSER_DIR // "/workspace/.cache/rod/browser"
-	}
-	// Download browser if not available
-	b := launcher.NewBrowser()
-	if e.OWID_ROD_BROWSER_DIR != "" {
-		b.RootDir = e.OWID_ROD_BROWSER_DIR // "/workspace/.cache/rod/browser";
-	}
+var (
+	browserBinPath     string
+	browserBinPathOnce sync.Once
+)
 
-	b.Hosts = []launcher.Host{launcher.HostNPM, launcher.HostPlaywright}
-	binPath, err := b.Get()
+// getBrowserBinPath downloads the browser if not available, only once per process
+func getBrowserBinPath() string {
+	browserBinPathOnce.Do(func() {
+		e := env.GetEnv()
+		if e.OWID_ROD_BROWSER_DIR != "" {
+			launcher.DefaultBrowserDir = e.OWID_ROD_BROWSER_DIR // "/workspace/.cache/rod/browser"
+		}
+		// Download browser if not available
+		b := launcher.NewBrowser()
+		if e.OWID_ROD_BROWSER_DIR != "" {
+			b.RootDir = e.OWID_ROD_BROWSER_DIR // "/workspace/.cache/rod/browser";
+		}
+
+		b.Hosts = []launcher.Host{launcher.HostNPM, launcher.HostPlaywright}
+		binPath, err := b.Get()
+		if err != nil {
+			fmt.Println("Error getting browser", err)
+		}
+		browserBinPath = binPath
+	})
+
+	return browserBinPath
+}
+
+// launchBrowser starts a new Chromium process, browsers are launched by the pool only
+func launchBrowser() (*launcher.Launcher, *rod.Browser, error) {
+	l := launcher.New().Bin(getBrowserBinPath())
+
+	control, err := l.Set("--no-sandbox").HeadlessNew(HEADLESS).Launch()
 	if err != nil {
-		fmt.Println("Error getting browser", err)
+		return nil, nil, err
 	}
 
-	l := launcher.New().Bin(binPath)
-
-	control := l.Set("--no-sandbox").HeadlessNew(HEADLESS).MustLaunch()
-	browser := rod.New().ControlURL(control).MustConnect()
+	browser := rod.New().ControlURL(control)
+	if err := browser.Connect(); err != nil {
+		l.Kill()
+		l.Cleanup()
+		return nil, nil, err
+	}
 
-	return l, browser
+	return l, browser, nil
 }
@@ -6,13 +6,16 @@ import (
 	"encoding/xml"
 	"fmt"
 	"html"
+	neturl "net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/input"
@@ -20,16 +23,26 @@ import (
 	"github.com/wpmed-videowiki/OWIDImporter/constants"
 	"github.com/wpmed-videowiki/OWIDImporter/env"
 	"github.com/wpmed-videowiki/OWIDImporter/models"
+	"github.com/wpmed-videowiki/OWIDImporter/owidparser"
 	svgprocessor "github.com/wpmed-videowiki/OWIDImporter/svg_processor"
 	"github.com/wpmed-videowiki/OWIDImporter/utils"
 	"golang.org/x/sync/errgroup"
 )
 
-func StartMap(taskId string, user *models.User, data StartData) error {
+func StartMap(ctx context.Context, taskId string, user *models.User, data StartData) error {
 	task, err := models.FindTaskById(taskId)
 	if err != nil {
 		return err
 	}
+	// Cancelled or paused while waiting for a slot
+	if task.Status == models.TaskStatusCancelled || task.Status == models.TaskStatusPaused {
+		return nil
+	}
+	// The stored task decides, a dry run never writes whatever the caller passed
+	data.DryRun = task.DryRun == 1
+
+	ctx, runtime := StartTaskRuntime(ctx, task.ID)
+	defer runtime.Stop()
 
 	task.Status = models.TaskStatusProcessing
 	if err := task.Update(); err != nil {
@@ -55,7 +68,19 @@ func StartMap(taskId string, user *models.User, data StartData) error {
 		return err
 	}
 
-	l, browser := GetBrowser()
+	lease, err := LeaseBrowser(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			stopInterruptedTask(ctx, task, runtime)
+			return ctx.Err()
+		}
+		fmt.Println("Error leasing browser: ", err)
+		task.Status = models.TaskStatusFailed
+		task.Update()
+		utils.SendWSTask(task)
+		return err
+	}
+	browser := lease.Browser
 	_ = browser.MustPage("")
 	chartInfo, err := GetChartInfo(browser, url, data.TemplateNameFormat, task.ChartParameters)
 	if err != nil {
@@ -63,13 +88,24 @@ func StartMap(taskId string, user *models.User, data StartData) error {
 		task.Status = models.TaskStatusFailed
 		task.Update()
 		utils.SendWSTask(task)
-		browser.Close()
-		l.Cleanup()
+		lease.Release()
 		return fmt.Errorf("Error getting chart info")
 	}
 
-	browser.Close()
-	l.Cleanup()
+	if len(task.Regions) > 0 && !chartInfo.SingleImage {
+		unavailableRegions := GetUnavailableMapRegions(ctx, browser, url, task.Regions)
+		if len(unavailableRegions) > 0 {
+			fmt.Println("Chart map doesn't offer regions: ", unavailableRegions)
+			task.Status = models.TaskStatusFailed
+			task.Update()
+			utils.SendWSTask(task)
+			lease.Release()
+			return fmt.Errorf("chart map doesn't offer regions %s", strings.Join(unavailableRegions, ", "))
+		}
+	}
+
+	lease.Release()
+	recordUnmatchedEntities(task, models.TaskUnmatchedEntitySourcePage, chartInfo.UnmatchedEntities)
 
 	task.ChartName = chartInfo.ChartName
 	if task.ChartName == "" {
@@ -99,7 +135,11 @@ func StartMap(taskId string, user *models.User, data StartData) error {
 	// Check for being a single image
 	if chartInfo.SingleImage {
 		// Direct upload
-		if err := processSingleImage(task, user, chartInfo, tmpDir, data); err != nil {
+		if err := processSingleImage(ctx, task, user, chartInfo, tmpDir, data); err != nil {
+			if ctx.Err() != nil {
+				stopInterruptedTask(ctx, task, runtime)
+				return ctx.Err()
+			}
 			task.Status = models.TaskStatusFailed
 			task.Update()
 			utils.SendWSTask(task)
@@ -109,6 +149,7 @@ func StartMap(taskId string, user *models.User, data StartData) error {
 		task.Status = models.TaskStatusDone
 		task.Update()
 		utils.SendWSTask(task)
+		completeTask(task, data)
 		return nil
 	}
 
@@ -137,28 +178,9 @@ func StartMap(taskId string, user *models.User, data StartData) error {
 
 	// startTime := time.Now()
 
-	done := false
-	defer func() {
-		done = true
-	}()
-
-	// Reload task every 5 sec to handle cancellation
-	go func() {
-		for {
-			time.Sleep(5 * time.Second)
-			if done {
-				break
-			}
-			task.Reload()
-			if task.Status != models.TaskStatusProcessing {
-				break
-			}
-		}
-	}()
-
 	if task.ImportCountries == 1 && task.Status == models.TaskStatusProcessing {
 		fmt.Print("================= STARTED IMPORTING COUNTRIES")
-		if err := processCountries(chartInfo, user, task, data.Url, tmpDir, title, startYear, endYear, chartParamsMap); err != nil {
+		if err := processCountries(ctx, chartInfo, user, task, data.Url, tmpDir, title, startYear, endYear, chartParamsMap); err != nil && ctx.Err() == nil {
 			task.Status = models.TaskStatusFailed
 			task.Update()
 			utils.SendWSTask(task)
@@ -166,14 +188,23 @@ func StartMap(taskId string, user *models.User, data StartData) error {
 		}
 	}
 
-	if task.Status == models.TaskStatusProcessing {
+	if task.Status == models.TaskStatusProcessing && ctx.Err() == nil {
 		// Process regions
-		processRegions(task, user, tmpDir, title, chartParamsMap, data)
+		if grapherData := getTaskGrapherData(ctx, task, data, tmpDir, endYear); grapherData != nil {
+			processRegionsFromData(ctx, task, user, grapherData, tmpDir, title, endYear, chartParamsMap, data)
+		} else {
+			processRegions(ctx, task, user, tmpDir, title, chartParamsMap, data)
+		}
+	}
+
+	if ctx.Err() != nil {
+		stopInterruptedTask(ctx, task, runtime)
+		return ctx.Err()
 	}
 
 	if task.Status == models.TaskStatusProcessing {
 		if data.GenerateTemplateCommons {
-			processCommonsTemplate(task, user)
+			processCommonsTemplate(ctx, task, user)
 		}
 
 		task.Status = models.TaskStatusDone
@@ -184,22 +215,15 @@ func StartMap(taskId string, user *models.User, data StartData) error {
 
 	utils.SendWSTask(task)
 
+	if task.Status == models.TaskStatusDone {
+		completeTask(task, data)
+	}
+
 	return nil
 }
 
-func processSingleImage(task *models.Task, user *models.User, chartInfo *ChartInfo, tmpDir string, data StartData) error {
+func processSingleImage(ctx context.Context, task *models.Task, user *models.User, chartInfo *ChartInfo, tmpDir string, data StartData) error {
 	fmt.Println("===================== Prcessing Single Image ===============", task.URL)
-	tokenResponse, err := utils.DoApiReq[TokenResponse](user, map[string]string{
-		"action": "query",
-		"meta":   "tokens",
-		"format": "json",
-	}, nil)
-	if err != nil {
-		fmt.Println("Error fetching edit token", err)
-		return err
-	}
-	token := tokenResponse.Query.Tokens.CsrfToken
-
 	var taskProcess *models.TaskProcess
 	// Try to find existing process, otherwise create one
 	existingTB, err := models.FindTaskProcessByTaskRegionDate("ALL", "", task.ID)
@@ -226,14 +250,14 @@ func processSingleImage(task *models.Task, user *models.User, chartInfo *ChartIn
 		return fmt.Errorf("Error creating download directory")
 	}
 
-	l, browser := GetBrowser()
-	blankPage := browser.MustPage("")
-
-	defer blankPage.Close()
-	defer l.Cleanup()
-	defer browser.Close()
+	lease, err := LeaseBrowser(ctx)
+	if err != nil {
+		FailTaskProcess(taskProcess)
+		return err
+	}
+	defer lease.Release()
 
-	page := browser.MustPage("")
+	page := lease.Browser.MustPage("")
 	page.MustSetUserAgent(&proto.NetworkSetUserAgentOverride{UserAgent: env.GetEnv().OWID_UA})
 	page.MustSetViewport(constants.VIEWPORT_WIDTH, constants.VIEWPORT_HEIGHT, 1, false)
 	page.MustNavigate(task.URL)
@@ -244,7 +268,7 @@ func processSingleImage(task *models.Task, user *models.User, chartInfo *ChartIn
 		return fmt.Errorf("Cannot find download button in page")
 	}
 
-	wait := page.Browser().WaitDownload(downloadPath)
+	wait := waitPageDownload(page, downloadPath)
 	downloadBtn := page.MustElement(DOWNLOAD_BUTTON_SELECTOR)
 	downloadBtn.MustFocus()
 	time.Sleep(time.Millisecond * 200)
@@ -288,7 +312,7 @@ func processSingleImage(task *models.Task, user *models.User, chartInfo *ChartIn
 		Comment:  "Importing from " + data.Url,
 	}
 
-	filename, status, err := uploadMapFile(user, token, replaceData, downloadPath, data)
+	filename, status, description, err := uploadMapFile(withTaskProcessRetries(ctx, taskProcess), user, replaceData, downloadPath, data)
 	if err != nil {
 		FailTaskProcess(taskProcess)
 		fmt.Println("Uplaod error: ", err)
@@ -296,6 +320,7 @@ func processSingleImage(task *models.Task, user *models.User, chartInfo *ChartIn
 	}
 
 	taskProcess.FileName = filename
+	taskProcess.Description = description
 	switch status {
 	case "skipped":
 		taskProcess.Status = models.TaskProcessStatusSkipped
@@ -315,29 +340,21 @@ func processSingleImage(task *models.Task, user *models.User, chartInfo *ChartIn
 	return nil
 }
 
-func processCommonsTemplate(task *models.Task, user *models.User) {
+func processCommonsTemplate(ctx context.Context, task *models.Task, user *models.User) {
 	// Create template page in commons
 	fmt.Print("============= GENERTING COMMONS TEMPLATE")
 	wikiText, err := GetMapTemplate(task.ID)
 	fmt.Println("GOT WIKITEXT: ", err)
-	if err == nil {
-		tokenResponse, err := utils.DoApiReq[TokenResponse](user, map[string]string{
-			"action": "query",
-			"meta":   "tokens",
-			"format": "json",
-		}, nil)
-
-		if err != nil {
-			fmt.Println("Error fetching edit token", err)
-		} else if tokenResponse.Query.Tokens.CsrfToken != "" {
-			token := tokenResponse.Query.Tokens.CsrfToken
-			title, err := createCommonsTemplatePage(user, token, task.CommonsTemplateName, wikiText)
-			if err == nil {
-				task.CommonsTemplateName = title
-				fmt.Print("=============== DONE CREATING COMMONS TEMPLATE")
-			} else {
-				fmt.Println("Error creating commons template page: ", err)
-			}
+	if err == nil && task.DryRun == 1 {
+		// The template is still returned with the task, only the page isn't written
+		fmt.Println("Dry run: would create commons template page", task.CommonsTemplateName)
+	} else if err == nil {
+		title, err := NewTaskDestination(task, user).PutPage(ctx, task.CommonsTemplateName, wikiText)
+		if err == nil {
+			task.CommonsTemplateName = title
+			fmt.Print("=============== DONE CREATING COMMONS TEMPLATE")
+		} else {
+			fmt.Println("Error creating commons template page: ", err)
 		}
 	} else {
 		fmt.Println("Error getting task wikitext", task.ID, err)
@@ -345,22 +362,22 @@ func processCommonsTemplate(task *models.Task, user *models.User) {
 
 }
 
-func processRegions(task *models.Task, user *models.User, tmpDir, title string, chartParamsMap map[string]string, data StartData) {
-	regionGroup, _ := errgroup.WithContext(context.Background())
+func processRegions(ctx context.Context, task *models.Task, user *models.User, tmpDir, title string, chartParamsMap map[string]string, data StartData) {
+	regionGroup, ctx := errgroup.WithContext(ctx)
 	regionGroup.SetLimit(constants.CONCURRENT_REQUESTS)
 
-	for index, region := range constants.REGIONS {
-		if task.Status != models.TaskStatusProcessing {
+	for index, region := range getTaskRegions(task) {
+		if task.Status != models.TaskStatusProcessing || ctx.Err() != nil {
 			break
 		}
 		region := region
 		regionGroup.Go(func(region string, index int) func() error {
 			return func() error {
-				if task.Status != models.TaskStatusProcessing {
+				if task.Status != models.TaskStatusProcessing || ctx.Err() != nil {
 					return nil
 				}
 				time.Sleep(time.Second * time.Duration(index*3))
-				err := processRegion(user, task, task.ChartName, region, filepath.Join(tmpDir, region), chartParamsMap, title, data)
+				err := processRegion(ctx, user, task, task.ChartName, region, filepath.Join(tmpDir, region), chartParamsMap, title, data)
 				fmt.Print("============= FINISHED PROCESSING REGION: ", region)
 				if err != nil {
 					fmt.Println("Error in processing some of the region", region)
@@ -375,101 +392,108 @@ func processRegions(task *models.Task, user *models.User, tmpDir, title string,
 	fmt.Println("================= FINISHED PROCESSING ALL REGIONS ==================")
 }
 
-func processCountries(chartInfo *ChartInfo, user *models.User, task *models.Task, url, tmpDir, title, startYear, endYear string, chartParamsMap map[string]string) error {
+func processCountries(ctx context.Context, chartInfo *ChartInfo, user *models.User, task *models.Task, url, tmpDir, title, startYear, endYear string, chartParamsMap map[string]string) error {
+	countriesStartData := StartData{
+		Url:                           url,
+		FileName:                      task.CountryFileName,
+		Description:                   task.CountryDescription,
+		DescriptionOverwriteBehaviour: task.CountryDescriptionOverwriteBehaviour,
+		DryRun:                        task.DryRun == 1,
+		Destination:                   NewTaskDestination(task, user),
+	}
+
 	if chartInfo.HasCountries {
 		fmt.Println("======= Has Countries, using regular flow ========")
+		return processCountriesList(ctx, chartInfo, user, task, tmpDir, title, startYear, endYear, chartParamsMap, countriesStartData)
+	}
 
-		tokenResponse, err := utils.DoApiReq[TokenResponse](user, map[string]string{
-			"action": "query",
-			"meta":   "tokens",
-			"format": "json",
-		}, nil)
-		if err != nil {
-			fmt.Println("Error fetching edit token", err)
-			return err
-		}
-		token := tokenResponse.Query.Tokens.CsrfToken
+	fmt.Println("============= Doesn't have countries, downloading popup chart instead ===============")
+	countriesDir := path.Join(tmpDir, "countries")
+	err := os.Mkdir(countriesDir, 0755)
+	if err == nil {
+		ProcessCountriesFromPopover(ctx, user, task, task.ChartName, title, startYear, endYear, countriesDir, countriesStartData, chartParamsMap)
+	} else {
+		fmt.Println("Error creating countries directory: ", err)
+	}
 
-		done := false
+	return nil
+}
 
-		defer func() {
-			done = true
-		}()
+// processCountriesList downloads and uploads the line/chart tab of every country in
+// chartInfo.CountriesList, splitting the list between CONCURRENT_REQUESTS browsers
+func processCountriesList(ctx context.Context, chartInfo *ChartInfo, user *models.User, task *models.Task, tmpDir, title, startYear, endYear string, chartParamsMap map[string]string, data StartData) error {
+	// Don't open browsers for countries that were already processed before a restart
+	countriesList := getPendingCountries(task, filterTaskCountries(task, chartInfo.CountriesList))
+	if len(countriesList) == 0 {
+		fmt.Println("All countries already processed")
+		return nil
+	}
 
-		go func() {
-			for {
-				time.Sleep(time.Second * 20)
-				if task.Status != models.TaskStatusProcessing || done {
-					break
-				}
-				tokenResponse, err := utils.DoApiReq[TokenResponse](user, map[string]string{
-					"action": "query",
-					"meta":   "tokens",
-					"format": "json",
-				}, nil)
+	fmt.Println("Countries:====================== ", countriesList)
+
+	countryGroup, ctx := errgroup.WithContext(ctx)
+	countryGroup.SetLimit(constants.CONCURRENT_REQUESTS)
+
+	countrySlices := utils.SplitSlice(countriesList, constants.CONCURRENT_REQUESTS)
+	startTime := time.Now()
+
+	for _, countryList := range countrySlices {
+		if task.Status != models.TaskStatusProcessing || ctx.Err() != nil {
+			break
+		}
+		countryList := countryList
+		countryGroup.Go(func(countryList []string) func() error {
+			return func() error {
+				// A failed slice doesn't stop the others
+				err := TraverseDownloadCountriesList(ctx, user, task, task.ChartName, title, startYear, endYear, tmpDir, data, chartParamsMap, countryList)
 				if err != nil {
-					fmt.Println("Error fetching edit token", err)
-				} else if tokenResponse.Query.Tokens.CsrfToken != "" {
-					token = tokenResponse.Query.Tokens.CsrfToken
+					fmt.Println("Error processing countries", err)
 				}
+				return nil
 			}
-		}()
+		}(countryList))
+	}
+	countryGroup.Wait()
 
-		fmt.Println("Countries:====================== ", chartInfo.CountriesList)
+	fmt.Println("Finished in", time.Since(startTime).String())
 
-		countryGroup, _ := errgroup.WithContext(context.Background())
-		countryGroup.SetLimit(constants.CONCURRENT_REQUESTS)
+	return nil
+}
 
-		countrySlices := utils.SplitSlice(chartInfo.CountriesList, constants.CONCURRENT_REQUESTS)
-		startTime := time.Now()
+// recordUnmatchedEntities reports the entity names the task couldn't import on the task
+func recordUnmatchedEntities(task *models.Task, source string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	fmt.Println("Entities not in the registry: ", source, names)
+	if err := models.AddTaskUnmatchedEntities(task.ID, source, names); err != nil {
+		fmt.Println("Error recording unmatched entities", task.ID, err)
+	}
+}
 
-		for _, countryList := range countrySlices {
-			if task.Status != models.TaskStatusProcessing {
-				break
-			}
-			countryList := countryList
-			// countryList := make([]string, 0)
-			// countryList = append(countryList, "NAM")
-			countryGroup.Go(func(countryList []string) func() error {
-				return func() error {
-					countriesStartData := StartData{
-						Url:                           url,
-						FileName:                      task.CountryFileName,
-						Description:                   task.CountryDescription,
-						DescriptionOverwriteBehaviour: task.CountryDescriptionOverwriteBehaviour,
-					}
-					err = TraverseDownloadCountriesList(user, task, &token, task.ChartName, title, startYear, endYear, tmpDir, countriesStartData, chartParamsMap, countryList)
+// getPendingCountries returns the country codes that have no task process yet or whose process failed
+func getPendingCountries(task *models.Task, countriesList []string) []string {
+	taskProcesses, err := models.FindTaskProcessesByTaskId(task.ID)
+	if err != nil {
+		fmt.Println("Error finding task processes for countries", err)
+		return countriesList
+	}
 
-					if err != nil {
-						fmt.Println("Error processing countries", err)
-						return err
-					}
-					return nil
-				}
-			}(countryList))
+	processed := make(map[string]bool)
+	for _, taskProcess := range taskProcesses {
+		if taskProcess.Type == models.TaskProcessTypeCountry && taskProcess.Status != models.TaskProcessStatusFailed {
+			processed[taskProcess.Region] = true
 		}
-		countryGroup.Wait()
+	}
 
-		elapsedTime := time.Since(startTime)
-		fmt.Println("Started in", time.Since(startTime).String())
-		fmt.Println("Finished in", elapsedTime.String())
-	} else {
-		fmt.Println("============= Doesn't have countries, downloading popup chart instead ===============")
-		countriesDir := path.Join(tmpDir, "countries")
-		err := os.Mkdir(countriesDir, 0755)
-		if err == nil {
-			ProcessCountriesFromPopover(user, task, task.ChartName, title, startYear, endYear, countriesDir, StartData{
-				Url:                           url,
-				FileName:                      task.CountryFileName,
-				Description:                   task.CountryDescription,
-				DescriptionOverwriteBehaviour: task.CountryDescriptionOverwriteBehaviour,
-			}, chartParamsMap)
-		} else {
-			fmt.Println("Error creating countries directory: ", err)
+	pending := make([]string, 0)
+	for _, code := range countriesList {
+		if !processed[code] {
+			pending = append(pending, code)
 		}
 	}
 
-	return nil
+	return pending
 }
 
 type ChartParameter struct {
@@ -485,17 +509,18 @@ type ChartParameterChoice struct {
 }
 
 type ChartInfo struct {
-	Params        *[]ChartParameter `json:"params"`
-	ParamsMap     map[string]string `json:"paramsMap"`
-	StartYear     string            `json:"startYear"`
-	EndYear       string            `json:"endYear"`
-	Title         string            `json:"title"`
-	ChartName     string            `json:"chartName"`
-	TemplateName  string            `json:"templateName"`
-	HasCountries  bool              `json:"hasCountries"`
-	CountriesList []string          `json:"countriesList"`
-	StableUrl     string            `json:"stableUrl"`
-	SingleImage   bool              `json:"singleImage"`
+	Params            *[]ChartParameter `json:"params"`
+	ParamsMap         map[string]string `json:"paramsMap"`
+	StartYear         string            `json:"startYear"`
+	EndYear           string            `json:"endYear"`
+	Title             string            `json:"title"`
+	ChartName         string            `json:"chartName"`
+	TemplateName      string            `json:"templateName"`
+	HasCountries      bool              `json:"hasCountries"`
+	CountriesList     []string          `json:"countriesList"`
+	UnmatchedEntities []string          `json:"unmatchedEntities"` // Listed names the entity registry doesn't know
+	StableUrl         string            `json:"stableUrl"`
+	SingleImage       bool              `json:"singleImage"`
 }
 
 /*
@@ -574,9 +599,10 @@ func GetChartInfo(browser *rod.Browser, url, chartFormat, selectedParams string)
 			chartInfo.StartYear = startYear
 			chartInfo.EndYear = endYear
 			chartInfo.Title = title
-			hasCountries, countriesList := getMapHasCountriesFromPage(page)
+			hasCountries, countriesList, unmatchedNames := getMapHasCountriesFromPage(page)
 			chartInfo.HasCountries = hasCountries
 			chartInfo.CountriesList = countriesList
+			chartInfo.UnmatchedEntities = unmatchedNames
 			fmt.Println("GOT HasCountries", chartInfo.HasCountries)
 
 			chartName, err := GetChartNameFromUrl(url)
@@ -719,17 +745,28 @@ func GetChartParameters(browser *rod.Browser, url string) *[]ChartParameter {
 	return &params
 }
 
-func traverseDownloadRegion(task *models.Task, data StartData, user *models.User, chartParams map[string]string, token *string, chartName, title, region, url, downloadPath string) {
-	regionStr := region
-	if regionStr == "NorthAmerica" {
-		regionStr = "North America"
-	}
-	if regionStr == "SouthAmerica" {
-		regionStr = "South America"
-	}
+func traverseDownloadRegion(ctx context.Context, task *models.Task, data StartData, user *models.User, chartParams map[string]string, chartName, title, region, url, downloadPath string) {
+	regionStr := getRegionDisplayName(region)
 
-	l, browser := GetBrowser()
-	blankPage := browser.MustPage("")
+	lease, err := LeaseBrowser(ctx)
+	if err != nil {
+		fmt.Println("Error leasing browser for region: ", region, err)
+		return
+	}
+	// The lease gets renewed while traversing, release whichever one is current
+	defer func() {
+		lease.Release()
+	}()
+	// Browser operations fail as soon as the task is cancelled, stop quietly then
+	defer func() {
+		if r := recover(); r != nil {
+			if ctx.Err() == nil {
+				panic(r)
+			}
+			fmt.Println("Stopped traversing region: ", region, r)
+		}
+	}()
+	browser := lease.Browser.Context(ctx)
 
 	page := browser.MustPage("")
 	page.MustSetUserAgent(&proto.NetworkSetUserAgentOverride{UserAgent: env.GetEnv().OWID_UA})
@@ -796,8 +833,12 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 		}
 
 		triedUsingCommonsTemplate := false
+		// The checkpoint only moves forward while no year of this run failed, so
+		// resuming from it never skips a year that needs a retry
+		checkpointContiguous := true
 
-		for task.Status == models.TaskStatusProcessing {
+		// On shutdown the year being processed is finished so the checkpoint stays accurate
+		for task.Status == models.TaskStatusProcessing && ctx.Err() == nil {
 			counter = counter + 1
 			if owidEnv == "development" && counter >= 5 {
 				// break
@@ -808,11 +849,15 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 				currentUrl := page.MustInfo().URL
 
 				page.Close()
-				browser.Close()
-				l.Cleanup()
+				lease.Release()
 
-				l, browser = GetBrowser()
-				blankPage = browser.MustPage("")
+				newLease, err := LeaseBrowser(ctx)
+				if err != nil {
+					fmt.Println("Error leasing browser for region: ", region, err)
+					break
+				}
+				lease = newLease
+				browser = lease.Browser.Context(ctx)
 
 				page = browser.MustPage("")
 				page.MustSetUserAgent(&proto.NetworkSetUserAgentOverride{UserAgent: env.GetEnv().OWID_UA})
@@ -841,20 +886,19 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 			startMarker = page.MustElement(START_MARKER_SELECTOR)
 			endMarker = page.MustElement(END_MARKER_SELECTOR)
 
-			currentYear := ""
-			if startMarker != nil {
-				if attr, err := startMarker.Attribute("aria-valuenow"); err == nil && *attr != "" {
-					currentYear = *attr
-				}
-			}
+			currentYear := getMarkerYear(startMarker, endMarker)
 
-			if endMarker != nil {
-				if attr, err := endMarker.Attribute("aria-valuenow"); err == nil && *attr != "" {
-					currentYear = *attr
+			// Years left out by the filter are jumped over without downloading
+			if !task.YearFilter.IncludesDate(currentYear) {
+				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear, task.YearFilter) {
+					continue
+				} else {
+					break
 				}
 			}
 
 			year := currentYear
+			setTaskPosition(task.ID, region, fmt.Sprintf("%s/%s", regionStr, year))
 
 			replaceData := ReplaceVarsData{
 				Url:      data.Url,
@@ -875,7 +919,7 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 					fmt.Println("Start year: ", startYear, filename)
 					if startYear != "" {
 						// Update replacedata year to the startYear
-						err := handleExistingMetadataCommonsFile(replaceData, regionExistingData, startYear, data, downloadPath, user, task, region, token)
+						err := handleExistingMetadataCommonsFile(ctx, replaceData, regionExistingData, startYear, data, downloadPath, user, task, region)
 						if err == nil {
 							break
 						} else {
@@ -891,7 +935,10 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 			existingTB, err := models.FindTaskProcessByTaskRegionDate(region, year, task.ID)
 			if existingTB != nil {
 				if existingTB.Status != models.TaskProcessStatusFailed {
-					if moveToNextYear(page, startMarker, endMarker, currentYear, startYear) {
+					if checkpointContiguous {
+						saveRegionCheckpoint(page, task, region, year)
+					}
+					if moveToNextYear(page, startMarker, endMarker, currentYear, startYear, task.YearFilter) {
 						continue
 					} else {
 						break
@@ -909,6 +956,8 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 					break
 				}
 			}
+			yearContiguous := checkpointContiguous
+			checkpointContiguous = false
 
 			mapPath := filepath.Join(downloadPath, currentYear)
 			if err := utils.WaitElementWithTimeout(page, DOWNLOAD_BUTTON_SELECTOR, time.Second*5); err != nil {
@@ -926,13 +975,13 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 				fmt.Println(fmt.Sprintf("%s %s %v", url, "Error clicking download button", err))
 				break
 			}
-			wait := page.Browser().WaitDownload(mapPath)
+			wait := waitPageDownload(page, mapPath)
 
 			if err := utils.WaitElementWithTimeout(page, DOWNLOAD_SVG_ICON_SELECTOR, time.Second*10); err != nil {
 				fmt.Println("ERROR waiting for DOWNLOAD_SVG_ICON_SELECTOR for region: ", region, currentYear)
 				FailTaskProcess(taskProcess)
 				CloseDownloadPopup(page)
-				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear) {
+				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear, task.YearFilter) {
 					continue
 				} else {
 					break
@@ -946,7 +995,7 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 				fmt.Printf("%s, %s, %v", url, "Error clicking download svg button", err)
 				FailTaskProcess(taskProcess)
 				CloseDownloadPopup(page)
-				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear) {
+				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear, task.YearFilter) {
 					continue
 				} else {
 					break
@@ -958,7 +1007,7 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 			if _, err = os.Stat(mapPath); os.IsNotExist(err) {
 				FailTaskProcess(taskProcess)
 				CloseDownloadPopup(page)
-				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear) {
+				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear, task.YearFilter) {
 					continue
 				} else {
 					break
@@ -971,7 +1020,7 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 			fileInfo, err := getFileInfo(mapPath)
 			if err != nil {
 				FailTaskProcess(taskProcess)
-				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear) {
+				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear, task.YearFilter) {
 					continue
 				} else {
 					break
@@ -983,7 +1032,7 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 				os.Remove(fileInfo.FilePath)
 				fmt.Printf("Missing map column %s %s %s, retrying", regionStr, currentYear, GetFileNameFromChartName(chartName))
 				FailTaskProcess(taskProcess)
-				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear) {
+				if moveToNextYear(page, startMarker, endMarker, currentYear, startYear, task.YearFilter) {
 					continue
 				} else {
 					break
@@ -1003,98 +1052,173 @@ func traverseDownloadRegion(task *models.Task, data StartData, user *models.User
 			}
 
 			// Collect metadata and inject it if at last file
-			if didReachStartYear(startMarker, endMarker, startYear) {
-				/**
-					We need to check if the file is already uploaded.
-					If it is, download that file and upload it instead if it have translations
-					Make sure to inject metadata again as some new year data might be available
-				**/
-				filename := replaceVars(data.FileName, replaceData)
-				existingMapPath := filepath.Join(downloadPath, currentYear+"_existing")
-				existingMapFilePath := path.Join(existingMapPath, "image.svg")
-				if err := os.Mkdir(existingMapPath, 0755); err == nil {
-					err := downloadCommonsFile(filename, existingMapFilePath, user)
-					if err == nil {
-						// Check if file has translation switch
-						if SVGHasSwitchElement(existingMapFilePath) {
-							newFileInfo, err := getFileInfo(existingMapPath)
-							if err == nil {
-								fileInfo = newFileInfo
-								mapPath = existingMapPath
-								fmt.Println("============= NEW FILE INFO: ", fileInfo.FilePath)
-							} else {
-								fmt.Println("============== ERROR Getting existing file info: ", err)
-							}
-						}
-					} else {
-						fmt.Println("============ ERROR DOWNLOADING commons file: ", err)
-					}
-				}
+			if didReachStartYear(startMarker, endMarker, startYear) || isLastFilteredYear(task.YearFilter, currentYear, startYear) {
+				mapPath = prepareRegionLastFile(task, user, data, &replaceData, region, downloadPath, currentYear, mapPath, fileInfo)
+			}
 
-				metadata, err := getRegionFileMetadata(task, region)
-				if err != nil {
-					fmt.Println("Error generating metadata: ", err)
-				} else if metadata != "" {
-					if err := InjectMetadataIntoSVGSameFile(fileInfo.FilePath, metadata); err != nil {
-						fmt.Println("Error injecting metadata into svg: ", err)
-					} else {
-						replaceData.Comment = "Importing from " + data.Url + " with metadata"
-					}
-				}
+			if err := uploadRegionYear(ctx, user, replaceData, mapPath, data, task, taskProcess); err == nil && yearContiguous {
+				saveRegionCheckpoint(page, task, region, year)
+				checkpointContiguous = true
 			}
 
-			Filename, status, err := uploadMapFile(user, *token, replaceData, mapPath, data)
-			//  Retry twice
-			if err != nil {
-				taskProcess.Status = models.TaskProcessStatusRetrying
-				taskProcess.Update()
-				utils.SendWSTaskProcess(task.ID, taskProcess)
+			if !moveToNextYear(page, startMarker, endMarker, currentYear, startYear, task.YearFilter) {
+				break
+			}
+		}
+	}
 
-				time.Sleep(time.Second * 2)
-				Filename, status, err = uploadMapFile(user, *token, replaceData, mapPath, data)
-				if err != nil {
-					taskProcess.Status = models.TaskProcessStatusRetrying
-					taskProcess.Update()
-					utils.SendWSTaskProcess(task.ID, taskProcess)
+	if ctx.Err() == nil {
+		clearTaskPosition(task.ID, region)
+	}
+}
 
-					time.Sleep(time.Second * 4)
-					Filename, status, err = uploadMapFile(user, *token, replaceData, mapPath, data)
-				}
+// getTaskRegions returns the map regions the task imports
+func getTaskRegions(task *models.Task) []string {
+	if len(task.Regions) > 0 {
+		return task.Regions
+	}
+	return constants.REGIONS
+}
+
+// GetUnavailableMapRegions returns the regions the map of the chart at url doesn't offer.
+// The grapher drops a region it doesn't know from the page url, the region the map opens
+// on is dropped as well so that one is read from the chart config
+func GetUnavailableMapRegions(ctx context.Context, browser *rod.Browser, url string, regions []string) []string {
+	defaultRegion := "World"
+	configBody, err := fetchOWIDResourceWithContext(ctx, strings.Split(url, "?")[0]+".config.json")
+	if err == nil {
+		var config owidparser.OWIDGrapherConfig
+		if err := json.Unmarshal(configBody, &config); err == nil && config.Map.Region != "" {
+			defaultRegion = config.Map.Region
+		}
+	} else {
+		fmt.Println("Error fetching chart config for regions, assuming World as default: ", err)
+	}
+
+	unavailableRegions := make([]string, 0)
+	for _, region := range regions {
+		if region == defaultRegion {
+			continue
+		}
+
+		pageRegion := ""
+		err := rod.Try(func() {
+			page := browser.Context(ctx).MustPage("")
+			defer page.Close()
+			page.MustSetViewport(constants.VIEWPORT_WIDTH, constants.VIEWPORT_HEIGHT, 1, false)
+			page.MustSetUserAgent(&proto.NetworkSetUserAgentOverride{UserAgent: env.GetEnv().OWID_UA})
+
+			page.MustNavigate(utils.AttachQueryParamToUrl(url, "region="+neturl.QueryEscape(region)))
+			page.MustWaitLoad()
+			page.MustWaitIdle()
+			if err := utils.WaitElementWithTimeout(page, DOWNLOAD_BUTTON_SELECTOR, time.Second*10); err != nil {
+				panic(err)
 			}
 
+			pageUrl, err := neturl.Parse(page.MustInfo().URL)
 			if err != nil {
-				fmt.Println("Error processing", region, year)
-				FailTaskProcess(taskProcess)
-			} else {
-				taskProcess.FileName = Filename
-
-				switch status {
-				case "skipped":
-					taskProcess.Status = models.TaskProcessStatusSkipped
-				case "description_updated":
-					taskProcess.Status = models.TaskProcessStatusDescriptionUpdated
-				case "overwritten":
-					taskProcess.Status = models.TaskProcessStatusOverwritten
-				case "uploaded":
-					taskProcess.Status = models.TaskProcessStatusUploaded
-				}
-
-				taskProcess.Update()
-				utils.SendWSTaskProcess(task.ID, taskProcess)
+				panic(err)
 			}
+			pageRegion = pageUrl.Query().Get("region")
+		})
+		if err != nil {
+			fmt.Println("Error checking map region: ", region, err)
+		}
+		if pageRegion != region {
+			unavailableRegions = append(unavailableRegions, region)
+		}
+	}
 
-			if !moveToNextYear(page, startMarker, endMarker, currentYear, startYear) {
-				break
+	return unavailableRegions
+}
+
+// getRegionDisplayName returns the region name used in file names, e.g. NorthAmerica => North America
+func getRegionDisplayName(region string) string {
+	var name strings.Builder
+	for i, r := range region {
+		if i > 0 && unicode.IsUpper(r) {
+			name.WriteRune(' ')
+		}
+		name.WriteRune(r)
+	}
+	return name.String()
+}
+
+// prepareRegionLastFile swaps the last file of a region for its Commons version when that one has
+// translations, and injects the fills of every year as metadata. It returns the directory to upload
+func prepareRegionLastFile(task *models.Task, user *models.User, data StartData, replaceData *ReplaceVarsData, region, downloadPath, currentYear, mapPath string, fileInfo *FileInfo) string {
+	/**
+		We need to check if the file is already uploaded.
+		If it is, download that file and upload it instead if it have translations
+		Make sure to inject metadata again as some new year data might be available
+	**/
+	filename := replaceVars(data.FileName, *replaceData)
+	existingMapPath := filepath.Join(downloadPath, currentYear+"_existing")
+	existingMapFilePath := path.Join(existingMapPath, "image.svg")
+	if err := os.Mkdir(existingMapPath, 0755); err == nil {
+		err := downloadCommonsFile(filename, existingMapFilePath, user)
+		if err == nil {
+			// Check if file has translation switch
+			if SVGHasSwitchElement(existingMapFilePath) {
+				newFileInfo, err := getFileInfo(existingMapPath)
+				if err == nil {
+					fileInfo = newFileInfo
+					mapPath = existingMapPath
+					fmt.Println("============= NEW FILE INFO: ", fileInfo.FilePath)
+				} else {
+					fmt.Println("============== ERROR Getting existing file info: ", err)
+				}
 			}
+		} else {
+			fmt.Println("============ ERROR DOWNLOADING commons file: ", err)
+		}
+	}
+
+	metadata, err := getRegionFileMetadata(task, region)
+	if err != nil {
+		fmt.Println("Error generating metadata: ", err)
+	} else if metadata != "" {
+		if err := InjectMetadataIntoSVGSameFile(fileInfo.FilePath, metadata); err != nil {
+			fmt.Println("Error injecting metadata into svg: ", err)
+		} else {
+			replaceData.Comment = "Importing from " + data.Url + " with metadata"
 		}
 	}
 
-	blankPage.Close()
-	browser.Close()
-	l.Cleanup()
+	return mapPath
+}
+
+// uploadRegionYear uploads the map of a region/year and stores the outcome on taskProcess
+func uploadRegionYear(ctx context.Context, user *models.User, replaceData ReplaceVarsData, mapPath string, data StartData, task *models.Task, taskProcess *models.TaskProcess) error {
+	Filename, status, description, err := uploadMapFile(withTaskProcessRetries(ctx, taskProcess), user, replaceData, mapPath, data)
+
+	if err != nil {
+		fmt.Println("Error processing", replaceData.Region, replaceData.Year)
+		FailTaskProcess(taskProcess)
+		return err
+	}
+
+	taskProcess.FileName = Filename
+	taskProcess.Description = description
+
+	switch status {
+	case "skipped":
+		taskProcess.Status = models.TaskProcessStatusSkipped
+	case "description_updated":
+		taskProcess.Status = models.TaskProcessStatusDescriptionUpdated
+	case "overwritten":
+		taskProcess.Status = models.TaskProcessStatusOverwritten
+	case "uploaded":
+		taskProcess.Status = models.TaskProcessStatusUploaded
+	}
+
+	taskProcess.Update()
+	utils.SendWSTaskProcess(task.ID, taskProcess)
+
+	return nil
 }
 
-func handleExistingMetadataCommonsFile(replaceData ReplaceVarsData, regionExistingData map[string]string, startYear string, data StartData, downloadPath string, user *models.User, task *models.Task, region string, token *string) error {
+func handleExistingMetadataCommonsFile(ctx context.Context, replaceData ReplaceVarsData, regionExistingData map[string]string, startYear string, data StartData, downloadPath string, user *models.User, task *models.Task, region string) error {
 	replaceData.Year = startYear
 	filename := replaceVars(data.FileName, replaceData)
 	existingMapPath := filepath.Join(downloadPath, "_existing_final")
@@ -1149,22 +1273,13 @@ func handleExistingMetadataCommonsFile(replaceData ReplaceVarsData, regionExisti
 	// Convert fills to SVG metadata element
 	metadata := generateSVGMetadataFromFills(allFills)
 	if err := InjectMetadataIntoSVGSameFile(existingMapFilePath, metadata); err != nil {
-		return fmt.Errorf("Error injecting metadata into svg: ", err)
+		return fmt.Errorf("Error injecting metadata into svg: %w", err)
 	}
 
 	replaceData.Comment = "Importing from " + data.Url + " with metadata"
-	Filename, status, err := uploadMapFile(user, *token, replaceData, existingMapPath, data)
-	//  Retry twice
+	Filename, status, _, err := uploadMapFile(ctx, user, replaceData, existingMapPath, data)
 	if err != nil {
-		time.Sleep(time.Second * 2)
-		Filename, status, err = uploadMapFile(user, *token, replaceData, existingMapPath, data)
-		if err != nil {
-			time.Sleep(time.Second * 4)
-			Filename, status, err = uploadMapFile(user, *token, replaceData, existingMapPath, data)
-			if err != nil {
-				return err
-			}
-		}
+		return err
 	}
 	fmt.Println("Filename: ", Filename, status)
 	/**
@@ -1200,35 +1315,133 @@ func didReachStartYear(startMarker, endMarker *rod.Element, startYear string) bo
 	return false
 }
 
-func moveToNextYear(page *rod.Page, startMarker, endMarker *rod.Element, currentYear, startYear string) bool {
+// isLastFilteredYear reports whether no year left between the map's start year and currentYear passes the filter
+func isLastFilteredYear(yearFilter models.YearFilter, currentYear, startYear string) bool {
+	current, err := strconv.Atoi(currentYear)
+	if err != nil {
+		return false
+	}
+	start, err := strconv.Atoi(startYear)
+	if err != nil {
+		return false
+	}
+	previous, ok := yearFilter.PreviousYear(current)
+	return !ok || previous < start
+}
+
+// moveToNextYear moves the markers back to the previous year passing the filter,
+// returns false when there's none left. Without a filter that's the previous time of the
+// timeline, with one the page is opened at the filtered year
+func moveToNextYear(page *rod.Page, startMarker, endMarker *rod.Element, currentYear, startYear string, yearFilter models.YearFilter) bool {
 	if didReachStartYear(startMarker, endMarker, startYear) {
 		return false
 	}
 
-	if startMarker != nil {
-		time.Sleep(time.Millisecond * 100)
-		startMarker.Focus()
-		time.Sleep(time.Millisecond * 100)
-		page.Keyboard.Press(input.ArrowLeft)
-		time.Sleep(time.Millisecond * 100)
-		startMarker.Blur()
+	current, currentErr := strconv.Atoi(currentYear)
+	start, startErr := strconv.Atoi(startYear)
+	if yearFilter.IsEmpty() || currentErr != nil || startErr != nil {
+		if startMarker != nil {
+			time.Sleep(time.Millisecond * 100)
+			startMarker.Focus()
+			time.Sleep(time.Millisecond * 100)
+			page.Keyboard.Press(input.ArrowLeft)
+			time.Sleep(time.Millisecond * 100)
+			startMarker.Blur()
+		}
+
+		if endMarker != nil {
+			time.Sleep(time.Millisecond * 100)
+			endMarker.Focus()
+			time.Sleep(time.Millisecond * 100)
+			page.Keyboard.Press(input.ArrowLeft)
+			time.Sleep(time.Millisecond * 100)
+			endMarker.Blur()
+		}
+		return true
 	}
 
-	if endMarker != nil {
-		time.Sleep(time.Millisecond * 100)
-		endMarker.Focus()
-		time.Sleep(time.Millisecond * 100)
-		page.Keyboard.Press(input.ArrowLeft)
-		time.Sleep(time.Millisecond * 100)
-		endMarker.Blur()
+	targetYear, ok := yearFilter.PreviousYear(current)
+	if !ok || targetYear < start {
+		return false
+	}
+	for {
+		year, err := navigateToYear(page, targetYear)
+		if err != nil {
+			fmt.Println("Error opening the map at year: ", targetYear, err)
+			return false
+		}
+		if year < current {
+			return true
+		}
+		// The timeline lands on the year with data closest to the target, landing back on
+		// the current one means no year closer than that has data below the target either
+		if targetYear <= start {
+			return false
+		}
+		targetYear = max(start, targetYear-(current-targetYear))
 	}
+}
+
+// navigateToYear opens the page at the given year and returns the year the timeline lands on
+func navigateToYear(page *rod.Page, year int) (int, error) {
+	info, err := page.Info()
+	if err != nil {
+		return 0, err
+	}
+	if err := page.Navigate(setUrlTimeParam(info.URL, strconv.Itoa(year))); err != nil {
+		return 0, err
+	}
+	if err := page.WaitLoad(); err != nil {
+		return 0, err
+	}
+	if err := utils.WaitElementWithTimeout(page, fmt.Sprintf("%s, %s", START_MARKER_SELECTOR, END_MARKER_SELECTOR), time.Second*5); err != nil {
+		return 0, err
+	}
+
+	var startMarker, endMarker *rod.Element
+	if elements, err := page.Elements(START_MARKER_SELECTOR); err == nil && len(elements) > 0 {
+		startMarker = elements[0]
+	}
+	if elements, err := page.Elements(END_MARKER_SELECTOR); err == nil && len(elements) > 0 {
+		endMarker = elements[0]
+	}
+	return strconv.Atoi(getMarkerYear(startMarker, endMarker))
+}
+
+// setUrlTimeParam sets the time param of a chart url, replacing the one it has
+func setUrlTimeParam(chartUrl, timeParam string) string {
+	parsed, err := neturl.Parse(chartUrl)
+	if err != nil {
+		return utils.AttachQueryParamToUrl(chartUrl, "time="+neturl.QueryEscape(timeParam))
+	}
+	query := parsed.Query()
+	query.Set("time", timeParam)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
 
-	return true
+// getMarkerYear returns the year the timeline markers are at
+func getMarkerYear(startMarker, endMarker *rod.Element) string {
+	year := ""
+	if startMarker != nil {
+		if attr, err := startMarker.Attribute("aria-valuenow"); err == nil && attr != nil && *attr != "" {
+			year = *attr
+		}
+	}
+	if endMarker != nil {
+		if attr, err := endMarker.Attribute("aria-valuenow"); err == nil && attr != nil && *attr != "" {
+			year = *attr
+		}
+	}
+	return year
 }
 
-func getMapHasCountriesFromPage(page *rod.Page) (bool, []string) {
+// getMapHasCountriesFromPage checks the chart has a line/chart tab listing countries and returns
+// their codes, along with the listed names the entity registry doesn't know
+func getMapHasCountriesFromPage(page *rod.Page) (bool, []string, []string) {
 	activeTab, _ := GetActivePageTab(page)
 	countriesList := make([]string, 0)
+	unmatchedNames := make([]string, 0)
 	hasLines := false
 
 	lineTab, _ := GetTabByLabel(page, "line")
@@ -1244,7 +1457,7 @@ func getMapHasCountriesFromPage(page *rod.Page) (bool, []string) {
 	}
 
 	if hasLines {
-		countriesList = getCountryListFromPage(page)
+		countriesList, unmatchedNames = GetCountryListFromPage(page)
 	}
 
 	if activeTab != nil {
@@ -1252,76 +1465,7 @@ func getMapHasCountriesFromPage(page *rod.Page) (bool, []string) {
 		time.Sleep(time.Millisecond * 200)
 	}
 
-	return hasLines, countriesList
-}
-
-func getCountryListFromPage(page *rod.Page) []string {
-	// activeTab := GetActivePageTab(page)
-	// lineTab := GetTabByLabel(page, "line")
-	// chartTab := GetTabByLabel(page, "chart")
-
-	// if lineTab != nil {
-	// 	lineTab.Click(proto.InputMouseButtonLeft, 1)
-	// 	time.Sleep(time.Second)
-	// } else if chartTab != nil {
-	// 	chartTab.Click(proto.InputMouseButtonLeft, 1)
-	// 	time.Sleep(time.Second)
-	// }
-
-	countries := []string{}
-
-	elements := page.MustElements(".entity-selector__content li")
-	// Is regular graph
-	if len(elements) > 0 {
-		for _, element := range elements {
-			label := element.MustElement(".label")
-			value := element.MustElement(".value")
-			if value != nil && value.MustText() != "" && strings.ToLower(value.MustText()) == "no data" {
-				continue
-			}
-			country := strings.TrimSpace(label.MustText())
-			countryCode, ok := constants.COUNTRY_CODES[country]
-			if !ok {
-				continue
-			}
-			// check if country is not already in list
-			if !utils.Contains(countries, countryCode) {
-				countries = append(countries, countryCode)
-			}
-		}
-
-		return countries
-	}
-
-	// Is explorer graph
-	elements = page.MustElements(".EntityList label.EntityPickerOption")
-	if len(elements) > 0 {
-		for _, element := range elements {
-			label := element.MustElement(".name")
-			classes := element.MustAttribute("class")
-
-			if strings.Contains(*classes, "MissingData") {
-				continue
-			}
-
-			country := strings.TrimSpace(label.MustText())
-			countryCode, ok := constants.COUNTRY_CODES[country]
-			if !ok {
-				continue
-			}
-			// check if country is not already in list
-			if !utils.Contains(countries, countryCode) {
-				countries = append(countries, countryCode)
-			}
-		}
-	}
-
-	// if activeTab != nil {
-	// 	activeTab.Click(proto.InputMouseButtonLeft, 1)
-	// 	time.Sleep(time.Second)
-	// }
-
-	return countries
+	return hasLines, countriesList, unmatchedNames
 }
 
 func getMapStartEndYearTitleFromPage(page *rod.Page) (string, string, string) {
@@ -1351,36 +1495,7 @@ func getMapTitleFromPage(page *rod.Page) string {
 	return title
 }
 
-func processRegion(user *models.User, task *models.Task, chartName string, region, downloadPath string, chartParamsMap map[string]string, title string, data StartData) error {
-	token := ""
-	done := false
-
-	defer func() {
-		done = true
-	}()
-
-	go func() {
-		for !done {
-			tokenResponse, err := utils.DoApiReq[TokenResponse](user, map[string]string{
-				"action": "query",
-				"meta":   "tokens",
-				"format": "json",
-			}, nil)
-			if err != nil {
-				fmt.Println("Error fetching edit token", err)
-			} else if tokenResponse.Query.Tokens.CsrfToken != "" {
-				token = tokenResponse.Query.Tokens.CsrfToken
-			}
-
-			time.Sleep(time.Second * 20)
-		}
-	}()
-
-	for token == "" {
-		time.Sleep(time.Second)
-		// fmt.Println("Waiting for token")
-	}
-
+func processRegion(ctx context.Context, user *models.User, task *models.Task, chartName string, region, downloadPath string, chartParamsMap map[string]string, title string, data StartData) error {
 	// Get start and end years
 	// get chart title
 	// Process each year
@@ -1398,16 +1513,60 @@ func processRegion(user *models.User, task *models.Task, chartName string, regio
 		url = utils.AttachQueryParamToUrl(url, task.ChartParameters)
 	}
 
-	// TODO
-	url = utils.AttachQueryParamToUrl(url, "time=latest")
-	// url = utils.AttachQueryParamToUrl(url, "time=2023")
-
-	traverseDownloadRegion(task, data, user, chartParamsMap, &token, chartName, title, region, url, downloadPath)
-	task.Reload()
+	url = utils.AttachQueryParamToUrl(url, "time="+neturl.QueryEscape(regionStartTimeParam(task, region)))
 
+	traverseDownloadRegion(ctx, task, data, user, chartParamsMap, chartName, title, region, url, downloadPath)
 	return nil
 }
 
+// regionStartTimeParam is the time param a region starts at, the last checkpoint of the region if any.
+// A checkpoint outside the year filter moves to the closest filtered year before it
+func regionStartTimeParam(task *models.Task, region string) string {
+	timeParam := "latest"
+	if latestYear, ok := task.YearFilter.LatestYear(); ok {
+		timeParam = strconv.Itoa(latestYear)
+	}
+
+	checkpoint, err := models.FindTaskCheckpoint(task.ID, region)
+	if err != nil || checkpoint.TimeParam == "" {
+		return timeParam
+	}
+	if year, err := strconv.Atoi(checkpoint.TimeParam); err == nil && !task.YearFilter.Includes(year) {
+		previousYear, ok := task.YearFilter.PreviousYear(year + 1)
+		if !ok {
+			// No filtered year is left before the checkpoint, start over
+			return timeParam
+		}
+		fmt.Println("Resuming region from checkpoint within the year filter: ", region, previousYear)
+		return strconv.Itoa(previousYear)
+	}
+
+	fmt.Println("Resuming region from checkpoint: ", region, checkpoint.Date)
+	return checkpoint.TimeParam
+}
+
+// saveRegionCheckpoint stores the year the page is at as the region's checkpoint
+func saveRegionCheckpoint(page *rod.Page, task *models.Task, region, year string) {
+	info, err := page.Info()
+	if err != nil {
+		fmt.Println("Error getting page info for checkpoint", region, year, err)
+		return
+	}
+	pageUrl, err := neturl.Parse(info.URL)
+	if err != nil {
+		fmt.Println("Error parsing page url for checkpoint", region, year, err)
+		return
+	}
+
+	timeParam := pageUrl.Query().Get("time")
+	if timeParam == "" || timeParam == "latest" {
+		return
+	}
+	if err := models.SaveTaskCheckpoint(task.ID, region, year, timeParam); err != nil {
+		fmt.Println("Error saving checkpoint", region, year, err)
+	}
+}
+
 type CountryFillWithYear struct {
 	Country string
 	Fill    string
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+	"github.com/wpmed-videowiki/OWIDImporter/testutil"
+)
+
+func newCheckpointTestTask(t *testing.T, yearFilter models.YearFilter) *models.Task {
+	return testutil.NewTask(t, models.NewTaskOptions{Status: models.TaskStatusProcessing, ImportMode: models.TaskImportModeData, YearFilter: yearFilter})
+}
+
+func TestRegionResumesFromCheckpoint(t *testing.T) {
+	task := newCheckpointTestTask(t, models.YearFilter{})
+	if got := regionStartTimeParam(task, "World"); got != "latest" {
+		t.Fatalf("expected a region without checkpoint to start at latest, got %s", got)
+	}
+
+	if err := models.SaveTaskCheckpoint(task.ID, "World", "2005", "2005"); err != nil {
+		t.Fatal(err)
+	}
+	if got := regionStartTimeParam(task, "World"); got != "2005" {
+		t.Errorf("expected World to resume from 2005, got %s", got)
+	}
+	if got := regionStartTimeParam(task, "Africa"); got != "latest" {
+		t.Errorf("expected Africa to start at latest, got %s", got)
+	}
+}
+
+func TestRegionStartsFromLatestAfterDone(t *testing.T) {
+	task := newCheckpointTestTask(t, models.YearFilter{})
+	if err := models.SaveTaskCheckpoint(task.ID, "World", "2005", "2005"); err != nil {
+		t.Fatal(err)
+	}
+
+	task.Status = models.TaskStatusDone
+	completeTask(task, StartData{})
+
+	// A retry or scheduled rerun of the done task must not skip the years after the checkpoint
+	if _, err := models.FindTaskCheckpoint(task.ID, "World"); err == nil {
+		t.Error("expected the checkpoint to be deleted once the task is done")
+	}
+	if got := regionStartTimeParam(task, "World"); got != "latest" {
+		t.Errorf("expected World to start at latest after done, got %s", got)
+	}
+}
+
+func TestClonedTaskStartsWithoutCheckpoints(t *testing.T) {
+	task := newCheckpointTestTask(t, models.YearFilter{})
+	if err := models.SaveTaskCheckpoint(task.ID, "World", "2005", "2005"); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := models.CloneTask(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := regionStartTimeParam(clone, "World"); got != "latest" {
+		t.Errorf("expected the clone to start at latest, got %s", got)
+	}
+	if _, err := models.FindTaskCheckpoint(task.ID, "World"); err == nil {
+		t.Error("expected the checkpoints of the cloned task to be cleared")
+	}
+}
+
+func TestRegionCheckpointStaysWithinYearFilter(t *testing.T) {
+	from, to := 2000, 2010
+	yearFilter := models.YearFilter{From: &from, To: &to, Step: 2}
+
+	tests := []struct {
+		name      string
+		timeParam string
+		want      string
+	}{
+		{name: "no checkpoint starts at the latest filtered year", want: "2010"},
+		{name: "checkpoint within the filter", timeParam: "2006", want: "2006"},
+		{name: "checkpoint between steps", timeParam: "2005", want: "2004"},
+		{name: "checkpoint after the filter", timeParam: "2015", want: "2010"},
+		{name: "checkpoint before the filter starts over", timeParam: "1990", want: "2010"},
+		{name: "checkpoint that isn't a year", timeParam: "2005-06-01", want: "2005-06-01"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := newCheckpointTestTask(t, yearFilter)
+			if test.timeParam != "" {
+				if err := models.SaveTaskCheckpoint(task.ID, "World", test.timeParam, test.timeParam); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := regionStartTimeParam(task, "World"); got != test.want {
+				t.Errorf("regionStartTimeParam() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRegionCheckpointStaysWithinYearsList(t *testing.T) {
+	task := newCheckpointTestTask(t, models.YearFilter{Years: []int{1990, 2000, 2020}})
+	if err := models.SaveTaskCheckpoint(task.ID, "World", "2010", "2010"); err != nil {
+		t.Fatal(err)
+	}
+	if got := regionStartTimeParam(task, "World"); got != "2000" {
+		t.Errorf("regionStartTimeParam() = %s, want 2000", got)
+	}
+}
+
+func TestStalledTaskResumesFromCheckpoint(t *testing.T) {
+	task := newCheckpointTestTask(t, models.YearFilter{})
+	if err := models.SaveTaskCheckpoint(task.ID, "World", "2005", "2005"); err != nil {
+		t.Fatal(err)
+	}
+
+	RequeueStalledTask(task)
+
+	requeued, err := models.FindTaskById(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued.Status != models.TaskStatusQueued {
+		t.Errorf("expected the stalled task to be queued, got %s", requeued.Status)
+	}
+	if got := regionStartTimeParam(requeued, "World"); got != "2005" {
+		t.Errorf("expected the requeued task to resume from 2005, got %s", got)
+	}
+}
+
+func TestStalledRunningTaskRequeuesItself(t *testing.T) {
+	task := newCheckpointTestTask(t, models.YearFilter{})
+	ctx, runtime := StartTaskRuntime(context.Background(), task.ID)
+	defer runtime.Stop()
+
+	RequeueStalledTask(task)
+
+	if ctx.Err() == nil {
+		t.Fatal("expected the running task to be stopped")
+	}
+	if IsTaskCancelled(ctx) || IsTaskPaused(ctx) {
+		t.Fatal("expected a stalled task not to count as cancelled or paused")
+	}
+	stopInterruptedTask(ctx, task, runtime)
+
+	requeued, err := models.FindTaskById(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued.Status != models.TaskStatusQueued {
+		t.Errorf("expected the stalled task to be queued, got %s", requeued.Status)
+	}
+}
+
+func TestSetUrlTimeParam(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://ourworldindata.org/grapher/chart", "https://ourworldindata.org/grapher/chart?time=2000"},
+		{"https://ourworldindata.org/grapher/chart?tab=map&time=2010", "https://ourworldindata.org/grapher/chart?tab=map&time=2000"},
+		{"https://ourworldindata.org/grapher/chart?time=latest&region=Europe", "https://ourworldindata.org/grapher/chart?region=Europe&time=2000"},
+	}
+	for _, test := range tests {
+		if got := setUrlTimeParam(test.url, "2000"); got != test.want {
+			t.Errorf("setUrlTimeParam(%s) = %s, want %s", test.url, got, test.want)
+		}
+	}
+}
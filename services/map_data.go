@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/input"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/wpmed-videowiki/OWIDImporter/constants"
+	"github.com/wpmed-videowiki/OWIDImporter/env"
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+	"github.com/wpmed-videowiki/OWIDImporter/owidparser"
+	svgprocessor "github.com/wpmed-videowiki/OWIDImporter/svg_processor"
+	"github.com/wpmed-videowiki/OWIDImporter/utils"
+	"golang.org/x/sync/errgroup"
+)
+
+// GrapherData is a chart's grapher config with the data and metadata of its map indicator saved to disk
+type GrapherData struct {
+	Config       *owidparser.OWIDGrapherConfig
+	DataPath     string
+	MetadataPath string
+}
+
+// FetchGrapherData downloads the grapher config of the chart and the data and metadata of
+// the indicator shown on its map into dir
+func FetchGrapherData(ctx context.Context, chartUrl, dir string) (*GrapherData, error) {
+	baseUrl := strings.Split(chartUrl, "?")[0]
+	configBody, err := fetchOWIDResourceWithContext(ctx, baseUrl+".config.json")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching chart config: %w", err)
+	}
+
+	var config owidparser.OWIDGrapherConfig
+	if err := json.Unmarshal(configBody, &config); err != nil {
+		return nil, fmt.Errorf("error parsing chart config: %w", err)
+	}
+
+	variableId := config.MapVariableId()
+	if variableId == 0 {
+		return nil, fmt.Errorf("chart config has no map indicator")
+	}
+
+	dataBody, err := fetchOWIDResourceWithContext(ctx, fmt.Sprintf("%s%d.data.json", constants.OWID_INDICATORS_API_URL, variableId))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching indicator data: %w", err)
+	}
+	metadataBody, err := fetchOWIDResourceWithContext(ctx, fmt.Sprintf("%s%d.metadata.json", constants.OWID_INDICATORS_API_URL, variableId))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching indicator metadata: %w", err)
+	}
+
+	var metadata owidparser.Metadata
+	if err := json.Unmarshal(metadataBody, &metadata); err != nil {
+		return nil, fmt.Errorf("error parsing indicator metadata: %w", err)
+	}
+	// Day based charts name their files by date, the browser flow handles those
+	if metadata.Display.YearIsDay {
+		return nil, fmt.Errorf("day based indicators are not supported")
+	}
+
+	grapherData := GrapherData{
+		Config:       &config,
+		DataPath:     filepath.Join(dir, "data.json"),
+		MetadataPath: filepath.Join(dir, "metadata.json"),
+	}
+	if err := os.WriteFile(grapherData.DataPath, dataBody, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(grapherData.MetadataPath, metadataBody, 0644); err != nil {
+		return nil, err
+	}
+
+	return &grapherData, nil
+}
+
+// getTaskGrapherData returns the grapher data of a data mode task, nil when the task
+// should go through the browser, by choice or because its maps can't be generated from data
+func getTaskGrapherData(ctx context.Context, task *models.Task, data StartData, tmpDir, endYear string) *GrapherData {
+	if task.ImportMode != models.TaskImportModeData {
+		return nil
+	}
+	// The grapher data doesn't follow the selected parameters
+	if task.ChartParameters != "" {
+		fmt.Println("Chart parameters aren't supported in data mode, importing through the browser")
+		return nil
+	}
+	if _, err := strconv.Atoi(endYear); err != nil {
+		fmt.Println("End year isn't a year, importing through the browser", endYear)
+		return nil
+	}
+
+	dir := filepath.Join(tmpDir, "grapher")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		fmt.Println("Error creating grapher data directory", err)
+		return nil
+	}
+	grapherData, err := FetchGrapherData(ctx, data.Url, dir)
+	if err != nil {
+		fmt.Println("Error fetching grapher data, importing through the browser", err)
+		return nil
+	}
+
+	return grapherData
+}
+
+// processRegionsFromData generates the yearly maps of every region from the grapher data, the
+// browser only captures the latest map of each region to be recolored
+func processRegionsFromData(ctx context.Context, task *models.Task, user *models.User, grapherData *GrapherData, tmpDir, title, endYear string, chartParamsMap map[string]string, data StartData) {
+	titleYear, _ := strconv.Atoi(endYear)
+	if task.TimeTolerance >= 0 {
+		// The regions only read the config, a copy with the task's tolerance is enough
+		config := *grapherData.Config
+		timeTolerance := task.TimeTolerance
+		config.Map.TimeTolerance = &timeTolerance
+		grapherData = &GrapherData{
+			Config:       &config,
+			DataPath:     grapherData.DataPath,
+			MetadataPath: grapherData.MetadataPath,
+		}
+	}
+
+	if unmatchedNames, err := owidparser.FindUnmatchedEntities(grapherData.MetadataPath); err == nil {
+		recordUnmatchedEntities(task, models.TaskUnmatchedEntitySourceData, unmatchedNames)
+	} else {
+		fmt.Println("Error reading indicator entities", err)
+	}
+
+	regionGroup, ctx := errgroup.WithContext(ctx)
+	regionGroup.SetLimit(constants.CONCURRENT_REQUESTS)
+
+	for _, region := range getTaskRegions(task) {
+		if task.Status != models.TaskStatusProcessing || ctx.Err() != nil {
+			break
+		}
+		region := region
+		regionGroup.Go(func() error {
+			if task.Status != models.TaskStatusProcessing || ctx.Err() != nil {
+				return nil
+			}
+			err := processRegionFromData(ctx, task, user, grapherData, region, filepath.Join(tmpDir, region), title, titleYear, chartParamsMap, data)
+			fmt.Println("============= FINISHED PROCESSING REGION FROM DATA: ", region)
+			if err != nil {
+				fmt.Println("Error in processing region from data", region, err)
+			}
+			return nil
+		})
+	}
+
+	regionGroup.Wait()
+	fmt.Println("================= FINISHED PROCESSING ALL REGIONS FROM DATA ==================")
+}
+
+func processRegionFromData(ctx context.Context, task *models.Task, user *models.User, grapherData *GrapherData, region, downloadPath, title string, titleYear int, chartParamsMap map[string]string, data StartData) error {
+	regionStr := getRegionDisplayName(region)
+	if err := os.MkdirAll(downloadPath, 0755); err != nil {
+		return err
+	}
+
+	url := utils.AttachQueryParamToUrl(data.Url, fmt.Sprintf("tab=map&region=%s", region))
+	url = utils.AttachQueryParamToUrl(url, "time=latest")
+
+	basePath := filepath.Join(downloadPath, "base")
+	if err := downloadRegionBaseMap(ctx, url, basePath); err != nil {
+		return fmt.Errorf("error capturing base map: %w", err)
+	}
+	baseInfo, err := getFileInfo(basePath)
+	if err != nil {
+		return err
+	}
+
+	yearsPath := filepath.Join(downloadPath, "years")
+	if err := os.Mkdir(yearsPath, 0755); err != nil {
+		return err
+	}
+	results, err := owidparser.GenerateImages(grapherData.Config, title, titleYear, grapherData.DataPath, grapherData.MetadataPath, baseInfo.FilePath, yearsPath)
+	if err != nil {
+		return fmt.Errorf("error generating maps: %w", err)
+	}
+	if len(*results) == 0 {
+		return fmt.Errorf("no maps generated")
+	}
+
+	// The existing Commons files cover every year, the filter only limits what gets uploaded
+	mapStartYear := strconv.Itoa((*results)[0].Year)
+	filteredResults := make([]owidparser.WriteResult, 0, len(*results))
+	for _, result := range *results {
+		if task.YearFilter.Includes(result.Year) {
+			filteredResults = append(filteredResults, result)
+		}
+	}
+	if len(filteredResults) == 0 {
+		return fmt.Errorf("no maps generated within the year filter")
+	}
+
+	startYear := strconv.Itoa(filteredResults[0].Year)
+	latestYear := strconv.Itoa(filteredResults[len(filteredResults)-1].Year)
+
+	if task.DescriptionOverwriteBehaviour == models.DescriptionOverwriteBehaviourSkip {
+		regionExistingData := make(map[string]string, 0)
+		sources, err := GetTemplateExistingSources(user, task.CommonsTemplateName)
+		if err == nil && sources != nil {
+			if existing, exists := sources.Regions[region]; exists {
+				regionExistingData = existing
+			}
+		}
+		if _, exists := regionExistingData[latestYear]; exists {
+			replaceData := ReplaceVarsData{
+				Url:      data.Url,
+				Title:    title,
+				Region:   regionStr,
+				Year:     latestYear,
+				FileName: GetFileNameFromChartName(task.ChartName),
+				Comment:  "Importing from " + data.Url,
+				Params:   chartParamsMap,
+			}
+			err := handleExistingMetadataCommonsFile(ctx, replaceData, regionExistingData, mapStartYear, data, downloadPath, user, task, region)
+			if err == nil {
+				return nil
+			}
+			fmt.Println("=============== Error reusing commons template: ", err)
+		}
+	}
+
+	// Latest year first like the browser flow, the first year carries the metadata of all the others
+	for i := len(filteredResults) - 1; i >= 0; i-- {
+		if task.Status != models.TaskStatusProcessing || ctx.Err() != nil {
+			break
+		}
+
+		result := filteredResults[i]
+		year := strconv.Itoa(result.Year)
+		setTaskPosition(task.ID, region, fmt.Sprintf("%s/%s", regionStr, year))
+		models.UpdateTaskLastOperationAt(task.ID)
+
+		var taskProcess *models.TaskProcess
+		existingTB, _ := models.FindTaskProcessByTaskRegionDate(region, year, task.ID)
+		if existingTB != nil {
+			if existingTB.Status != models.TaskProcessStatusFailed {
+				continue
+			}
+			existingTB.Status = models.TaskProcessStatusProcessing
+			if err := existingTB.Update(); err != nil {
+				fmt.Println("Error updating task process to processing")
+			}
+			taskProcess = existingTB
+		} else {
+			taskProcess, err = models.NewTaskProcess(region, year, "", models.TaskProcessStatusProcessing, models.TaskProcessTypeMap, task.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		mapPath := filepath.Dir(result.Path)
+		fileInfo, err := getFileInfo(mapPath)
+		if err != nil {
+			FailTaskProcess(taskProcess)
+			continue
+		}
+
+		countryFills, err := svgprocessor.ExtractCountryFills(fileInfo.FilePath)
+		if err != nil {
+			fmt.Println("Error extracting country fills ", err)
+		} else {
+			jsonStr, err := svgprocessor.ConvertToJSON(countryFills)
+			if jsonStr != "" && err == nil {
+				taskProcess.FillData = jsonStr
+				taskProcess.Update()
+			}
+		}
+
+		replaceData := ReplaceVarsData{
+			Url:      data.Url,
+			Title:    title,
+			Region:   regionStr,
+			Year:     year,
+			FileName: GetFileNameFromChartName(task.ChartName),
+			Comment:  "Importing from " + data.Url,
+			Params:   chartParamsMap,
+		}
+
+		if year == startYear {
+			mapPath = prepareRegionLastFile(task, user, data, &replaceData, region, downloadPath, year, mapPath, fileInfo)
+		}
+
+		uploadRegionYear(ctx, user, replaceData, mapPath, data, task, taskProcess)
+	}
+
+	if ctx.Err() == nil {
+		clearTaskPosition(task.ID, region)
+	}
+
+	return nil
+}
+
+// downloadRegionBaseMap downloads the map svg of url into downloadPath
+func downloadRegionBaseMap(ctx context.Context, url, downloadPath string) error {
+	if err := os.Mkdir(downloadPath, 0755); err != nil {
+		return err
+	}
+
+	lease, err := LeaseBrowser(ctx)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	return rod.Try(func() {
+		page := lease.Browser.Context(ctx).MustPage("")
+		page.MustSetUserAgent(&proto.NetworkSetUserAgentOverride{UserAgent: env.GetEnv().OWID_UA})
+		page.MustSetViewport(constants.VIEWPORT_WIDTH, constants.VIEWPORT_HEIGHT, 1, false)
+
+		fmt.Println("==================== Capturing base map: ", url)
+		page.MustNavigate(url)
+		page.MustWaitLoad()
+		page.MustWaitIdle()
+
+		if err := utils.WaitElementWithTimeout(page, DOWNLOAD_BUTTON_SELECTOR, time.Second*10); err != nil {
+			panic(fmt.Errorf("cannot find download button in page"))
+		}
+
+		wait := waitPageDownload(page, downloadPath)
+		downloadBtn := page.MustElement(DOWNLOAD_BUTTON_SELECTOR)
+		downloadBtn.MustFocus()
+		time.Sleep(time.Millisecond * 200)
+		page.Keyboard.MustType(input.Enter)
+
+		if err := utils.WaitElementWithTimeout(page, DOWNLOAD_SVG_ICON_SELECTOR, time.Second*10); err != nil {
+			CloseDownloadPopup(page)
+			panic(fmt.Errorf("cannot find DOWNLOAD_SVG_ICON_SELECTOR"))
+		}
+		page.MustElements(DOWNLOAD_SVG_ICON_SELECTOR)[0].MustClick()
+
+		wait()
+		CloseDownloadPopup(page)
+	})
+}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,6 +17,8 @@ import (
 
 	"github.com/go-rod/rod"
 	"github.com/wpmed-videowiki/OWIDImporter/constants"
+	"github.com/wpmed-videowiki/OWIDImporter/entities"
+	"github.com/wpmed-videowiki/OWIDImporter/mediawiki"
 	"github.com/wpmed-videowiki/OWIDImporter/models"
 	"github.com/wpmed-videowiki/OWIDImporter/owidparser"
 	"github.com/wpmed-videowiki/OWIDImporter/utils"
@@ -31,6 +35,8 @@ type StartData struct {
 	CountryFileName                      string                               `json:"countryFileName"`
 	CountryDescription                   string                               `json:"countryDescription"`
 	CountryDescriptionOverwriteBehaviour models.DescriptionOverwriteBehaviour `json:"countryDescriptionOverwriteBehaviour"`
+	Destination                          Destination                          `json:"-"`      // Where the files go, Commons when nil
+	DryRun                               bool                                 `json:"dryRun"` // Nothing is written, the outcome each file would have is returned instead
 }
 
 type CountryTemplateDataItem struct {
@@ -44,159 +50,12 @@ type RegionChartTemplateDataItem struct {
 	Region   string
 }
 
-type APIError struct {
-	Code   string `json:"code"`
-	Info   string `json:"info"`
-	DocRef string `json:"docref,omitempty"`
-}
-
-type TokenResponse struct {
-	BatchComplete string `json:"batchcomplete"`
-	Query         struct {
-		Tokens struct {
-			CsrfToken string `json:"csrftoken"`
-		} `json:"tokens"`
-	} `json:"query"`
-}
-
 type FileNameAcc struct {
 	FileName string
 	Region   string
 	Year     string
 }
 
-type QueryResponse struct {
-	BatchComplete bool `json:"batchcomplete"`
-	Query         struct {
-		Normalized []struct {
-			FromEncoded bool   `json:"fromencoded"`
-			From        string `json:"from"`
-			To          string `json:"to"`
-		} `json:"normalized"`
-		Pages []Page `json:"pages"`
-	} `json:"query"`
-}
-
-type QueryBySHA1Response struct {
-	BatchComplete bool `json:"batchcomplete"`
-	Query         struct {
-		AllImages []struct {
-			Name  string `json:"name"`
-			Title string `json:"title"`
-			Url   string `json:"url"`
-		} `json:"allimages"`
-	} `json:"query"`
-}
-
-type Page struct {
-	PageID          int    `json:"pageid"`
-	NS              int    `json:"ns"`
-	Title           string `json:"title"`
-	ImageRepository string `json:"imagerepository"`
-	ImageInfo       []struct {
-		SHA1 string `json:"sha1"`
-		URL  string `json:"url"`
-	} `json:"imageinfo"`
-}
-
-type UploadResponse struct {
-	Warnings struct {
-		Main struct {
-			Warnings string `json:"warnings"`
-		} `json:"main"`
-	} `json:"warnings"`
-	Upload struct {
-		Result   string `json:"result"`
-		Filename string `json:"filename"`
-		Warnings struct {
-			Duplicate []string `json:"duplicate"`
-		} `json:"warnings"`
-		ImageInfo struct {
-			Timestamp      string `json:"timestamp"`
-			User           string `json:"user"`
-			UserID         int    `json:"userid"`
-			Size           int    `json:"size"`
-			Width          int    `json:"width"`
-			Height         int    `json:"height"`
-			ParsedComment  string `json:"parsedcomment"`
-			Comment        string `json:"comment"`
-			HTML           string `json:"html"`
-			CanonicalTitle string `json:"canonicaltitle"`
-			URL            string `json:"url"`
-			DescriptionURL string `json:"descriptionurl"`
-			SHA1           string `json:"sha1"`
-			Metadata       []struct {
-				Name  string      `json:"name"`
-				Value interface{} `json:"value"`
-			} `json:"metadata"`
-			CommonMetadata []interface{} `json:"commonmetadata"`
-			ExtMetadata    struct {
-				DateTime struct {
-					Value  string `json:"value"`
-					Source string `json:"source"`
-					Hidden string `json:"hidden"`
-				} `json:"DateTime"`
-				ObjectName struct {
-					Value  string `json:"value"`
-					Source string `json:"source"`
-				} `json:"ObjectName"`
-			} `json:"extmetadata"`
-			Mime      string `json:"mime"`
-			MediaType string `json:"mediatype"`
-			BitDepth  int    `json:"bitdepth"`
-		} `json:"imageinfo"`
-	} `json:"upload"`
-}
-
-type movePageResponse struct {
-	Move *struct {
-		From   string `json:"from"`
-		To     string `json:"to"`
-		Reason string `json:"reason"`
-	} `json:"move,omitempty"`
-
-	Error *APIError
-}
-
-type SearchPagePrefixResponse struct {
-	Query struct {
-		Normalized []struct {
-			FromEncoded bool   `json:"fromencoded"`
-			From        string `json:"from"`
-			To          string `json:"to"`
-		} `json:"normalized"`
-		Pages []Page `json:"pages"`
-	} `json:"query"`
-}
-type FileRevisionsResponse struct {
-	BatchComplete bool `json:"batchcomplete"`
-	Query         struct {
-		Normalized []struct {
-			FromEncoded bool   `json:"fromencoded"`
-			From        string `json:"from"`
-			To          string `json:"to"`
-		} `json:"normalized"`
-		Pages []FileRevisionsPage `json:"pages"`
-	} `json:"query"`
-}
-
-type FileRevisionsPage struct {
-	PageID    int        `json:"pageid"`
-	Namespace int        `json:"ns"`
-	Title     string     `json:"title"`
-	Revisions []Revision `json:"revisions,omitempty"`
-}
-
-type Revision struct {
-	Slots map[string]ContentSlot `json:"slots"`
-}
-
-type ContentSlot struct {
-	ContentModel  string `json:"contentmodel"`
-	ContentFormat string `json:"contentformat"`
-	Content       string `json:"content"`
-}
-
 const (
 	HEADLESS = true
 )
@@ -242,80 +101,53 @@ func ValidateParameters(data StartData) error {
 	return nil
 }
 
-func MovePage(user *models.User, token string, fromTitle, toTitle string) error {
+func MovePage(user *models.User, fromTitle, toTitle string) error {
 	fmt.Println("===================================")
 	fmt.Println("MOVE ACTION: FROM - ", fromTitle, " - TO - ", toTitle)
-	res, err := utils.DoApiReq[movePageResponse](user, map[string]string{
-		"action": "move",
-		"from":   fromTitle,
-		"to":     toTitle,
-		"token":  token,
-		"reason": "New file naming convension",
-	}, nil)
-
-	if err != nil {
-		return err
-	}
-
-	if res.Error != nil {
-		return fmt.Errorf("%s: %s", res.Error.Code, res.Error.Info)
-	}
-
-	return nil
+	_, err := mediawiki.NewClient(user).Move(context.Background(), mediawiki.MoveRequest{
+		From:   fromTitle,
+		To:     toTitle,
+		Reason: "New file naming convension",
+	})
+	return err
 }
 
 func SearchPageWithPrefix(user *models.User, title string) ([]string, error) {
-	titles := make([]string, 0)
-
-	res, err := utils.DoApiReq[SearchPagePrefixResponse](user, map[string]string{
-		"action":    "query",
-		"redirects": "1",
-		"generator": "search",
-		"gsrsearch": title,
-	}, nil)
-
+	titles, err := mediawiki.NewClient(user).SearchTitles(context.Background(), title)
 	if err != nil {
-		return titles, err
+		return make([]string, 0), err
 	}
 
-	for _, v := range res.Query.Pages {
-		titles = append(titles, v.Title)
-	}
-
-	fmt.Println(res.Query)
+	fmt.Println(titles)
 	return titles, nil
 }
 
 func getPageWikiText(user *models.User, title string) (string, error) {
-	res, err := utils.DoApiReq[FileRevisionsResponse](user, map[string]string{
-		"action":  "query",
-		"titles":  title,
-		"prop":    "revisions",
-		"rvprop":  "content",
-		"rvlimit": "1",
-		"rvslots": "main",
-	}, nil)
-	if err != nil {
-		return "", err
-	}
-
-	// fmt.Println("Response: ", res)
-	for _, page := range res.Query.Pages {
-		if len(page.Revisions) > 0 {
-			// Assuming the main slot contains the wikitext
-			if mainSlot, ok := page.Revisions[0].Slots["main"]; ok {
-				return mainSlot.Content, nil
-			}
-		}
-	}
-
-	return "", nil
+	return mediawiki.NewClient(user).PageContent(context.Background(), title)
 }
 
 func getFileWikiText(user *models.User, filename string) (string, error) {
 	return getPageWikiText(user, "File:"+filename)
 }
 
+// keepExistingCategories replaces the categories of filedesc with the ones of the existing description
+func keepExistingCategories(filedesc, existing string) string {
+	newFileDesc := strings.TrimSpace(filedesc)
+	// Remove all user incoming categories
+	incomingCategories := extractCategories(filedesc)
+	for _, text := range incomingCategories {
+		newFileDesc = strings.ReplaceAll(newFileDesc, text, "")
+	}
+
+	newFileDesc = strings.TrimSpace(newFileDesc)
+	// Apply existing file categories
+	existingCategories := extractCategories(existing)
+	for _, text := range existingCategories {
+		newFileDesc = newFileDesc + "\n" + text
+	}
+	return newFileDesc
+}
+
 func extractCategories(wikitext string) []string {
 	// Create a regular expression to match full MediaWiki category tags
 	// Pattern: [[Category:Any text that doesn't include closing brackets]]
@@ -327,16 +159,13 @@ func extractCategories(wikitext string) []string {
 	return matches
 }
 
-func createCommonsTemplatePage(user *models.User, token, title, wikiText string) (string, error) {
-	params := map[string]string{
-		"action":         "edit",
-		"text":           wikiText,
-		"title":          title,
-		"ignorewarnings": "1",
-		"token":          token,
-	}
+// PutPage creates or replaces the Commons page title
+func (d *commonsDestination) PutPage(ctx context.Context, title, wikiText string) (string, error) {
 	fmt.Println("---------------- CREATING COMMONS TEMPLATE: ", title)
-	_, err := utils.DoApiReq[interface{}](user, params, nil)
+	_, err := mediawiki.NewClient(d.user).Edit(ctx, mediawiki.EditRequest{
+		Title: title,
+		Text:  wikiText,
+	})
 	if err != nil {
 		return "", err
 	}
@@ -344,87 +173,86 @@ func createCommonsTemplatePage(user *models.User, token, title, wikiText string)
 	return title, nil
 }
 
-func getCommonsFilePageByName(filename string, user *models.User) (*Page, error) {
-	res, err := utils.DoApiReq[QueryResponse](user, map[string]string{
-		"action": "query",
-		"prop":   "imageinfo",
-		"titles": "File:" + filename,
-		"iiprop": "sha1|url",
-	}, nil)
-	if err != nil {
-		return nil, err
-	}
-	pages := res.Query.Pages
-	var page Page
-	for _, p := range pages {
-		page = p
-		break
-	}
-
-	return &page, nil
+func getCommonsFilePageByName(filename string, user *models.User) (*mediawiki.Page, error) {
+	return mediawiki.NewClient(user).ImageInfo(context.Background(), "File:"+filename)
 }
 
-func uploadMapFile(user *models.User, token string, replaceData ReplaceVarsData, downloadPath string, data StartData) (string, string, error) {
+// uploadMapFile cleans up the file at downloadPath and stores it in the task's destination, returning
+// the file name, the outcome and the description wikitext
+func uploadMapFile(ctx context.Context, user *models.User, replaceData ReplaceVarsData, downloadPath string, data StartData) (string, string, string, error) {
 	filedesc := replaceVars(data.Description, replaceData)
 	filename := replaceVars(data.FileName, replaceData)
 
 	fileInfo, err := getFileInfo(downloadPath)
 	if err != nil {
-		return filename, "", err
+		return filename, "", "", err
 	}
 
 	// Cleanup file and load it again
 	owidparser.CleanupSVGForUpload(fileInfo.FilePath)
 	fileInfo, err = getFileInfo(downloadPath)
 	if err != nil {
-		return filename, "", err
+		return filename, "", "", err
 	}
 
-	page, err := getCommonsFilePageByName(filename, user)
+	destination := data.Destination
+	if destination == nil {
+		destination = newCommonsDestination(user)
+	}
+	return destination.Put(ctx, DestinationFile{
+		FileName:    filename,
+		Description: filedesc,
+		Comment:     replaceData.Comment,
+		FileInfo:    fileInfo,
+	}, data)
+}
+
+// Put uploads the file, or only updates its description when the content didn't change.
+// A dry run stops before anything is written to Commons
+func (d *commonsDestination) Put(ctx context.Context, file DestinationFile, data StartData) (string, string, string, error) {
+	user := d.user
+	filename := file.FileName
+	filedesc := file.Description
+	fileInfo := file.FileInfo
+
+	client := mediawiki.NewClient(user)
+	page, err := client.ImageInfo(ctx, "File:"+filename)
 	if err != nil {
-		return filename, "", err
+		return filename, "", "", err
 	}
 
 	// Doesn't exist, upload and update description directly
 	if len(page.ImageInfo) == 0 {
 		// Checking if file already uploaded under a different name using sha1 query
-		shaRes, err := utils.DoApiReq[QueryBySHA1Response](user, map[string]string{
-			"action": "query",
-			"list":   "allimages",
-			"aisha1": fileInfo.Sha1,
-			"aiprop": "url|sha1|size",
-		}, nil)
+		images, err := client.FindImagesBySHA1(ctx, fileInfo.Sha1)
 		if err != nil {
-			return filename, "", err
+			return filename, "", "", err
 		}
 
-		if len(shaRes.Query.AllImages) > 0 {
+		if len(images) > 0 {
 			// Exists, then skip
 			fmt.Println("Image already exists under different name, skipping to prevent duplication")
-			fmt.Println("Sha1 query result: ", shaRes)
-			return shaRes.Query.AllImages[0].Name, "skipped", nil
+			fmt.Println("Sha1 query result: ", images)
+			return images[0].Name, "skipped", "", nil
+		}
+
+		if data.DryRun {
+			return filename, "uploaded", filedesc, nil
 		}
 
 		// Do upload
-		res, err := utils.DoApiReq[UploadResponse](user, map[string]string{
-			"action":         "upload",
-			"comment":        replaceData.Comment,
-			"text":           filedesc,
-			"filename":       filename,
-			"ignorewarnings": "1",
-			"token":          token,
-		}, &utils.UploadedFile{
-			Filename: filename,
-			File:     string(fileInfo.File),
-			Mime:     "image/svg+xml",
+		_, err = uploadFile(ctx, client, mediawiki.UploadRequest{
+			Filename:       filename,
+			Text:           filedesc,
+			Comment:        file.Comment,
+			File:           fileInfo.File,
+			Mime:           "image/svg+xml",
+			IgnoreWarnings: true,
 		})
 		if err != nil {
-			return filename, "", err
+			return filename, "", "", err
 		}
-		if res.Upload.Result == "Success" {
-			return filename, "uploaded", nil
-		}
-		return filename, "", fmt.Errorf("upload failed: %s", res.Upload.Result)
+		return filename, "uploaded", filedesc, nil
 	}
 
 	// Page already exists
@@ -435,29 +263,17 @@ func uploadMapFile(user *models.User, token string, replaceData ReplaceVarsData,
 	case models.DescriptionOverwriteBehaviourExceptCategories:
 		wikiText, err = getFileWikiText(user, filename)
 		if err == nil {
-			// Remove all user incoming categories
-			incomingCategories := extractCategories(filedesc)
-			for _, text := range incomingCategories {
-				newFileDesc = strings.ReplaceAll(newFileDesc, text, "")
-			}
-
-			newFileDesc = strings.TrimSpace(newFileDesc)
-			// Apply existing file categories
-			existingCategories := extractCategories(wikiText)
-			for _, text := range existingCategories {
-				newFileDesc = newFileDesc + "\n" + text
-			}
-
+			newFileDesc = keepExistingCategories(filedesc, wikiText)
 		} else {
 			fmt.Println("ERROR GETTING WIKITEXT: ", err)
-			return filename, "", fmt.Errorf("Error getting wikitext for except-category overwrite")
+			return filename, "", "", fmt.Errorf("Error getting wikitext for except-category overwrite")
 		}
 
 	case models.DescriptionOverwriteBehaviourOnlyFile:
 		wikiText, err = getFileWikiText(user, filename)
 		if err != nil {
 			fmt.Println(" ", err)
-			return filename, "", fmt.Errorf("Error getting wikitext for file-only overwrite")
+			return filename, "", "", fmt.Errorf("Error getting wikitext for file-only overwrite")
 		}
 
 		newFileDesc = wikiText
@@ -470,62 +286,63 @@ func uploadMapFile(user *models.User, token string, replaceData ReplaceVarsData,
 			wikiText, err = getFileWikiText(user, filename)
 		}
 
-		params := map[string]string{
-			"action":         "edit",
-			"comment":        "Updating description from " + data.Url,
-			"text":           newFileDesc,
-			"title":          "File:" + filename,
-			"ignorewarnings": "1",
-			"token":          token,
-		}
-
 		if wikiText != "" && strings.Compare(strings.TrimSpace(wikiText), strings.TrimSpace(newFileDesc)) != 0 {
 			// fmt.Println("Old Desc:\n", strings.TrimSpace(wikiText))
 			// fmt.Println("New Desc:\n", strings.TrimSpace(newFileDesc))
 
-			res, err := utils.DoApiReq[interface{}](user, params, nil)
-			if err != nil {
-				fmt.Println("Error updating description: ", err, res)
-			} else {
-				res2 := *res
-				res3, ok1 := res2.(map[string]interface{})
-				if ok1 {
-					_, ok2 := res3["error"]
-					if ok2 {
-						fmt.Println("Error updating description", res3)
-						return filename, "", fmt.Errorf("Error updating description")
+			if data.DryRun {
+				return filename, "description_updated", newFileDesc, nil
+			}
 
-					}
+			_, err := client.Edit(ctx, mediawiki.EditRequest{
+				Title:   "File:" + filename,
+				Text:    newFileDesc,
+				Summary: "Updating description from " + data.Url,
+			})
+			if err != nil {
+				fmt.Println("Error updating description: ", err)
+				if ctx.Err() != nil {
+					return filename, "", "", ctx.Err()
 				}
-				return filename, "description_updated", nil
+				return filename, "", "", fmt.Errorf("Error updating description: %w", err)
 			}
+			return filename, "description_updated", newFileDesc, nil
 		}
-		return filename, "skipped", nil
+		return filename, "skipped", newFileDesc, nil
 	} else {
 		// Image changed, Overwrite the file
-		res, err := utils.DoApiReq[UploadResponse](user, map[string]string{
-			"action":         "upload",
-			"comment":        replaceData.Comment,
-			"text":           newFileDesc,
-			"filename":       filename,
-			"ignorewarnings": "1",
-			"token":          token,
-		}, &utils.UploadedFile{
-			Filename: filename,
-			File:     string(fileInfo.File),
-			Mime:     "image/svg+xml",
+		if data.DryRun {
+			return filename, "overwritten", newFileDesc, nil
+		}
+
+		_, err := uploadFile(ctx, client, mediawiki.UploadRequest{
+			Filename:       filename,
+			Text:           newFileDesc,
+			Comment:        file.Comment,
+			File:           fileInfo.File,
+			Mime:           "image/svg+xml",
+			IgnoreWarnings: true,
 		})
-		if err != nil {
-			return filename, "", err
+		if errors.Is(err, mediawiki.ErrFileExistsNoChange) {
+			return filename, "skipped", newFileDesc, nil
 		}
-		if res.Upload.Result == "Success" {
-			return filename, "overwritten", nil
+		if err != nil {
+			fmt.Println("Error uploading file", err)
+			return filename, "", "", err
 		}
-		fmt.Println("Error uploading file", res)
-		return filename, "", fmt.Errorf("%s", res.Upload.Result)
+		return filename, "overwritten", newFileDesc, nil
 	}
 }
 
+// uploadFile uploads req in one request, or in chunks when the file is above CHUNKED_UPLOAD_THRESHOLD
+func uploadFile(ctx context.Context, client *mediawiki.Client, req mediawiki.UploadRequest) (*mediawiki.UploadResponse, error) {
+	if len(req.File) > constants.CHUNKED_UPLOAD_THRESHOLD {
+		fmt.Println("Uploading in chunks", req.Filename, len(req.File))
+		return client.UploadChunked(ctx, req, constants.UPLOAD_CHUNK_SIZE)
+	}
+	return client.Upload(ctx, req)
+}
+
 func downloadCommonsFile(filename, outputPath string, user *models.User) error {
 	fmt.Println("=========== DOWNLAODING OCMMONS FILE IN: ", outputPath, filename)
 	page, err := getCommonsFilePageByName(filename, user)
@@ -768,13 +585,23 @@ func GetMapTemplate(taskId string) (string, error) {
 	endYear := time.Unix(0, 0).Unix()
 	endYearStr := ""
 
+	// Only the regions picked for the task get a gallery, the slider starts on World unless it wasn't picked
+	taskRegions := make(map[string]bool)
+	for _, region := range task.Regions {
+		taskRegions[region] = true
+	}
+	startingView := "World"
+	if len(task.Regions) > 0 && !taskRegions[startingView] {
+		startingView = task.Regions[0]
+	}
+
 	// Accumilate regions
 	regions := make(map[string]bool)
 	for _, el := range taskProcesses {
-		if el.Type == models.TaskProcessTypeMap && !regions[el.Region] {
+		if el.Type == models.TaskProcessTypeMap && !regions[el.Region] && (len(taskRegions) == 0 || taskRegions[el.Region]) {
 			regions[el.Region] = true
 		}
-		if el.Type == models.TaskProcessTypeMap && el.Status != models.TaskProcessStatusFailed && strings.ToLower(el.Region) == "world" {
+		if el.Type == models.TaskProcessTypeMap && el.Status != models.TaskProcessStatusFailed && strings.EqualFold(el.Region, startingView) && task.YearFilter.IncludesDate(el.Date) {
 			elDate, err := utils.ParseDate(el.Date)
 			if err == nil {
 				if elDate.Unix() < startYear {
@@ -809,7 +636,8 @@ func GetMapTemplate(taskId string) (string, error) {
 	for key := range regions {
 		items := make([]FileNameAcc, 0)
 		for _, tp := range taskProcesses {
-			if tp.Status != models.TaskProcessStatusFailed && tp.Region == key && tp.Type == models.TaskProcessTypeMap && tp.FileName != "" {
+			// Years backfilled from Commons can be outside the task's year filter
+			if tp.Status != models.TaskProcessStatusFailed && tp.Region == key && tp.Type == models.TaskProcessTypeMap && tp.FileName != "" && task.YearFilter.IncludesDate(tp.Date) {
 				items = append(items, FileNameAcc{
 					Year:     tp.Date,
 					Region:   tp.Region,
@@ -826,22 +654,27 @@ func GetMapTemplate(taskId string) (string, error) {
 		}
 	}
 
+	categoriesData := make([]CountryTemplateDataItem, 0)
 	for _, tp := range taskProcesses {
 		if tp.Type == models.TaskProcessTypeCountry && tp.Status != models.TaskProcessStatusFailed && tp.FileName != "" {
-			if strings.HasPrefix(tp.Region, "OWID_") {
-				region, has := constants.REGIONS_CODES_NAME_MAP[tp.Region]
-				if has {
-					regionsChartsData = append(regionsChartsData, RegionChartTemplateDataItem{
-						Country:  tp.Region,
-						FileName: tp.FileName,
-						Region:   region,
-					})
-				}
-			} else {
+			entity, ok := entities.FindByCode(tp.Region)
+			switch {
+			case !ok || entity.Category == entities.CategoryCountry:
 				countriesData = append(countriesData, CountryTemplateDataItem{
 					Country:  tp.Region,
 					FileName: tp.FileName,
 				})
+			case entity.Category == entities.CategoryRegion:
+				regionsChartsData = append(regionsChartsData, RegionChartTemplateDataItem{
+					Country:  tp.Region,
+					FileName: tp.FileName,
+					Region:   entity.Name,
+				})
+			default:
+				categoriesData = append(categoriesData, CountryTemplateDataItem{
+					Country:  tp.Region,
+					FileName: tp.FileName,
+				})
 			}
 		}
 	}
@@ -855,7 +688,7 @@ func GetMapTemplate(taskId string) (string, error) {
 	sliderTemplateText.WriteString("|title        =\n")
 	sliderTemplateText.WriteString("|language     =\n")
 	sliderTemplateText.WriteString(fmt.Sprintf("|file         = [[File:%s|link=|thumb|upright=1.6|%s]]\n", endFileName, strings.ReplaceAll(task.CommonsTemplateName, "Template:OWID/", "")))
-	sliderTemplateText.WriteString("|startingView = World\n")
+	sliderTemplateText.WriteString(fmt.Sprintf("|startingView = %s\n", startingView))
 	sliderTemplateText.WriteString("}}\n")
 
 	wikiText := strings.Builder{}
@@ -898,6 +731,8 @@ func GetMapTemplate(taskId string) (string, error) {
 		}
 	}
 
+	writeEntityCategoryGalleries(&wikiText, categoriesData)
+
 	wikiText.WriteString("}}\n")
 	// utils.SendWSMessage(session, "wikitext", wikiText.String())
 	return wikiText.String(), nil
@@ -911,12 +746,28 @@ func GetChartTemplate(taskId string) (string, error) {
 	}
 
 	data := make([]CountryTemplateDataItem, 0)
+	categoriesData := make([]CountryTemplateDataItem, 0)
 	for _, p := range taskProcesses {
-		data = append(data, CountryTemplateDataItem{
+		if p.Type != models.TaskProcessTypeCountry || p.Status == models.TaskProcessStatusFailed || p.FileName == "" {
+			continue
+		}
+		item := CountryTemplateDataItem{
 			Country:  p.Region,
 			FileName: p.FileName,
-		})
+		}
+		// Regions stay in the countries gallery of charts
+		if entity, ok := entities.FindByCode(p.Region); ok && entity.Category != entities.CategoryCountry && entity.Category != entities.CategoryRegion {
+			categoriesData = append(categoriesData, item)
+		} else {
+			data = append(data, item)
+		}
 	}
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].Country < data[j].Country
+	})
+	sort.SliceStable(categoriesData, func(i, j int) bool {
+		return categoriesData[i].Country < categoriesData[j].Country
+	})
 
 	wikiText := strings.Builder{}
 	wikiText.WriteString("|gallery-AllCountries=\n")
@@ -925,11 +776,41 @@ func GetChartTemplate(taskId string) (string, error) {
 		wikiText.WriteString(fmt.Sprintf("File:%s!country=%s\n", el.FileName, el.Country))
 	}
 
+	writeEntityCategoryGalleries(&wikiText, categoriesData)
+
 	wikiText.WriteString("\n")
 	// utils.SendWSMessage(session, "wikitext_countries", wikiText.String())
 	return wikiText.String(), nil
 }
 
+// entityCategoryGalleries names the template gallery of each entity category imported besides countries and regions
+var entityCategoryGalleries = []struct {
+	Category entities.Category
+	Gallery  string
+}{
+	{entities.CategoryAggregate, "Aggregates"},
+	{entities.CategoryIncomeGroup, "IncomeGroups"},
+	{entities.CategorySubnational, "Subnational"},
+}
+
+// writeEntityCategoryGalleries writes a gallery for each category of entityCategoryGalleries items has files for
+func writeEntityCategoryGalleries(wikiText *strings.Builder, items []CountryTemplateDataItem) {
+	for _, gallery := range entityCategoryGalleries {
+		hasItems := false
+		for _, item := range items {
+			entity, ok := entities.FindByCode(item.Country)
+			if !ok || entity.Category != gallery.Category {
+				continue
+			}
+			if !hasItems {
+				wikiText.WriteString(fmt.Sprintf("|gallery-%s=\n", gallery.Gallery))
+				hasItems = true
+			}
+			wikiText.WriteString(fmt.Sprintf("File:%s!country=%s\n", item.FileName, item.Country))
+		}
+	}
+}
+
 func GetFileNameFromChartName(chartName string) string {
 	return strings.ReplaceAll(chartName, "-", " ")
 }
@@ -944,75 +825,17 @@ func SVGHasSwitchElement(filePath string) bool {
 	return re.Match(data)
 }
 
-type WikiResponse struct {
-	Query struct {
-		Pages map[string]WikiPage `json:"pages"`
-	} `json:"query"`
-}
-
-type WikiPage struct {
-	PageID    int            `json:"pageid"`
-	NS        int            `json:"ns"`
-	Title     string         `json:"title"`
-	Revisions []WikiRevision `json:"revisions"`
-}
-
-type WikiRevision struct {
-	Slots WikiSlots `json:"slots"`
-}
-
-type WikiSlots struct {
-	Main WikiMainSlot `json:"main"`
-}
-
-type WikiMainSlot struct {
-	ContentModel  string `json:"contentmodel"`
-	ContentFormat string `json:"contentformat"`
-
-	// MediaWiki formatversion=1 returns page source in "*".
-	Content string `json:"*"`
-
-	// MediaWiki formatversion=2 may return page source in "content".
-	ContentV2 string `json:"content"`
-}
-
 type AvailableData struct {
 	CountryCodes []string                     `json:"country_codes"`
 	Regions      map[string]map[string]string `json:"regions"`
 }
 
 func GetTemplateExistingSources(user *models.User, pageTitle string) (*AvailableData, error) {
-	resp, err := utils.DoApiReq[WikiResponse](user, map[string]string{
-		"action":  "query",
-		"format":  "json",
-		"titles":  pageTitle,
-		"prop":    "revisions",
-		"rvprop":  "content",
-		"rvslots": "main",
-	}, nil)
+	source, err := mediawiki.NewClient(user).PageContent(context.Background(), pageTitle)
 	if err != nil {
 		return nil, err
 	}
 
-	var source string
-
-	for _, page := range resp.Query.Pages {
-		if len(page.Revisions) == 0 {
-			continue
-		}
-
-		mainSlot := page.Revisions[0].Slots.Main
-
-		source = mainSlot.Content
-		if source == "" {
-			source = mainSlot.ContentV2
-		}
-
-		if source != "" {
-			break
-		}
-	}
-
 	if source == "" {
 		return &AvailableData{
 			CountryCodes: []string{},
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+)
+
+// ErrTaskCancelled and ErrTaskPaused are the causes of a task context stopped
+// by the user, ErrTaskStalled stops a task that made no progress. Any other cause
+// means the server is shutting down, stalled and shut down tasks go back to the queue
+var (
+	ErrTaskCancelled = errors.New("task cancelled")
+	ErrTaskPaused    = errors.New("task paused")
+	ErrTaskStalled   = errors.New("task stalled")
+)
+
+// TaskRuntime is the in-memory state of a running task
+type TaskRuntime struct {
+	TaskId string
+
+	cancel    context.CancelCauseFunc
+	mu        sync.Mutex
+	positions map[string]string // worker lane => region/date or country being processed
+}
+
+var (
+	taskRuntimes   = make(map[string]*TaskRuntime)
+	taskRuntimesMu sync.Mutex
+)
+
+// StartTaskRuntime registers a running task, the returned context is done when
+// the task gets cancelled or parent is done
+func StartTaskRuntime(parent context.Context, taskId string) (context.Context, *TaskRuntime) {
+	ctx, cancel := context.WithCancelCause(parent)
+	runtime := &TaskRuntime{
+		TaskId:    taskId,
+		cancel:    cancel,
+		positions: make(map[string]string),
+	}
+
+	taskRuntimesMu.Lock()
+	taskRuntimes[taskId] = runtime
+	taskRuntimesMu.Unlock()
+
+	return ctx, runtime
+}
+
+// Stop unregisters the task and releases its context
+func (runtime *TaskRuntime) Stop() {
+	taskRuntimesMu.Lock()
+	if taskRuntimes[runtime.TaskId] == runtime {
+		delete(taskRuntimes, runtime.TaskId)
+	}
+	taskRuntimesMu.Unlock()
+
+	runtime.cancel(nil)
+}
+
+// CancelTaskRuntime cancels a running task, it returns false if the task isn't running
+func CancelTaskRuntime(taskId string) bool {
+	taskRuntimesMu.Lock()
+	runtime, ok := taskRuntimes[taskId]
+	taskRuntimesMu.Unlock()
+	if !ok {
+		return false
+	}
+
+	runtime.cancel(ErrTaskCancelled)
+	return true
+}
+
+// PauseTaskRuntime stops a running task so it can be resumed later, it returns false if the task isn't running
+func PauseTaskRuntime(taskId string) bool {
+	taskRuntimesMu.Lock()
+	runtime, ok := taskRuntimes[taskId]
+	taskRuntimesMu.Unlock()
+	if !ok {
+		return false
+	}
+
+	runtime.cancel(ErrTaskPaused)
+	return true
+}
+
+// RequeueStalledTask puts a task that stopped making progress back in the queue, its finished task
+// processes and checkpoints are kept so the next run resumes. A task still running is stopped and
+// requeues itself once it exits
+func RequeueStalledTask(task *models.Task) {
+	taskRuntimesMu.Lock()
+	runtime, ok := taskRuntimes[task.ID]
+	taskRuntimesMu.Unlock()
+	if ok {
+		runtime.cancel(ErrTaskStalled)
+		return
+	}
+
+	requeueInterruptedTask(task)
+}
+
+// IsTaskRunning tells if the task has a registered runtime, a cancelled task
+// stays registered until it stopped
+func IsTaskRunning(taskId string) bool {
+	taskRuntimesMu.Lock()
+	defer taskRuntimesMu.Unlock()
+
+	_, ok := taskRuntimes[taskId]
+	return ok
+}
+
+// IsTaskCancelled tells if ctx was cancelled by the user rather than by a shutdown
+func IsTaskCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrTaskCancelled)
+}
+
+// IsTaskPaused tells if ctx was stopped by a pause request
+func IsTaskPaused(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrTaskPaused)
+}
+
+// setTaskPosition records what a worker lane of the task is processing, lanes
+// are regions for maps and country list slices for countries
+func setTaskPosition(taskId, lane, position string) {
+	taskRuntimesMu.Lock()
+	runtime, ok := taskRuntimes[taskId]
+	taskRuntimesMu.Unlock()
+	if !ok {
+		return
+	}
+
+	runtime.mu.Lock()
+	runtime.positions[lane] = position
+	runtime.mu.Unlock()
+}
+
+// clearTaskPosition removes the position of a lane that finished
+func clearTaskPosition(taskId, lane string) {
+	taskRuntimesMu.Lock()
+	runtime, ok := taskRuntimes[taskId]
+	taskRuntimesMu.Unlock()
+	if !ok {
+		return
+	}
+
+	runtime.mu.Lock()
+	delete(runtime.positions, lane)
+	runtime.mu.Unlock()
+}
+
+// Positions returns the positions of the lanes in progress separated by commas
+func (runtime *TaskRuntime) Positions() string {
+	runtime.mu.Lock()
+	defer runtime.mu.Unlock()
+
+	positions := make([]string, 0, len(runtime.positions))
+	for _, position := range runtime.positions {
+		positions = append(positions, position)
+	}
+	sort.Strings(positions)
+
+	return strings.Join(positions, ", ")
+}
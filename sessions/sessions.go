@@ -13,6 +13,7 @@ type Session struct {
 	ResourceOwnerKey        string
 	ResourceOwnerSecret     string
 	OauthVerifier           string
+	WikiProfile             string // Profile the session is logging in to, see env.GetWikiProfiles
 	Ws                      *websocket.Conn
 	WsMutex                 *sync.Mutex
 }
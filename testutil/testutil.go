@@ -0,0 +1,102 @@
+// Package testutil sets up the database, environment and records the tests of the other packages run with
+package testutil
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/wpmed-videowiki/OWIDImporter/env"
+	"github.com/wpmed-videowiki/OWIDImporter/models"
+)
+
+// Env is the environment the tests run with, it has a "testwiki" wiki profile next to the default one
+var Env = map[string]string{
+	"OWID_UA":              "OWIDImporter tests",
+	"OWID_OAUTH_TOKEN":     "token",
+	"OWID_OAUTH_SECRET":    "secret",
+	"OWID_OAUTH_INITIATE":  "https://commons.example.org/initiate",
+	"OWID_OAUTH_AUTH":      "https://commons.example.org/authorize",
+	"OWID_OAUTH_TOKEN_URL": "https://commons.example.org/token",
+	"OWID_MW_API":          "https://commons.example.org/w/api.php",
+	"OWID_ENV":             "test",
+	"OWID_ENCRYPTION_KEY":  "af64797249a5dc20cb77d6eeb0a412e0e24a60570a7233f3dbba18ff9ae8f0a9",
+
+	"OWID_WIKI_PROFILES":                 "testwiki",
+	"OWID_WIKI_TESTWIKI_MW_API":          "https://test.example.org/w/api.php",
+	"OWID_WIKI_TESTWIKI_OAUTH_TOKEN":     "test-token",
+	"OWID_WIKI_TESTWIKI_OAUTH_SECRET":    "test-secret",
+	"OWID_WIKI_TESTWIKI_OAUTH_INITIATE":  "https://test.example.org/initiate",
+	"OWID_WIKI_TESTWIKI_OAUTH_AUTH":      "https://test.example.org/authorize",
+	"OWID_WIKI_TESTWIKI_OAUTH_TOKEN_URL": "https://test.example.org/token",
+}
+
+// Main runs the tests of a package from TestMain against a fresh database in a temporary
+// directory, with Env set and the wiki profiles loaded. setup gets the directory before
+// the database is created, for the package's own settings
+func Main(m *testing.M, setup func(dir string)) {
+	for key, value := range Env {
+		os.Setenv(key, value)
+	}
+	dir, err := os.MkdirTemp("", "owid-test")
+	if err != nil {
+		panic(err)
+	}
+	if setup != nil {
+		setup(dir)
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	models.Init()
+	if err := env.LoadWikiProfiles(); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+
+	os.Chdir(wd)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// NewUser creates a user with a unique username
+func NewUser(t *testing.T) *models.User {
+	t.Helper()
+	user, err := models.NewUser("test-"+uuid.New().String(), "key", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// NewTask creates a task from options, a map task queued for a test chart unless options say otherwise
+func NewTask(t *testing.T, options models.NewTaskOptions) *models.Task {
+	t.Helper()
+	if options.UserId == "" {
+		options.UserId = "user-" + uuid.New().String()
+	}
+	if options.URL == "" {
+		options.URL = "https://ourworldindata.org/grapher/test"
+	}
+	if options.FileName == "" {
+		options.FileName = "$REGION, $YEAR.svg"
+	}
+	if options.DescriptionOverwriteBehaviour == "" {
+		options.DescriptionOverwriteBehaviour = models.DescriptionOverwriteBehaviourAll
+	}
+	if options.CountryDescriptionOverwriteBehaviour == "" {
+		options.CountryDescriptionOverwriteBehaviour = models.DescriptionOverwriteBehaviourAll
+	}
+	if options.Status == "" {
+		options.Status = models.TaskStatusQueued
+	}
+	if options.Type == "" {
+		options.Type = models.TaskTypeMap
+	}
+
+	task, err := models.NewTask(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
@@ -1,15 +1,11 @@
 package utils
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
-	"net/textproto"
-	"net/url"
 	"os"
 	"regexp"
 	"strconv"
@@ -23,154 +19,27 @@ import (
 	"github.com/wpmed-videowiki/OWIDImporter/sessions"
 )
 
-const MAX_RES_LOG_LENGTH = 200
-
-func GetOAuthConfig() *oauth1.Config {
-	envData := env.GetEnv()
+func GetOAuthConfig(profile env.WikiProfile) *oauth1.Config {
 	return &oauth1.Config{
-		ConsumerKey:    envData.OWID_OAUTH_TOKEN,
-		ConsumerSecret: envData.OWID_OAUTH_SECRET,
+		ConsumerKey:    profile.OAuthToken,
+		ConsumerSecret: profile.OAuthSecret,
 		CallbackURL:    "oob",
 		Endpoint: oauth1.Endpoint{
-			RequestTokenURL: envData.OWID_OAUTH_INITIATE,
-			AuthorizeURL:    envData.OWID_OAUTH_AUTH,
-			AccessTokenURL:  envData.OWID_OAUTH_TOKEN_URL,
+			RequestTokenURL: profile.OAuthInitiate,
+			AuthorizeURL:    profile.OAuthAuth,
+			AccessTokenURL:  profile.OAuthTokenUrl,
 		},
 	}
 }
 
-func GetOAuthClient(user *models.User) *http.Client {
-	return oauth1.NewClient(context.Background(), GetOAuthConfig(), &oauth1.Token{
+// GetOAuthClient signs requests with the user's tokens for the consumer of profile
+func GetOAuthClient(user *models.User, profile env.WikiProfile) *http.Client {
+	return oauth1.NewClient(context.Background(), GetOAuthConfig(profile), &oauth1.Token{
 		Token:       user.ResourceOwnerKey,
 		TokenSecret: user.ResourceOwnerSecret,
 	})
 }
 
-type UploadedFile struct {
-	Filename string
-	File     string
-	Mime     string
-}
-
-func DoApiReq[T any](user *models.User, params map[string]string, file *UploadedFile) (*T, error) {
-	client := GetOAuthClient(user)
-	values := make(url.Values)
-	url := env.GetEnv().OWID_MW_API + "?"
-	for k, v := range params {
-		if k != "token" && k != "text" {
-			values.Set(k, v)
-		}
-	}
-	if _, ok := values["format"]; !ok {
-		values.Set("format", "json")
-		values.Set("formatversion", "2")
-	}
-	url += values.Encode()
-
-	var res *http.Response
-	var err error
-
-	if file != nil {
-		var b bytes.Buffer
-		writer := multipart.NewWriter(&b)
-		defer writer.Close()
-		fileWriter, err := writer.CreatePart(textproto.MIMEHeader{
-			"Content-Disposition": []string{fmt.Sprintf("form-data; name=\"file\"; filename=\"%s\"", file.Filename)},
-			"Content-Type":        []string{file.Mime},
-		})
-		if err != nil {
-			fmt.Println("Error creating form file", err)
-			return nil, err
-		}
-		_, err = fileWriter.Write([]byte(file.File))
-		if err != nil {
-			fmt.Println("Error writing file", err)
-			return nil, err
-		}
-		// Add other fields to the form
-		writer.WriteField("filename", file.Filename)
-
-		for k, v := range params {
-			writer.WriteField(k, v)
-		}
-		// Close the writer to complete the form data
-		err = writer.Close()
-		if err != nil {
-			fmt.Println("Error closing writer", err)
-			return nil, err
-		}
-
-		res, err = client.Post(url, "multipart/form-data; boundary="+writer.Boundary(), &b)
-	} else if params["token"] != "" {
-		var b bytes.Buffer
-		writer := multipart.NewWriter(&b)
-		defer writer.Close()
-
-		for k, v := range params {
-			writer.WriteField(k, v)
-		}
-		// Close the writer to complete the form data
-		err = writer.Close()
-		if err != nil {
-			fmt.Println("Error closing writer", err)
-			return nil, err
-		}
-
-		res, err = client.Post(url, "multipart/form-data; boundary="+writer.Boundary(), &b)
-	} else {
-		res, err = client.Get(url)
-	}
-
-	if err != nil {
-		fmt.Println("Error", err)
-		return nil, err
-	}
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		fmt.Println("Error reading body", err)
-		return nil, err
-	}
-	// strRes := string(body)
-	// // if utf8.RuneCountInString(strRes) > MAX_RES_LOG_LENGTH {
-	// // 	strRes = strRes[:MAX_RES_LOG_LENGTH] + "..."
-	// // }
-	// fmt.Println("Res body: ", res.StatusCode, strRes)
-
-	var result T
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		fmt.Println("Error unmarshalling api response", url, params, err)
-		fmt.Println(string(body))
-		return nil, err
-	}
-	return &result, nil
-}
-
-type UserInfo struct {
-	BatchComplete string `json:"batchcomplete"`
-	Query         struct {
-		UserInfo struct {
-			Name string `json:"name"`
-			ID   int    `json:"id"`
-		} `json:"userinfo"`
-	} `json:"query"`
-}
-
-func GetUsername(user *models.User) (string, error) {
-	result, err := DoApiReq[UserInfo](user, map[string]string{
-		"action": "query",
-		"meta":   "userinfo",
-		"format": "json",
-	}, nil)
-	if err != nil {
-		fmt.Println("Error doing API request", err)
-		return "", err
-	}
-
-	return result.Query.UserInfo.Name, nil
-}
-
 func SendWSTaskProcess(taskId string, taskProcess *models.TaskProcess) error {
 	msgJson, err := json.Marshal(taskProcess)
 	if err != nil {
@@ -193,6 +62,26 @@ func SendWSTask(task *models.Task) error {
 	return nil
 }
 
+// SendWSQueuePositions pushes every queued task with its current queue position
+func SendWSQueuePositions() error {
+	tasks, err := models.FindQueuedTasks()
+	if err != nil {
+		fmt.Println("Error finding queued tasks", err)
+		return err
+	}
+
+	for i := range *tasks {
+		SendWSTask(&(*tasks)[i])
+	}
+
+	return nil
+}
+
+// SendWSUserNotification sends a notification message to the user's task list subscribers
+func SendWSUserNotification(userId string, msg string) {
+	sendWSTaskMessage(fmt.Sprintf("%s_task_list", userId), "notification", msg)
+}
+
 func sendWSTaskMessage(taskId string, messageType string, msg string) {
 	go func() {
 		if len(sessions.SubscriptionSessions[taskId]) > 0 {